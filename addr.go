@@ -0,0 +1,148 @@
+package main
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"io"
+)
+
+// this file contains the translation between file offsets and the virtual
+// addresses executables are loaded at, derived from their segment tables
+
+// segment is a range of the file loaded at a virtual address
+type segment struct {
+	offset int64
+	size   int64
+	addr   uint64
+	arch   string // architecture of universal files, empty otherwise
+}
+
+// addrMap maps file offsets of an executable to virtual addresses
+type addrMap []segment
+
+// loadAddrMap returns the segments of an ELF, PE or Mach-O file, or nil
+// if the file is not an executable
+func loadAddrMap(r io.ReaderAt) addrMap {
+	var m addrMap
+	if f, err := elf.NewFile(r); err == nil {
+		for _, p := range f.Progs {
+			if p.Type == elf.PT_LOAD && p.Filesz > 0 {
+				m = append(m, segment{int64(p.Off), int64(p.Filesz), p.Vaddr, ""})
+			}
+		}
+		if len(m) == 0 {
+			// object files have no segments, but may have allocated sections
+			for _, s := range f.Sections {
+				if s.Flags&elf.SHF_ALLOC != 0 && s.Type != elf.SHT_NOBITS && s.Addr != 0 && s.Size > 0 {
+					m = append(m, segment{int64(s.Offset), int64(s.Size), s.Addr, ""})
+				}
+			}
+		}
+		return m
+	}
+	if f, err := pe.NewFile(r); err == nil {
+		var base uint64
+		var headers uint32
+		switch h := f.OptionalHeader.(type) {
+		case *pe.OptionalHeader32:
+			base, headers = uint64(h.ImageBase), h.SizeOfHeaders
+		case *pe.OptionalHeader64:
+			base, headers = h.ImageBase, h.SizeOfHeaders
+		}
+		if headers > 0 {
+			m = append(m, segment{0, int64(headers), base, ""})
+		}
+		for _, s := range f.Sections {
+			size := s.Size
+			if s.VirtualSize > 0 && s.VirtualSize < size {
+				size = s.VirtualSize
+			}
+			if size > 0 {
+				m = append(m, segment{int64(s.Offset), int64(size), base + uint64(s.VirtualAddress), ""})
+			}
+		}
+		return m
+	}
+	if f, err := macho.NewFile(r); err == nil {
+		return machoAddrMap(f, 0, "")
+	}
+	if f, err := macho.NewFatFile(r); err == nil {
+		// universal files contain a file per architecture, whose addresses
+		// overlap, so addresses are translated in the architecture viewed
+		for _, a := range f.Arches {
+			m = append(m, machoAddrMap(a.File, int64(a.Offset), a.Cpu.String())...)
+		}
+		return m
+	}
+	return nil
+}
+
+// machoAddrMap returns the segments of a Mach-O file at offset, which is
+// the file of architecture arch in universal files
+func machoAddrMap(f *macho.File, offset int64, arch string) addrMap {
+	var m addrMap
+	for _, l := range f.Loads {
+		if s, ok := l.(*macho.Segment); ok && s.Filesz > 0 {
+			m = append(m, segment{offset + int64(s.Offset), int64(s.Filesz), s.Addr, arch})
+		}
+	}
+	return m
+}
+
+// addr returns the virtual address of the byte at offset
+func (m addrMap) addr(offset int64) (uint64, bool) {
+	for _, s := range m {
+		if offset >= s.offset && offset < s.offset+s.size {
+			return s.addr + uint64(offset-s.offset), true
+		}
+	}
+	return 0, false
+}
+
+// offset returns the file offset of the byte at virtual address addr
+func (m addrMap) offset(addr uint64) (int64, bool) {
+	for _, s := range m {
+		if addr >= s.addr && addr-s.addr < uint64(s.size) {
+			return s.offset + int64(addr-s.addr), true
+		}
+	}
+	return 0, false
+}
+
+// arch returns the architecture of the part of a universal file containing
+// offset, which is the architecture of the last segment starting before it
+func (m addrMap) arch(offset int64) string {
+	arch, start := "", int64(-1)
+	for _, s := range m {
+		if s.offset <= offset && s.offset > start {
+			arch, start = s.arch, s.offset
+		}
+	}
+	if start < 0 && len(m) > 0 {
+		arch = m[0].arch
+	}
+	return arch
+}
+
+// only returns the segments of architecture arch
+func (m addrMap) only(arch string) addrMap {
+	var only addrMap
+	for _, s := range m {
+		if s.arch == arch {
+			only = append(only, s)
+		}
+	}
+	return only
+}
+
+// maxAddr returns the highest virtual address of any byte in the file
+func (m addrMap) maxAddr() uint64 {
+	var last uint64
+	for _, s := range m {
+		if end := s.addr + uint64(s.size) - 1; end > last {
+			last = end
+		}
+	}
+	return last
+}
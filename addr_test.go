@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestAddrMapArch(t *testing.T) {
+	// two architectures of a universal file loaded at the same address
+	m := addrMap{
+		{0x1000, 0x100, 0x10000, "x86_64"},
+		{0x1100, 0x100, 0x20000, "x86_64"},
+		{0x4000, 0x100, 0x10000, "arm64"},
+	}
+	tests := []struct {
+		cursor int64
+		arch   string
+		offset int64 // of address 0x10010
+	}{
+		{0, "x86_64", 0x1010},
+		{0x1180, "x86_64", 0x1010},
+		{0x3000, "x86_64", 0x1010},
+		{0x4050, "arm64", 0x4010},
+		{0x9000, "arm64", 0x4010},
+	}
+	for _, test := range tests {
+		arch := m.arch(test.cursor)
+		offset, ok := m.only(arch).offset(0x10010)
+		if arch != test.arch || !ok || offset != test.offset {
+			t.Errorf("at %X address maps to %X in %s, want %X in %s", test.cursor, offset, arch, test.offset, test.arch)
+		}
+	}
+}
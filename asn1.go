@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+)
+
+// this file contains the ASN.1 DER decoder, used for certificates, keys
+// and signatures, naming the object identifiers common in X.509
+
+var asn1Tags = map[int]string{
+	asn1.TagBoolean:         "BOOLEAN",
+	asn1.TagInteger:         "INTEGER",
+	asn1.TagBitString:       "BIT STRING",
+	asn1.TagOctetString:     "OCTET STRING",
+	asn1.TagNull:            "NULL",
+	asn1.TagOID:             "OBJECT IDENTIFIER",
+	asn1.TagEnum:            "ENUMERATED",
+	asn1.TagUTF8String:      "UTF8String",
+	asn1.TagSequence:        "SEQUENCE",
+	asn1.TagSet:             "SET",
+	asn1.TagNumericString:   "NumericString",
+	asn1.TagPrintableString: "PrintableString",
+	asn1.TagT61String:       "T61String",
+	asn1.TagIA5String:       "IA5String",
+	asn1.TagUTCTime:         "UTCTime",
+	asn1.TagGeneralizedTime: "GeneralizedTime",
+	asn1.TagGeneralString:   "GeneralString",
+	asn1.TagBMPString:       "BMPString",
+	26:                      "VisibleString",
+	28:                      "UniversalString",
+}
+
+var asn1Classes = []string{"UNIVERSAL", "APPLICATION", "", "PRIVATE"}
+
+var asn1OIDs = map[string]string{
+	// attributes of distinguished names
+	"2.5.4.3":                    "commonName",
+	"2.5.4.4":                    "surname",
+	"2.5.4.5":                    "serialNumber",
+	"2.5.4.6":                    "countryName",
+	"2.5.4.7":                    "localityName",
+	"2.5.4.8":                    "stateOrProvinceName",
+	"2.5.4.9":                    "streetAddress",
+	"2.5.4.10":                   "organizationName",
+	"2.5.4.11":                   "organizationalUnitName",
+	"2.5.4.12":                   "title",
+	"2.5.4.42":                   "givenName",
+	"0.9.2342.19200300.100.1.25": "domainComponent",
+	"1.2.840.113549.1.9.1":       "emailAddress",
+
+	// certificate extensions
+	"2.5.29.14":               "subjectKeyIdentifier",
+	"2.5.29.15":               "keyUsage",
+	"2.5.29.17":               "subjectAltName",
+	"2.5.29.18":               "issuerAltName",
+	"2.5.29.19":               "basicConstraints",
+	"2.5.29.30":               "nameConstraints",
+	"2.5.29.31":               "cRLDistributionPoints",
+	"2.5.29.32":               "certificatePolicies",
+	"2.5.29.35":               "authorityKeyIdentifier",
+	"2.5.29.37":               "extKeyUsage",
+	"1.3.6.1.5.5.7.1.1":       "authorityInfoAccess",
+	"1.3.6.1.5.5.7.3.1":       "serverAuth",
+	"1.3.6.1.5.5.7.3.2":       "clientAuth",
+	"1.3.6.1.5.5.7.3.3":       "codeSigning",
+	"1.3.6.1.5.5.7.3.4":       "emailProtection",
+	"1.3.6.1.5.5.7.3.8":       "timeStamping",
+	"1.3.6.1.5.5.7.48.1":      "ocsp",
+	"1.3.6.1.5.5.7.48.2":      "caIssuers",
+	"1.3.6.1.4.1.11129.2.4.2": "signedCertificateTimestamps",
+
+	// algorithms
+	"1.2.840.113549.1.1.1":   "rsaEncryption",
+	"1.2.840.113549.1.1.5":   "sha1WithRSAEncryption",
+	"1.2.840.113549.1.1.10":  "rsassaPss",
+	"1.2.840.113549.1.1.11":  "sha256WithRSAEncryption",
+	"1.2.840.113549.1.1.12":  "sha384WithRSAEncryption",
+	"1.2.840.113549.1.1.13":  "sha512WithRSAEncryption",
+	"1.2.840.10040.4.1":      "dsa",
+	"1.2.840.10045.2.1":      "ecPublicKey",
+	"1.2.840.10045.4.3.2":    "ecdsaWithSHA256",
+	"1.2.840.10045.4.3.3":    "ecdsaWithSHA384",
+	"1.2.840.10045.4.3.4":    "ecdsaWithSHA512",
+	"1.2.840.10045.3.1.7":    "prime256v1",
+	"1.3.132.0.34":           "secp384r1",
+	"1.3.132.0.35":           "secp521r1",
+	"1.3.101.110":            "X25519",
+	"1.3.101.112":            "Ed25519",
+	"1.3.14.3.2.26":          "sha1",
+	"2.16.840.1.101.3.4.2.1": "sha256",
+	"2.16.840.1.101.3.4.2.2": "sha384",
+	"2.16.840.1.101.3.4.2.3": "sha512",
+
+	// PKCS #7 and #9
+	"1.2.840.113549.1.7.1": "data",
+	"1.2.840.113549.1.7.2": "signedData",
+	"1.2.840.113549.1.9.3": "contentType",
+	"1.2.840.113549.1.9.4": "messageDigest",
+	"1.2.840.113549.1.9.5": "signingTime",
+}
+
+// detectDER checks for a sequence with a long form length containing
+// another sequence, as certificates and keys start
+func detectDER(head []byte) bool {
+	return len(head) >= 8 && head[0] == 0x30 && (head[1] == 0x82 || head[1] == 0x83) &&
+		head[int(head[1]&0x7F)+2] == 0x30
+}
+
+func parseDER(r io.ReaderAt, size int64) ([]*node, error) {
+	b := make([]byte, min64(size, decoderMaxSize))
+	n, err := r.ReadAt(b, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return decodeASN1(b[:n], 0, nil)
+}
+
+// decodeASN1 decodes b as a sequence of DER encoded values
+func decodeASN1(b []byte, offset int64, args []string) ([]*node, error) {
+	nodes, n := asn1Nodes(b, offset, 0)
+	if n < len(b) {
+		nodes = append(nodes, &node{
+			name:  "Trailing data",
+			value: formatBytes(b[n:]),
+			start: offset + int64(n),
+			end:   offset + int64(len(b)),
+		})
+		if len(nodes) == 1 {
+			return nodes, fmt.Errorf("invalid DER value at offset 0x%X", offset+int64(n))
+		}
+	}
+	return nodes, nil
+}
+
+// asn1Nodes returns a node for each value in b, stopping at the first
+// invalid value, and the number of bytes decoded. the contents of values
+// nested deeper than decoderMaxDepth are shown as bytes.
+func asn1Nodes(b []byte, offset int64, depth int) ([]*node, int) {
+	var nodes []*node
+	pos := 0
+	for pos < len(b) {
+		var v asn1.RawValue
+		rest, err := asn1.Unmarshal(b[pos:], &v)
+		if err != nil || v.Class == asn1.ClassUniversal && v.Tag == 0 {
+			// tag 0 is reserved for the end of indefinite lengths, and is usually padding
+			break
+		}
+		n := &node{
+			name:  asn1Name(v),
+			start: offset + int64(pos),
+			end:   offset + int64(len(b)-len(rest)),
+		}
+		data := offset + int64(len(b)-len(rest)-len(v.Bytes))
+		switch {
+		case depth >= decoderMaxDepth:
+			n.value = "nested too deeply, " + formatBytes(v.Bytes)
+		case v.IsCompound:
+			children, size := asn1Nodes(v.Bytes, data, depth+1)
+			if size < len(v.Bytes) {
+				return nodes, pos
+			}
+			n.children = children
+			n.value = asn1Describe(v, children)
+		case v.Class == asn1.ClassUniversal && (v.Tag == asn1.TagOctetString || v.Tag == asn1.TagBitString):
+			// extensions and public keys encapsulate DER values in strings
+			n.value = asn1Value(v)
+			contents, skip := v.Bytes, 0
+			if v.Tag == asn1.TagBitString && len(contents) > 0 && contents[0] == 0 {
+				contents, skip = contents[1:], 1
+			}
+			if len(contents) > 1 {
+				if children, size := asn1Nodes(contents, data+int64(skip), depth+1); size == len(contents) {
+					n.children = children
+				}
+			}
+		default:
+			n.value = asn1Value(v)
+		}
+		nodes = append(nodes, n)
+		pos = len(b) - len(rest)
+	}
+	return nodes, pos
+}
+
+// asn1Name returns the name of the tag of v
+func asn1Name(v asn1.RawValue) string {
+	if v.Class == asn1.ClassContextSpecific {
+		return fmt.Sprintf("[%d]", v.Tag)
+	}
+	if v.Class == asn1.ClassUniversal {
+		if s, ok := asn1Tags[v.Tag]; ok {
+			return s
+		}
+	}
+	return fmt.Sprintf("%s %d", asn1Classes[v.Class], v.Tag)
+}
+
+// asn1Value formats the contents of the primitive value v
+func asn1Value(v asn1.RawValue) string {
+	if v.Class != asn1.ClassUniversal {
+		if len(v.Bytes) > 0 && printable(v.Bytes) {
+			return fmt.Sprintf("%q", v.Bytes)
+		}
+		return formatBytes(v.Bytes)
+	}
+	switch v.Tag {
+	case asn1.TagBoolean:
+		var b bool
+		if _, err := asn1.Unmarshal(v.FullBytes, &b); err == nil {
+			return fmt.Sprint(b)
+		}
+	case asn1.TagInteger, asn1.TagEnum:
+		if len(v.Bytes) > 16 {
+			return fmt.Sprintf("%d bits: %s", len(v.Bytes)*8, formatBytes(v.Bytes))
+		}
+		i := new(big.Int).SetBytes(v.Bytes)
+		if len(v.Bytes) > 0 && v.Bytes[0]&0x80 != 0 {
+			i.Sub(i, new(big.Int).Lsh(big.NewInt(1), uint(len(v.Bytes)*8)))
+		}
+		return fmt.Sprintf("%s (0x%X)", i, v.Bytes)
+	case asn1.TagBitString:
+		var s asn1.BitString
+		if _, err := asn1.Unmarshal(v.FullBytes, &s); err == nil {
+			return fmt.Sprintf("%d bits: %s", s.BitLength, formatBytes(s.Bytes))
+		}
+	case asn1.TagNull:
+		return ""
+	case asn1.TagOID:
+		var oid asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(v.FullBytes, &oid); err == nil {
+			if name, ok := asn1OIDs[oid.String()]; ok {
+				return oid.String() + " " + name
+			}
+			return oid.String()
+		}
+	case asn1.TagUTCTime, asn1.TagGeneralizedTime:
+		var t time.Time
+		if _, err := asn1.Unmarshal(v.FullBytes, &t); err == nil {
+			return formatTime(t)
+		}
+	case asn1.TagUTF8String, asn1.TagNumericString, asn1.TagPrintableString, asn1.TagT61String,
+		asn1.TagIA5String, asn1.TagGeneralString, 26:
+		return fmt.Sprintf("%q", v.Bytes)
+	}
+	return formatBytes(v.Bytes)
+}
+
+// asn1Describe summarizes a constructed value. sequences starting with a
+// known object identifier, such as algorithms, attributes and extensions,
+// are described by its name.
+func asn1Describe(v asn1.RawValue, children []*node) string {
+	if len(children) > 0 && children[0].name == asn1Tags[asn1.TagOID] {
+		var oid asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(v.Bytes, &oid); err == nil {
+			if name, ok := asn1OIDs[oid.String()]; ok {
+				if len(children) == 2 && children[1].children == nil && children[1].value != "" {
+					return name + " = " + children[1].value
+				}
+				return name
+			}
+		}
+	}
+	if len(children) == 1 {
+		return "1 element"
+	}
+	return fmt.Sprintf("%d elements", len(children))
+}
@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+// derNested returns values of the given tag nested n times around an empty
+// value, each with the shortest length encoding
+func derNested(tag byte, n int) []byte {
+	sizes := make([]int, n)
+	size := 2
+	for i := n - 1; i >= 0; i-- {
+		sizes[i] = size
+		if size >= 0x80 {
+			for l := size; l > 0; l >>= 8 {
+				size++
+			}
+		}
+		size += 2
+	}
+	var b []byte
+	for _, size := range sizes {
+		b = append(b, tag)
+		if l := size; l < 0x80 {
+			b = append(b, byte(l))
+		} else {
+			var length []byte
+			for ; l > 0; l >>= 8 {
+				length = append([]byte{byte(l)}, length...)
+			}
+			b = append(append(b, 0x80|byte(len(length))), length...)
+		}
+	}
+	return append(b, tag, 0)
+}
+
+func TestASN1Nesting(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"sequences", derNested(0x30, 1<<20)},
+		{"octet strings", derNested(0x04, 2*decoderMaxDepth)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nodes, err := decodeASN1(test.b, 0, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if depth := treeDepth(nodes); depth > decoderMaxDepth+1 {
+				t.Fatalf("decoded %d levels, want at most %d", depth, decoderMaxDepth+1)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// this file contains the CBOR decoder (RFC 8949)
+
+var cborTypes = []string{"uint", "negint", "bytes", "text", "array", "map", "tag", "simple"}
+
+var cborTags = map[uint64]string{
+	0:     "date/time",
+	1:     "epoch time",
+	2:     "bignum",
+	3:     "negative bignum",
+	4:     "decimal fraction",
+	5:     "bigfloat",
+	24:    "encoded CBOR",
+	32:    "URI",
+	37:    "UUID",
+	55799: "self-described CBOR",
+}
+
+var cborSimple = map[uint64]string{20: "false", 21: "true", 22: "null", 23: "undefined"}
+
+var errCBORBreak = errors.New("unexpected CBOR break")
+
+// decodeCBOR decodes b as a sequence of CBOR data items
+func decodeCBOR(b []byte, offset int64, args []string) ([]*node, error) {
+	return decodeItems(b, offset, func(pos, depth int) (*node, int, error) {
+		return cborItem(b, offset, pos, depth)
+	})
+}
+
+// cborItem decodes the data item at pos
+func cborItem(b []byte, offset int64, pos, depth int) (*node, int, error) {
+	if depth > decoderMaxDepth {
+		return nil, pos, fmt.Errorf("CBOR nested too deeply at offset 0x%X", offset+int64(pos))
+	}
+	major, info, v, p, err := cborHead(b, offset, pos)
+	if err != nil {
+		return nil, pos, err
+	}
+	n := &node{name: cborTypes[major], start: offset + int64(pos)}
+	indefinite := info == 31
+	switch major {
+	case 0:
+		n.value = fmt.Sprint(v)
+	case 1:
+		n.value = fmt.Sprintf("-1-%d", v)
+		if v < 1<<63 {
+			n.value = fmt.Sprint(-1 - int64(v))
+		}
+	case 2, 3:
+		var data []byte
+		if indefinite {
+			// chunks of the same type, until break
+			for {
+				c, end, err := cborItem(b, offset, p, depth+1)
+				if err == errCBORBreak {
+					p = end
+					break
+				}
+				if err != nil {
+					return nil, pos, err
+				}
+				if c.name != n.name || c.children != nil {
+					// chunks must be of definite length
+					return nil, pos, fmt.Errorf("invalid CBOR chunk at offset 0x%X", offset+int64(p))
+				}
+				c.name = fmt.Sprintf("[%d]", len(n.children))
+				n.children = append(n.children, c)
+				data = append(data, b[p+cborHeadSize(b[p]):end]...)
+				p = end
+			}
+		} else {
+			if v > uint64(len(b)-p) {
+				return nil, pos, fmt.Errorf("truncated CBOR %s at offset 0x%X", n.name, offset+int64(pos))
+			}
+			data = b[p : p+int(v)]
+			p += int(v)
+		}
+		n.value = formatBytes(data)
+		if major == 3 {
+			n.value = fmt.Sprintf("%q", data)
+		}
+	case 4, 5:
+		// maps count key value pairs
+		if major == 5 {
+			v *= 2
+		}
+		var key *node
+		for i := uint64(0); indefinite || i < v; i++ {
+			c, end, err := cborItem(b, offset, p, depth+1)
+			if err == errCBORBreak && indefinite {
+				p = end
+				break
+			}
+			if err != nil {
+				return nil, pos, err
+			}
+			p = end
+			switch {
+			case major == 4:
+				c.name = fmt.Sprintf("[%d] %s", i, c.name)
+				n.children = append(n.children, c)
+			case key == nil:
+				key = c
+			default:
+				n.children = append(n.children, mapEntry(key, c))
+				key = nil
+			}
+		}
+		if key != nil {
+			return nil, pos, fmt.Errorf("CBOR map without value at offset 0x%X", key.start)
+		}
+		n.value = fmt.Sprintf("%d elements", len(n.children))
+	case 6:
+		c, end, err := cborItem(b, offset, p, depth+1)
+		if err != nil {
+			return nil, pos, err
+		}
+		p = end
+		n.name = fmt.Sprintf("tag %d", v)
+		if name, ok := cborTags[v]; ok {
+			n.name += " " + name
+		}
+		n.value = c.value
+		n.children = []*node{c}
+	case 7:
+		switch info {
+		case 25:
+			n.name, n.value = "float16", fmt.Sprint(float16(uint16(v)))
+		case 26:
+			n.name, n.value = "float32", fmt.Sprint(math.Float32frombits(uint32(v)))
+		case 27:
+			n.name, n.value = "float64", fmt.Sprint(math.Float64frombits(v))
+		case 31:
+			return nil, p, errCBORBreak
+		default:
+			n.value = fmt.Sprint(v)
+			if s, ok := cborSimple[v]; ok {
+				n.value = s
+			}
+		}
+	}
+	n.end = offset + int64(p)
+	return n, p, nil
+}
+
+// cborHead decodes the initial byte and argument of the data item at pos,
+// returning its major type, additional information, argument and the
+// position after the argument
+func cborHead(b []byte, offset int64, pos int) (major, info byte, v uint64, p int, err error) {
+	if pos >= len(b) {
+		return 0, 0, 0, pos, fmt.Errorf("truncated CBOR item at offset 0x%X", offset+int64(pos))
+	}
+	major, info = b[pos]>>5, b[pos]&0x1F
+	size := cborHeadSize(b[pos]) - 1
+	switch {
+	case info > 27 && info < 31, info == 31 && (major < 2 || major == 6):
+		return 0, 0, 0, pos, fmt.Errorf("invalid CBOR item at offset 0x%X", offset+int64(pos))
+	case size > len(b)-pos-1:
+		return 0, 0, 0, pos, fmt.Errorf("truncated CBOR item at offset 0x%X", offset+int64(pos))
+	case info < 24:
+		v = uint64(info)
+	case info < 28:
+		v = getUint(b[pos+1:], size, binary.BigEndian)
+	}
+	return major, info, v, pos + 1 + size, nil
+}
+
+// cborHeadSize returns the size of the initial byte and argument of an item
+func cborHeadSize(c byte) int {
+	switch c & 0x1F {
+	case 24:
+		return 2
+	case 25:
+		return 3
+	case 26:
+		return 5
+	case 27:
+		return 9
+	}
+	return 1
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// this file contains the newc cpio archive format, used by initramfs images,
+// which may consist of several archives in a row
+
+const (
+	cpioHeaderSize = 110
+	cpioTrailer    = "TRAILER!!!"
+	cpioMaxMembers = 1 << 20
+)
+
+var cpioFields = []string{"ino", "mode", "uid", "gid", "nlink", "mtime", "filesize",
+	"devmajor", "devminor", "rdevmajor", "rdevminor", "namesize", "check"}
+
+var cpioTypes = map[uint64]string{
+	0010000: "fifo",
+	0020000: "character device",
+	0040000: "directory",
+	0060000: "block device",
+	0100000: "file",
+	0120000: "symbolic link",
+	0140000: "socket",
+}
+
+func detectCPIO(head []byte) bool {
+	return bytes.HasPrefix(head, []byte("070701")) || bytes.HasPrefix(head, []byte("070702"))
+}
+
+func parseCPIO(r io.ReaderAt, size int64) ([]*node, error) {
+	var nodes []*node
+	pos := int64(0)
+	for i := 0; pos+cpioHeaderSize <= size; i++ {
+		if i == cpioMaxMembers {
+			return nodes, fmt.Errorf("showing the first %d members", cpioMaxMembers)
+		}
+		b := make([]byte, cpioHeaderSize)
+		if _, err := r.ReadAt(b, pos); err != nil {
+			return nodes, err
+		}
+		if !detectCPIO(b) {
+			nodes = append(nodes, &node{name: "Trailing data", value: fmt.Sprintf("%d bytes", size-pos), start: pos, end: size})
+			return nodes, nil
+		}
+
+		// header fields are 8 hexadecimal digits following the magic number
+		fields := []*node{{name: "magic", value: fmt.Sprintf("%q", b[:6]), start: pos, end: pos + 6}}
+		values := map[string]uint64{}
+		for j, name := range cpioFields {
+			raw := b[6+8*j : 14+8*j]
+			v, err := strconv.ParseUint(string(raw), 16, 32)
+			if err != nil {
+				return append(nodes, group("header", "", fields)), fmt.Errorf("invalid cpio header field %s at %08X", name, pos+6+8*int64(j))
+			}
+			values[name] = v
+			n := &node{name: name, value: fmt.Sprintf("%q (%d)", raw, v), start: pos + 6 + 8*int64(j), end: pos + 14 + 8*int64(j)}
+			switch name {
+			case "mode":
+				n.value = fmt.Sprintf("%q (%06o)", raw, v)
+			case "mtime":
+				n.value = fmt.Sprintf("%q (%s)", raw, formatTime(time.Unix(int64(v), 0)))
+			}
+			fields = append(fields, n)
+		}
+		header := group("header", "", fields)
+
+		// the name and the data are padded to multiples of 4 bytes
+		namesize, filesize := int64(values["namesize"]), int64(values["filesize"])
+		start := (pos + cpioHeaderSize + namesize + 3) &^ 3
+		if start+filesize > size {
+			return append(nodes, header), fmt.Errorf("member at %08X is truncated", pos)
+		}
+		name := readCString(r, pos+cpioHeaderSize, int(namesize))
+		nameNode := &node{name: "name", value: fmt.Sprintf("%q", name), start: pos + cpioHeaderSize, end: pos + cpioHeaderSize + namesize}
+		data := &node{name: "data", value: fmt.Sprintf("%d bytes", filesize), start: start, end: start + filesize}
+
+		kind, ok := cpioTypes[values["mode"]&0170000]
+		if !ok {
+			kind = fmt.Sprintf("mode %06o", values["mode"])
+		}
+		value := fmt.Sprintf("%s, %d bytes", kind, filesize)
+		if string(b[:6]) == "070702" {
+			// the crc format stores the sum of the data bytes
+			sum, err := cpioSum(r, start, filesize)
+			if err != nil {
+				return nodes, err
+			}
+			if sum == uint32(values["check"]) {
+				value += ", checksum ok"
+			} else {
+				value += ", checksum bad"
+				fields[len(fields)-1].fix = []byte(fmt.Sprintf("%08X", sum))
+			}
+		}
+		if name == cpioTrailer {
+			value = "end of archive"
+		}
+		nodes = append(nodes, &node{
+			name:     fmt.Sprintf("[%d] %s", i, name),
+			value:    value,
+			start:    pos,
+			end:      data.end,
+			children: []*node{header, nameNode, data},
+		})
+		pos = (start + filesize + 3) &^ 3
+
+		if name == cpioTrailer {
+			// another archive may follow, after padding with zeros
+			next := pos
+			for ; next < size; next++ {
+				c := make([]byte, 1)
+				if _, err := r.ReadAt(c, next); err != nil || c[0] != 0 {
+					break
+				}
+			}
+			if next > pos {
+				nodes = append(nodes, &node{name: "Padding", value: fmt.Sprintf("%d bytes", next-pos), start: pos, end: next})
+			}
+			pos = next
+		}
+	}
+	if pos < size {
+		nodes = append(nodes, &node{name: "Trailing data", value: fmt.Sprintf("%d bytes", size-pos), start: pos, end: size})
+	}
+	return nodes, nil
+}
+
+// cpioSum returns the sum of n bytes at offset
+func cpioSum(r io.ReaderAt, offset, n int64) (uint32, error) {
+	var sum uint32
+	b := make([]byte, 64<<10)
+	for n > 0 {
+		chunk := b[:min64(n, int64(len(b)))]
+		if _, err := r.ReadAt(chunk, offset); err != nil {
+			return 0, err
+		}
+		for _, c := range chunk {
+			sum += uint32(c)
+		}
+		offset += int64(len(chunk))
+		n -= int64(len(chunk))
+	}
+	return sum, nil
+}
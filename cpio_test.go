@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// cpioTestFile returns a newc archive of a file and the trailer
+func cpioTestFile() []byte {
+	var b []byte
+	member := func(name string, mode int, data string) {
+		b = append(b, fmt.Sprintf("070701%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X",
+			1, mode, 0, 0, 1, 0, len(data), 0, 0, 0, 0, len(name)+1, 0)...)
+		b = append(b, name+"\x00"...)
+		for len(b)%4 != 0 {
+			b = append(b, 0)
+		}
+		b = append(b, data...)
+		for len(b)%4 != 0 {
+			b = append(b, 0)
+		}
+	}
+	member("hello.txt", 0100644, "hello")
+	member(cpioTrailer, 0, "")
+	return b
+}
+
+func TestCPIO(t *testing.T) {
+	nodes := parseValid(t, parseCPIO, cpioTestFile())
+	if len(nodes) != 2 || findNode(nodes[0].children, "data") == nil {
+		t.Fatalf("decoded %d members", len(nodes))
+	}
+}
+
+func TestCPIOTruncated(t *testing.T) {
+	parseTruncated(t, parseCPIO, cpioTestFile())
+}
+
+func TestCPIOCorrupt(t *testing.T) {
+	parseCorrupt(t, parseCPIO, cpioTestFile())
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell"
+	"golang.org/x/arch/arm/armasm"
+	"golang.org/x/arch/arm64/arm64asm"
+	"golang.org/x/arch/x86/x86asm"
+)
+
+// this file contains the disassembly panel, which decodes machine code
+// starting at the cursor or selection
+
+type disasmPanel struct {
+	a      *editorArea
+	mode   int // index into disasmModes
+	syntax int // index into syntaxes of current mode
+	row    int // selected instruction
+}
+
+type disasmInst struct {
+	offset int64 // file offset of first byte of instruction
+	size   int
+	text   string
+	target int64 // file offset of branch target, or -1 if there is none
+}
+
+type disasmMode struct {
+	name     string
+	syntaxes []string
+	decode   func(b []byte, pc uint64, syntax string) disasmInst
+}
+
+var disasmModes = []disasmMode{
+	{"x86-16", []string{"intel", "att", "go"}, x86Decoder(16)},
+	{"x86-32", []string{"intel", "att", "go"}, x86Decoder(32)},
+	{"x86-64", []string{"intel", "att", "go"}, x86Decoder(64)},
+	{"arm", []string{"gnu", "go"}, armDecoder},
+	{"arm64", []string{"gnu", "go"}, arm64Decoder},
+}
+
+// noSymbols is a symbol lookup function which never finds a symbol
+func noSymbols(uint64) (string, uint64) {
+	return "", 0
+}
+
+// x86Decoder returns a decoder for x86 instructions in 16, 32 or 64-bit mode
+func x86Decoder(bits int) func(b []byte, pc uint64, syntax string) disasmInst {
+	return func(b []byte, pc uint64, syntax string) disasmInst {
+		inst, err := x86asm.Decode(b, bits)
+		if err != nil {
+			return disasmInst{size: 1, text: "(bad)", target: -1}
+		}
+		d := disasmInst{size: inst.Len, target: -1}
+		switch syntax {
+		case "att":
+			d.text = x86asm.GNUSyntax(inst, pc, noSymbols)
+		case "go":
+			d.text = x86asm.GoSyntax(inst, pc, noSymbols)
+		default:
+			d.text = x86asm.IntelSyntax(inst, pc, noSymbols)
+		}
+		for _, arg := range inst.Args {
+			if rel, ok := arg.(x86asm.Rel); ok {
+				// relative to end of instruction
+				d.target = int64(pc) + int64(inst.Len) + int64(rel)
+			}
+		}
+		return d
+	}
+}
+
+// armDecoder decodes 32-bit ARM (A32) instructions
+func armDecoder(b []byte, pc uint64, syntax string) disasmInst {
+	inst, err := armasm.Decode(b, armasm.ModeARM)
+	if err != nil {
+		return disasmInst{size: 4, text: "(bad)", target: -1}
+	}
+	d := disasmInst{size: inst.Len, target: -1}
+	switch syntax {
+	case "go":
+		d.text = armasm.GoSyntax(inst, pc, noSymbols, nil)
+	default:
+		d.text = armasm.GNUSyntax(inst)
+	}
+	for _, arg := range inst.Args {
+		if rel, ok := arg.(armasm.PCRel); ok {
+			// relative to current instruction + 8
+			d.target = int64(pc) + 8 + int64(rel)
+		}
+	}
+	return d
+}
+
+// arm64Decoder decodes 64-bit ARM (A64) instructions
+func arm64Decoder(b []byte, pc uint64, syntax string) disasmInst {
+	inst, err := arm64asm.Decode(b)
+	if err != nil {
+		return disasmInst{size: 4, text: "(bad)", target: -1}
+	}
+	d := disasmInst{size: 4, target: -1}
+	switch syntax {
+	case "go":
+		d.text = arm64asm.GoSyntax(inst, pc, noSymbols, nil)
+	default:
+		d.text = arm64asm.GNUSyntax(inst)
+	}
+	for _, arg := range inst.Args {
+		if rel, ok := arg.(arm64asm.PCRel); ok {
+			if inst.Op == arm64asm.ADRP {
+				// relative to current 4 KiB page
+				d.target = int64(pc&^0xFFF) + int64(rel)
+			} else {
+				d.target = int64(pc) + int64(rel)
+			}
+		}
+	}
+	return d
+}
+
+// insts decodes up to n instructions starting at the cursor or selection
+func (p *disasmPanel) insts(n int) []disasmInst {
+	offset := p.a.cursor()
+	if start, _, ok := p.a.selection(); ok {
+		offset = start
+	}
+
+	// instructions are at most 15 bytes long
+	b := p.a.readAt(offset, n*15)
+	insts := make([]disasmInst, 0, n)
+	for i := 0; i < len(b) && len(insts) < n; {
+		inst := disasmModes[p.mode].decode(b[i:], uint64(offset)+uint64(i), p.syntaxName())
+		inst.offset = offset + int64(i)
+		inst.size = min(inst.size, len(b)-i)
+		insts = append(insts, inst)
+		i += inst.size
+	}
+	return insts
+}
+
+func (p *disasmPanel) syntaxName() string {
+	syntaxes := disasmModes[p.mode].syntaxes
+	return syntaxes[p.syntax%len(syntaxes)]
+}
+
+func (p *disasmPanel) title() string {
+	return fmt.Sprintf("Disassembly (%s, %s)", disasmModes[p.mode].name, p.syntaxName())
+}
+
+func (p *disasmPanel) draw(o obj, focused bool) {
+	insts := p.insts(o.h)
+	p.row = min(p.row, max(len(insts)-1, 0))
+	for i := 0; i < o.h; i++ {
+		if i >= len(insts) {
+			drawRow(o, i, "", false)
+			continue
+		}
+		text := fmt.Sprintf("%08X  %s", insts[i].offset, insts[i].text)
+		if insts[i].target >= 0 {
+			text += fmt.Sprintf(" -> %08X", insts[i].target)
+		}
+		drawRow(o, i, text, focused && i == p.row)
+	}
+}
+
+// highlight returns the range of the selected instruction
+func (p *disasmPanel) highlight() (int64, int64, bool) {
+	insts := p.insts(p.row + 1)
+	if p.row >= len(insts) {
+		return 0, 0, false
+	}
+	return insts[p.row].offset, insts[p.row].offset + int64(insts[p.row].size), true
+}
+
+func (p *disasmPanel) onEvent(ev tcell.Event) error {
+	switch v := ev.(type) {
+	case *tcell.EventKey:
+		switch v.Key() {
+		case tcell.KeyUp:
+			// select previous instruction
+			p.row = max(p.row-1, 0)
+		case tcell.KeyDown:
+			// select next instruction
+			p.row = min(p.row+1, p.a.panels.rect().h-2)
+		case tcell.KeyEnter:
+			// jump to branch target of selected instruction
+			insts := p.insts(p.row + 1)
+			if p.row < len(insts) && insts[p.row].target >= 0 {
+				target := insts[p.row].target
+				p.row = 0
+				return p.a.jump(target)
+			}
+		case tcell.KeyRune:
+			switch v.Rune() {
+			case 'm':
+				// cycle through modes
+				p.mode = (p.mode + 1) % len(disasmModes)
+				p.syntax = 0
+			case 's':
+				// cycle through syntaxes
+				p.syntax = (p.syntax + 1) % len(disasmModes[p.mode].syntaxes)
+			}
+		}
+	}
+	return nil
+}
@@ -1,21 +1,48 @@
 package main
 
 import (
-	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/gdamore/tcell"
 )
 
 type editorArea struct {
-	file         *os.File    // current file being edited
-	fileStat     os.FileInfo // stat of file
-	offset       int64       // byte offset of file to display
-	cursorOffset int         // relative to offset
-	buffer       []byte      // bytes currently in view, loaded from file at offset
+	file         *os.File                // current file being edited
+	fileStat     os.FileInfo             // stat of file
+	offset       int64                   // byte offset of file to display
+	cursorOffset int                     // relative to offset
+	mark         int64                   // file offset where selection starts, or -1 if nothing is selected
+	buffer       []byte                  // bytes currently in view, loaded from file at offset
+	panels       panels                  // side panels shown next to the hex data view
+	history      []edit                  // edits made to file, most recent last
+	addrs        addrMap                 // virtual addresses of executable files, nil otherwise
+	symbols      symbolTable             // symbols of executable files, nil otherwise
+	structure    func() ([]*node, error) // decodes the structure shown in the structure panel
+	units        []unit                  // numbered blocks of the file format, such as pages
+	fileType     string                  // type of the data identified by its magic number, if known
+	scan         *scan                   // scan for embedded files shown in the structure panel, or nil
+}
+
+// edit is a change made to the file which can be undone
+type edit struct {
+	offset int64
+	old    []byte // bytes at offset before the change
+	joined bool   // undone together with the previous edit
+}
+
+// deviceStat is the stat of a block device, with its size
+type deviceStat struct {
+	os.FileInfo
+	size int64
+}
+
+func (s deviceStat) Size() int64 {
+	return s.size
 }
 
 // general editor methods
@@ -28,6 +55,17 @@ func (a *editorArea) init() (err error) {
 	if a.fileStat, err = a.file.Stat(); err != nil {
 		return
 	}
+	if a.fileStat.Mode()&os.ModeDevice != 0 {
+		// block devices have a size of zero, but can seek to their end
+		var size int64
+		if size, err = a.file.Seek(0, io.SeekEnd); err != nil {
+			return
+		}
+		a.fileStat = deviceStat{a.fileStat, size}
+	}
+
+	// clear selection
+	a.mark = -1
 
 	// initialize buffer
 	a.buffer = make([]byte, a.bufferSize())
@@ -35,6 +73,23 @@ func (a *editorArea) init() (err error) {
 		return
 	}
 
+	// load virtual addresses before the offset column width is needed
+	a.addrs = loadAddrMap(a.file)
+	a.symbols = loadSymbols(a.file, a.addrs)
+
+	// initialize panels
+	a.panels.a = a
+	a.panels.all = map[string]panel{
+		"inspector": &inspectorPanel{a: a},
+		"disasm":    &disasmPanel{a: a, mode: 2},
+		"tree":      &treePanel{a: a},
+	}
+
+	// identify file type and decode file if its format is known
+	if err := a.detectType(0); err != nil {
+		app.message = err.Error()
+	}
+
 	return
 }
 
@@ -50,11 +105,132 @@ func (a *editorArea) onEvent(ev tcell.Event) error {
 		app.term.hideCursor()
 		a.drawStatic()
 		a.drawDynamic()
+		a.panels.draw()
 		app.term.setCursor(a.bufferOffsetPos(a.cursorOffset))
 		app.term.showCursor()
 
+	case *scanEvent:
+		// show hits found by the scan, unless it was cancelled or replaced
+		s := v.s
+		if s != a.scan || s.cancelled() {
+			return nil
+		}
+		err := s.update()
+		p := a.panels.all["tree"].(*treePanel)
+		p.name = s.title()
+		p.update(s.hits)
+		if err != nil {
+			app.message = err.Error()
+		}
+		a.redraw()
+
 	case *tcell.EventKey:
-		var cursorChanged, pageChanged bool
+		// clear message shown since last key press
+		if app.message != "" {
+			app.message = ""
+			a.redraw()
+		}
+
+		var cursorChanged, pageChanged, panelChanged bool
+		switch v.Key() {
+		case tcell.KeyCtrlZ:
+			// undo last edit
+			if err := a.undo(); err != nil {
+				app.message = err.Error()
+				a.redraw()
+			}
+			return nil
+		case tcell.KeyF2:
+			// toggle data inspector
+			a.panels.toggle("inspector")
+			panelChanged = true
+		case tcell.KeyF3:
+			// toggle disassembly
+			a.panels.toggle("disasm")
+			panelChanged = true
+		case tcell.KeyF4:
+			// toggle structure tree
+			a.panels.toggle("tree")
+			panelChanged = true
+		case tcell.KeyCtrlT:
+			// apply template, or decode data in a built-in format, at cursor
+			offset := a.cursor()
+			return app.prompt("Template file or format: ", "", func(name string) error {
+				if f := findFormat(name); f != nil {
+					return a.applyFormat(f, offset)
+				}
+				return a.applyTemplate(name, offset)
+			})
+		case tcell.KeyCtrlD:
+			// decode selection, or bytes from cursor to end of file
+			start, end, ok := a.selection()
+			if !ok {
+				start, end = a.cursor(), a.fileStat.Size()
+			}
+			return app.promptCompleted("Decode selection as: ", "", completeDecoder, func(s string) error {
+				return a.applyDecoder(s, start, end)
+			})
+		case tcell.KeyCtrlE:
+			// identify data at cursor, such as a file embedded in another
+			offset := a.cursor()
+			if identify(a.readAt(offset, formatHeadSize)) == nil {
+				app.message = fmt.Sprintf("unknown data at %08X", offset)
+			} else if err := a.detectType(offset); err != nil {
+				app.message = err.Error()
+			}
+			a.redraw()
+			return nil
+		case tcell.KeyCtrlB:
+			// scan file for embedded files in the background, or cancel the scan
+			if a.scan != nil && !a.scan.finished {
+				a.scan.stop()
+				a.panels.all["tree"].(*treePanel).name = a.scan.title()
+			} else {
+				a.scanFile()
+			}
+			a.redraw()
+			return nil
+		case tcell.KeyCtrlG:
+			// go to file offset, virtual address, unit or symbol
+			label := "Go to offset, va:address"
+			if arch := a.addrs.arch(a.cursor()); arch != "" {
+				label += " of " + arch
+			}
+			for _, u := range a.units {
+				label += ", " + u.name + ":number"
+			}
+			return app.promptCompleted(label+" or symbol: ", "", a.symbols.complete, a.gotoLocation)
+		case tcell.KeyTab:
+			// move focus between hex data view and panel
+			a.panels.focused = !a.panels.focused && a.panels.current != nil
+			panelChanged = true
+		}
+
+		// redraw everything if panel was shown, hidden or (un)focused
+		if panelChanged {
+			a.redraw()
+			return nil
+		}
+
+		// pass event to panel if focused
+		if a.panels.focused {
+			if err := a.panels.current.onEvent(ev); err != nil {
+				return err
+			}
+
+			// panel may have moved focus to another area
+			if app.areas.current != area(a) {
+				return nil
+			}
+			a.drawDynamic()
+			a.drawStatus()
+			a.panels.draw()
+			app.term.setCursor(a.bufferOffsetPos(a.cursorOffset))
+			app.term.showCursor()
+			return nil
+		}
+
+		prev := a.cursor()
 		switch v.Key() {
 		case tcell.KeyLeft:
 			// move one byte back
@@ -90,6 +266,17 @@ func (a *editorArea) onEvent(ev tcell.Event) error {
 			cursorChanged = true
 		}
 
+		// extend selection while shift is held, otherwise clear it
+		selectionChanged := a.mark >= 0
+		if cursorChanged && v.Modifiers()&tcell.ModShift != 0 {
+			if a.mark < 0 {
+				a.mark = prev
+			}
+			selectionChanged = true
+		} else if cursorChanged {
+			a.mark = -1
+		}
+
 		// handle cursor overflow/underflow
 		if cursorChanged {
 			// correct for cursor underflow
@@ -149,10 +336,16 @@ func (a *editorArea) onEvent(ev tcell.Event) error {
 			// redraw dynamic content
 			a.clearDynamic()
 			a.drawDynamic()
+		} else if cursorChanged && selectionChanged {
+			// redraw selection
+			a.drawDynamic()
 		}
 
 		// reposition cursor
 		if cursorChanged || pageChanged {
+			a.panels.follow(a.cursor())
+			a.panels.draw()
+			a.drawStatus()
 			app.term.setCursor(a.bufferOffsetPos(a.cursorOffset))
 			app.term.showCursor()
 		}
@@ -170,6 +363,7 @@ func (a *editorArea) onFocus() error {
 	app.term.hideCursor()
 	a.drawStatic()
 	a.drawDynamic()
+	a.panels.draw()
 	app.term.setCursor(a.bufferOffsetPos(a.cursorOffset))
 	app.term.showCursor()
 	return nil
@@ -198,6 +392,303 @@ func (a *editorArea) load() error {
 	return nil
 }
 
+// write writes b to the file at offset, keeping the previous contents for undo
+func (a *editorArea) write(offset int64, b []byte) error {
+	if err := a.writeAt(offset, b, false); err != nil {
+		return err
+	}
+	return a.reload()
+}
+
+// writeFixes writes the fixes of nodes, which are undone as a single edit
+func (a *editorArea) writeFixes(nodes []*node) error {
+	for _, n := range nodes {
+		if n.start < 0 || n.start+int64(len(n.fix)) > a.fileStat.Size() {
+			return fmt.Errorf("cannot fix %s past end of file", n.name)
+		}
+	}
+	for i, n := range nodes {
+		if err := a.writeAt(n.start, n.fix, i > 0); err != nil {
+			// fixes written so far can still be undone
+			a.reload()
+			return err
+		}
+	}
+	return a.reload()
+}
+
+// writeAt writes b to the file at offset, adding the edit to the history
+func (a *editorArea) writeAt(offset int64, b []byte, joined bool) error {
+	if offset < 0 || offset+int64(len(b)) > a.fileStat.Size() {
+		return fmt.Errorf("cannot write %d bytes past end of file", offset+int64(len(b))-a.fileStat.Size())
+	}
+	old := a.readAt(offset, len(b))
+	if _, err := a.file.WriteAt(b, offset); err != nil {
+		return err
+	}
+	a.history = append(a.history, edit{offset, old, joined})
+	return nil
+}
+
+// reload shows the file contents after they changed
+func (a *editorArea) reload() error {
+	if err := a.load(); err != nil {
+		return err
+	}
+	a.refreshStructure()
+	a.redraw()
+	return nil
+}
+
+// extract copies the bytes from start to end to a new file
+func (a *editorArea) extract(start, end int64, filename string) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, io.NewSectionReader(a.file, start, end-start)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	app.message = fmt.Sprintf("extracted %d bytes to %s", end-start, filename)
+	return nil
+}
+
+// undo reverts the most recent edit, and the edits joined to it
+func (a *editorArea) undo() error {
+	if len(a.history) == 0 {
+		return nil
+	}
+	for len(a.history) > 0 {
+		// keep the edit if it cannot be reverted, so undo can be tried again
+		e := a.history[len(a.history)-1]
+		if _, err := a.file.WriteAt(e.old, e.offset); err != nil {
+			a.reload()
+			return err
+		}
+		a.history = a.history[:len(a.history)-1]
+		if !e.joined {
+			break
+		}
+	}
+	return a.reload()
+}
+
+// jump moves the cursor to offset, loading the page containing it
+func (a *editorArea) jump(offset int64) error {
+	page := int64(cap(a.buffer))
+	if page == 0 {
+		return nil
+	}
+	offset = max64(0, min64(offset, a.fileStat.Size()))
+
+	// set page and cursor offset
+	a.offset = offset - offset%page
+	if a.offset == offset && offset == a.fileStat.Size() && offset > 0 {
+		// show end of file on last page
+		a.offset -= page
+	}
+	a.cursorOffset = int(offset - a.offset)
+	a.mark = -1
+	a.panels.follow(offset)
+
+	// reload buffer
+	if err := a.load(); err != nil {
+		return err
+	}
+	a.redraw()
+	return nil
+}
+
+// gotoLocation jumps to a file offset, a virtual address prefixed with "va:",
+// a unit of the file format such as "page:3", or a symbol, optionally
+// followed by "+offset"
+func (a *editorArea) gotoLocation(s string) error {
+	s = strings.TrimSpace(s)
+	for _, u := range a.units {
+		if strings.HasPrefix(s, u.name+":") {
+			n, err := strconv.ParseInt(strings.TrimSpace(s[len(u.name)+1:]), 0, 64)
+			if err != nil || n < u.first {
+				return fmt.Errorf("invalid %s number \"%s\"", u.name, s[len(u.name)+1:])
+			}
+			return a.jump(u.offset(n))
+		}
+	}
+	if strings.HasPrefix(s, "va:") {
+		addr, err := strconv.ParseUint(strings.TrimSpace(s[3:]), 0, 64)
+		if err != nil {
+			return fmt.Errorf("invalid address \"%s\"", s[3:])
+		}
+		// universal files map addresses of the architecture at the cursor
+		offset, ok := a.addrs.only(a.addrs.arch(a.cursor())).offset(addr)
+		if !ok {
+			return fmt.Errorf("address 0x%X is not mapped to the file", addr)
+		}
+		return a.jump(offset)
+	}
+	if offset, err := strconv.ParseInt(s, 0, 64); err == nil && offset >= 0 {
+		return a.jump(offset)
+	}
+	name, delta := s, int64(0)
+	if i := strings.LastIndex(s, "+"); i > 0 {
+		if d, err := strconv.ParseInt(s[i+1:], 0, 64); err == nil {
+			name, delta = s[:i], d
+		}
+	}
+	if sym, ok := a.symbols.find(name); ok {
+		return a.jump(sym.offset + delta)
+	}
+	return fmt.Errorf("invalid offset or unknown symbol \"%s\"", s)
+}
+
+// applyTemplate decodes a structure template at offset and shows it in the structure panel
+func (a *editorArea) applyTemplate(filename string, offset int64) error {
+	t, err := loadTemplate(filename)
+	if err != nil {
+		return err
+	}
+	a.setStructure(func() ([]*node, error) {
+		return t.apply(a.file, a.fileStat.Size(), offset)
+	})
+	nodes, err := a.structure()
+	a.panels.all["tree"].(*treePanel).show(filepath.Base(filename), nodes)
+	a.panels.show("tree")
+	return err
+}
+
+// detectType identifies the data at offset by its magic number, showing its
+// type in the header and decoding it if there is a built-in format for it
+func (a *editorArea) detectType(offset int64) error {
+	m := identify(a.readAt(offset, formatHeadSize))
+	if m == nil {
+		return nil
+	}
+	a.fileType = m.name
+	if offset > 0 {
+		a.fileType = fmt.Sprintf("%s at %X", m.name, offset)
+	}
+	if f := findFormat(m.format); f != nil {
+		return a.applyFormat(f, offset)
+	}
+	return nil
+}
+
+// applyFormat decodes the file from offset in a built-in format and shows it
+// in the structure panel
+func (a *editorArea) applyFormat(f *format, offset int64) error {
+	size := a.fileStat.Size() - offset
+	r := io.NewSectionReader(a.file, offset, size)
+	a.setStructure(func() ([]*node, error) {
+		nodes, err := f.parse(r, size)
+		for _, n := range nodes {
+			shiftNode(n, offset)
+		}
+		return nodes, err
+	})
+	a.units = nil
+	if f.units != nil {
+		a.units = f.units(r, size)
+		for i := range a.units {
+			a.units[i].base += offset
+		}
+	}
+	nodes, err := a.structure()
+	a.panels.all["tree"].(*treePanel).show(f.name, nodes)
+	a.panels.show("tree")
+	return err
+}
+
+// scanFile searches the whole file for embedded files in the background,
+// showing them in the structure panel as they are found
+func (a *editorArea) scanFile() {
+	s := startScan(a.file, a.fileStat.Size())
+	a.setStructure(func() ([]*node, error) {
+		return s.hits, nil
+	})
+	a.scan = s
+	a.units = nil
+	a.panels.all["tree"].(*treePanel).show(s.title(), nil)
+	a.panels.show("tree")
+}
+
+// setStructure sets the function decoding the structure shown in the
+// structure panel, stopping a scan shown there before
+func (a *editorArea) setStructure(f func() ([]*node, error)) {
+	if a.scan != nil {
+		a.scan.stop()
+		a.scan = nil
+	}
+	a.structure = func() (nodes []*node, err error) {
+		// parsers of corrupt data may panic, which must not close the editor
+		defer func() {
+			if v := recover(); v != nil {
+				nodes, err = nil, fmt.Errorf("decoding failed: %v", v)
+			}
+		}()
+		return f()
+	}
+}
+
+// applyDecoder decodes bytes from start to end with the decoder named by the
+// first word of s, passing the other words as arguments
+func (a *editorArea) applyDecoder(s string, start, end int64) error {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return nil
+	}
+	d := findDecoder(words[0])
+	if d == nil {
+		return fmt.Errorf("unknown decoder \"%s\"", words[0])
+	}
+	end = min64(end, start+decoderMaxSize)
+	a.setStructure(func() ([]*node, error) {
+		return d.decode(a.readAt(start, int(end-start)), start, words[1:])
+	})
+	nodes, err := a.structure()
+	a.panels.all["tree"].(*treePanel).show(d.name, nodes)
+	a.panels.show("tree")
+	return err
+}
+
+// refreshStructure decodes the structure shown in the structure panel again after the file changed
+func (a *editorArea) refreshStructure() {
+	if a.structure == nil {
+		return
+	}
+	nodes, err := a.structure()
+	a.panels.all["tree"].(*treePanel).update(nodes)
+	if err != nil {
+		app.message = err.Error()
+	}
+}
+
+// readAt reads up to n bytes from the file at offset
+func (a *editorArea) readAt(offset int64, n int) []byte {
+	b := make([]byte, n)
+	n, err := a.file.ReadAt(b, offset)
+	if err != nil && err != io.EOF {
+		return nil
+	}
+	return b[:n]
+}
+
+// cursor returns the file offset of the cursor
+func (a *editorArea) cursor() int64 {
+	return a.offset + int64(a.cursorOffset)
+}
+
+// selection returns the range of selected bytes, including the byte at the cursor
+func (a *editorArea) selection() (start, end int64, ok bool) {
+	if a.mark < 0 {
+		return 0, 0, false
+	}
+	start, end = min64(a.mark, a.cursor()), max64(a.mark, a.cursor())+1
+	return start, min64(end, a.fileStat.Size()), true
+}
+
 // encode converts bytes from UTF-8 to the editor encoding defined in flags
 func (a *editorArea) encode(in []byte) ([]byte, error) {
 	cm, err := getCharmap(app.flags.Encoding)
@@ -231,8 +722,7 @@ func (a *editorArea) decode(in []byte) ([]byte, error) {
 }
 
 func (a *editorArea) printableBytesPerRow() int64 {
-	const offset = len("Offset(x)")
-	base := app.term.w - offset
+	base := app.term.w - a.offsetWidth() + 1
 	charsPerGroup := app.flags.Group*2 + 1
 	maxBytesPerRow := (base / charsPerGroup) * app.flags.Group
 	return int64(min(app.flags.BytesPerRow, maxBytesPerRow))
@@ -253,11 +743,35 @@ func (a *editorArea) bufferSize() int64 {
 func (a *editorArea) bufferOffsetPos(bufferOffset int) pos {
 	row := bufferOffset / app.flags.BytesPerRow
 	if bufferOffset == len(a.buffer) && bufferOffset%app.flags.BytesPerRow == 0 {
-		return pos{9 + app.flags.BytesPerRow*2 + app.flags.BytesPerRow/app.flags.Group, 1 + row}
+		return pos{a.offsetWidth() - 1 + app.flags.BytesPerRow*2 + app.flags.BytesPerRow/app.flags.Group, 1 + row}
 	}
 	rowByte := bufferOffset - row*app.flags.BytesPerRow
 	col := rowByte*2 + rowByte/app.flags.Group
-	return pos{10 + col, 2 + row}
+	return pos{a.offsetWidth() + col, 2 + row}
+}
+
+// showAddrs returns whether the offset column shows virtual addresses
+func (a *editorArea) showAddrs() bool {
+	return app.flags.VirtualAddresses && len(a.addrs) > 0
+}
+
+// offsetWidth returns the width of the offset column, including its padding
+func (a *editorArea) offsetWidth() int {
+	if !a.showAddrs() {
+		return 10
+	}
+	return max(8, len(formatOffset(a.addrs.maxAddr(), 0))) + 2
+}
+
+// formatOffset formats an offset or address in the base defined in flags, padded to width digits
+func formatOffset(v uint64, width int) string {
+	switch app.flags.OffsetBase {
+	case "dec":
+		return fmt.Sprintf("%0*d", width, v)
+	case "oct":
+		return fmt.Sprintf("%0*o", width, v)
+	}
+	return fmt.Sprintf("%0*X", width, v)
 }
 
 // drawing methods
@@ -277,10 +791,13 @@ func (a *editorArea) drawStatic() {
 	app.term.writeOverflow("  hxe ")
 	app.term.writeOverflow(version)
 
-	// draw file info
-	headerPadding := (app.term.w - app.term.x - 2) / 2
+	// draw file info and type, left of the status
+	headerPadding := max(0, (app.term.w-a.statusWidth()-app.term.x-2)/2)
 	app.term.writeOverflow(strings.Repeat(" ", headerPadding))
 	app.term.writeOverflow(a.fileStat.Name())
+	if a.fileType != "" {
+		app.term.writeOverflow(" (" + a.fileType + ")")
+	}
 	app.term.writeOverflow(strings.Repeat(" ", headerPadding))
 
 	// draw background for rest of row
@@ -288,6 +805,8 @@ func (a *editorArea) drawStatic() {
 		app.term.writeOverflow(" ")
 	}
 
+	a.drawStatus()
+
 	// set new foreground and background
 	app.term.style = app.term.style.Foreground(tcell.ColorBlack).Background(tcell.ColorBlue)
 	app.term.screen.SetStyle(app.term.style)
@@ -298,6 +817,16 @@ func (a *editorArea) drawStatic() {
 		app.term.setCursor(pos{0, app.term.h - 1})
 
 		// draw keys
+		a.drawKey("F2", "Inspect")
+		a.drawKey("F3", "Disasm")
+		a.drawKey("F4", "Struct")
+		a.drawKey("^T", "Template")
+		a.drawKey("^D", "Decode")
+		a.drawKey("^E", "Identify")
+		a.drawKey("^B", "Scan")
+		a.drawKey("^G", "Goto")
+		a.drawKey("Tab", "Panel")
+		a.drawKey("^Z", "Undo")
 		a.drawKey("F10", "Quit")
 
 		// draw background for rest of row
@@ -306,6 +835,14 @@ func (a *editorArea) drawStatic() {
 		}
 	}
 
+	// draw message over key reference
+	if app.message != "" {
+		app.term.style = app.term.style.Foreground(tcell.ColorWhite).Background(tcell.ColorRed)
+		app.term.setCursor(pos{0, app.term.h - 1})
+		app.term.writeFixed(app.message, app.term.w)
+		app.term.style = app.term.style.Foreground(tcell.ColorBlack).Background(tcell.ColorBlue)
+	}
+
 	// draw hex data view
 	if app.flags.Columns["hex"] {
 		// reset cursor position
@@ -315,13 +852,13 @@ func (a *editorArea) drawStatic() {
 		switch app.flags.OffsetBase {
 		case "hex":
 			pad = 1 + (app.flags.BytesPerRow-(app.flags.BytesPerRow%0xFF))/0xFF
-			app.term.writeOverflow(strings.Repeat("\n", pad) + "Offset(h) ")
+			app.term.writeOverflow(strings.Repeat("\n", pad) + a.offsetLabel("h"))
 		case "dec":
 			pad = 1 + (app.flags.BytesPerRow-(app.flags.BytesPerRow%99))/99
-			app.term.writeOverflow(strings.Repeat("\n", pad) + "Offset(d) ")
+			app.term.writeOverflow(strings.Repeat("\n", pad) + a.offsetLabel("d"))
 		case "oct":
 			pad = 1 + (app.flags.BytesPerRow-(app.flags.BytesPerRow%077))/077
-			app.term.writeOverflow(strings.Repeat("\n", pad) + "Offset(o) ")
+			app.term.writeOverflow(strings.Repeat("\n", pad) + a.offsetLabel("o"))
 		}
 
 		// draw offsets
@@ -403,7 +940,7 @@ func (a *editorArea) drawDynamic() {
 		// draw hex data view
 		if app.flags.Columns["hex"] {
 			a.drawOffset(a.offset + int64(offset))
-			a.drawBytes(a.buffer[offset:min(offset+app.flags.BytesPerRow, len(a.buffer))])
+			a.drawBytes(a.offset+int64(offset), a.buffer[offset:min(offset+app.flags.BytesPerRow, len(a.buffer))])
 
 			// draw separator for text column
 			if app.flags.Columns["text"] {
@@ -421,6 +958,17 @@ func (a *editorArea) drawDynamic() {
 	}
 }
 
+// redraw draws all content of the editor area
+func (a *editorArea) redraw() {
+	app.term.hideCursor()
+	a.drawStatic()
+	a.clearDynamic()
+	a.drawDynamic()
+	a.panels.draw()
+	app.term.setCursor(a.bufferOffsetPos(a.cursorOffset))
+	app.term.showCursor()
+}
+
 func (a *editorArea) clearDynamic() {
 	// empty dynamic area
 	for i := 2; i < app.term.h-1; i++ {
@@ -448,7 +996,59 @@ func (a *editorArea) drawKey(key, desc string) {
 	app.term.writeOverflow(desc + " ")
 }
 
+// drawStatus draws the symbol and virtual address of the cursor at the end of
+// the header, or its file offset if the offset column shows virtual addresses
+func (a *editorArea) drawStatus() {
+	if a.statusWidth() == 0 {
+		return
+	}
+	var status []string
+	if sym := a.symbols.describe(a.cursor()); sym != "" {
+		status = append(status, sym)
+	}
+	if a.showAddrs() {
+		status = append(status, fmt.Sprintf("offset 0x%X", a.cursor()))
+	} else if addr, ok := a.addrs.addr(a.cursor()); ok {
+		status = append(status, fmt.Sprintf("VA 0x%X", addr))
+	}
+
+	w := a.statusWidth() - 2
+	style := app.term.style
+	app.term.style = app.term.style.Foreground(tcell.ColorBlack).Background(tcell.ColorWhite)
+	app.term.setCursor(pos{app.term.w - w - 2, 0})
+	app.term.writeFixed(fmt.Sprintf("%*s  ", w, strings.Join(status, "  ")), w+2)
+	app.term.style = style
+}
+
+// statusWidth returns the width of the status in the header, keeping the
+// left half of the header for the file name
+func (a *editorArea) statusWidth() int {
+	if len(a.addrs) == 0 && len(a.symbols) == 0 {
+		return 0
+	}
+	return min(56, app.term.w/2-8) + 2
+}
+
+// offsetLabel returns the header of the offset column for a base suffix
+func (a *editorArea) offsetLabel(suffix string) string {
+	label := "Offset(" + suffix + ")"
+	if a.showAddrs() {
+		label = "VA(" + suffix + ")"
+	}
+	return fmt.Sprintf("%-*s", a.offsetWidth(), label)
+}
+
 func (a *editorArea) drawOffset(offset int64) {
+	if app.flags.Columns["hex"] && a.showAddrs() {
+		// rows starting outside of segments have no address
+		digits := a.offsetWidth() - 2
+		if addr, ok := a.addrs.addr(offset); ok {
+			app.term.writeOverflow(formatOffset(addr, digits) + "  ")
+		} else {
+			app.term.writeOverflow(strings.Repeat("-", digits) + "  ")
+		}
+		return
+	}
 	if app.flags.Columns["hex"] {
 		switch app.flags.OffsetBase {
 		case "hex":
@@ -461,10 +1061,17 @@ func (a *editorArea) drawOffset(offset int64) {
 	}
 }
 
-func (a *editorArea) drawBytes(b []byte) {
+func (a *editorArea) drawBytes(offset int64, b []byte) {
+	style := app.term.style
+
 	// draw bytes in current row
 	for i := 0; i < len(b); i += app.flags.Group {
-		app.term.writeOverflow(strings.ToUpper(hex.EncodeToString(b[i:min(i+app.flags.Group, len(b))])) + " ")
+		for j := i; j < min(i+app.flags.Group, len(b)); j++ {
+			app.term.style = a.byteStyle(offset + int64(j))
+			app.term.writeOverflow(fmt.Sprintf("%02X", b[j]))
+		}
+		app.term.style = style
+		app.term.writeOverflow(" ")
 	}
 
 	// draw background for rest of row
@@ -473,6 +1080,20 @@ func (a *editorArea) drawBytes(b []byte) {
 	}
 }
 
+// byteStyle returns the style of the byte at offset in the hex data view
+func (a *editorArea) byteStyle(offset int64) tcell.Style {
+	if start, end, ok := a.selection(); ok && offset >= start && offset < end {
+		return app.term.style.Reverse(true)
+	}
+	if start, end, ok := a.panels.highlight(); ok && offset >= start && offset < end {
+		return app.term.style.Foreground(tcell.ColorBlack).Background(tcell.ColorYellow)
+	}
+	if c, ok := a.panels.color(offset); ok {
+		return app.term.style.Foreground(tcell.ColorBlack).Background(c)
+	}
+	return app.term.style
+}
+
 func (a *editorArea) drawText(b []byte) {
 	encoded := app.must(a.encode(b)).([]byte)
 	for _, c := range encoded {
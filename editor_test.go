@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gdamore/tcell"
+)
+
+// newTestEditor opens a file containing data in an editor drawn on a
+// simulation screen
+func newTestEditor(t *testing.T, data []byte) *editorArea {
+	dir, err := ioutil.TempDir("", "hxe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	filename := filepath.Join(dir, "data")
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	screen.SetSize(120, 24)
+	t.Cleanup(screen.Fini)
+	app = editor{areas: areas{all: map[string]area{}}}
+	app.term.screen = screen
+	app.term.reset()
+	app.flags = flags{
+		Columns:     map[string]bool{"hex": true, "text": true, "keys": true},
+		OffsetBase:  "hex",
+		Group:       1,
+		BytesPerRow: 16,
+		Encoding:    "utf8",
+		Filename:    filename,
+	}
+	a := &editorArea{}
+	if err := app.areas.add("editor", a); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.onClose() })
+	if err := app.areas.add("prompt", &promptArea{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.areas.focus("editor"); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// contents returns the contents of the edited file
+func contents(t *testing.T, a *editorArea) []byte {
+	b, err := ioutil.ReadFile(a.file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestUndoWriteError(t *testing.T) {
+	a := newTestEditor(t, []byte("abcd"))
+	if err := a.write(1, []byte("XY")); err != nil {
+		t.Fatal(err)
+	}
+
+	// undo fails on a file opened for reading only, keeping the edit
+	file := a.file
+	readOnly, err := os.Open(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readOnly.Close()
+	a.file = readOnly
+	if err := a.onEvent(tcell.NewEventKey(tcell.KeyCtrlZ, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if app.message == "" || len(a.history) != 1 {
+		t.Fatalf("failed undo shows %q with %d edits, want an error and 1 edit", app.message, len(a.history))
+	}
+
+	a.file = file
+	if err := a.onEvent(tcell.NewEventKey(tcell.KeyCtrlZ, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if b := contents(t, a); !bytes.Equal(b, []byte("abcd")) || len(a.history) != 0 {
+		t.Fatalf("undo left %q with %d edits", b, len(a.history))
+	}
+}
+
+func TestFixes(t *testing.T) {
+	a := newTestEditor(t, []byte("abcdef"))
+	p := a.panels.all["tree"].(*treePanel)
+	fix := func(nodes []*node) error {
+		p.show("test", []*node{{name: "root", start: 0, end: 6, children: nodes}})
+		a.panels.show("tree")
+		a.panels.focused = true
+		app.message = ""
+		return a.onEvent(tcell.NewEventKey(tcell.KeyRune, 'f', 0))
+	}
+
+	// fixes are undone together
+	if err := fix([]*node{
+		{name: "first", start: 0, end: 1, fix: []byte("A")},
+		{name: "last", start: 4, end: 6, fix: []byte("EF")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if b := contents(t, a); !bytes.Equal(b, []byte("AbcdEF")) {
+		t.Fatalf("fixed file contains %q", b)
+	}
+	if err := a.undo(); err != nil {
+		t.Fatal(err)
+	}
+	if b := contents(t, a); !bytes.Equal(b, []byte("abcdef")) || len(a.history) != 0 {
+		t.Fatalf("undo left %q with %d edits", b, len(a.history))
+	}
+
+	// fixes past the end of the file are shown as an error, writing nothing
+	if err := fix([]*node{
+		{name: "first", start: 0, end: 1, fix: []byte("A")},
+		{name: "last", start: 5, end: 7, fix: []byte("FG")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if b := contents(t, a); app.message == "" || !bytes.Equal(b, []byte("abcdef")) {
+		t.Fatalf("invalid fix shows %q and left %q", app.message, b)
+	}
+}
+
+func TestFormatPanic(t *testing.T) {
+	a := newTestEditor(t, []byte("abcd"))
+	f := &format{name: "broken", parse: func(r io.ReaderAt, size int64) ([]*node, error) {
+		panic("corrupt data")
+	}}
+	if err := a.applyFormat(f, 0); err == nil {
+		t.Fatal("panic not returned as an error")
+	}
+
+	// decoding again after an edit reports the panic as a message
+	app.message = ""
+	if err := a.write(0, []byte("X")); err != nil {
+		t.Fatal(err)
+	}
+	if app.message == "" {
+		t.Fatal("panic not shown after edit")
+	}
+}
+
+func TestFormatAtCursor(t *testing.T) {
+	png := "\x89PNG\r\n\x1A\n\x00\x00\x00\x00IEND\xAE\x42\x60\x82"
+	a := newTestEditor(t, []byte("abcd"+png))
+	a.cursorOffset = 4
+	if err := a.onEvent(tcell.NewEventKey(tcell.KeyCtrlT, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range "PNG" {
+		if err := app.areas.current.onEvent(tcell.NewEventKey(tcell.KeyRune, c, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := app.areas.current.onEvent(tcell.NewEventKey(tcell.KeyEnter, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	roots := a.panels.all["tree"].(*treePanel).roots
+	if app.message != "" || len(roots) == 0 || roots[0].start != 4 {
+		t.Fatalf("PNG at cursor not decoded, message %q", app.message)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+)
+
+// this file contains the ELF file format
+
+func detectELF(head []byte) bool {
+	return bytes.HasPrefix(head, []byte(elf.ELFMAG))
+}
+
+func parseELF(r io.ReaderAt, size int64) ([]*node, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// address sized fields are 4 or 8 bytes
+	addr := 4
+	if f.Class == elf.ELFCLASS64 {
+		addr = 8
+	}
+
+	// header
+	header, h, err := readFields(r, 0, f.ByteOrder, []structField{
+		{"e_ident", 16, nil},
+		{"e_type", 2, func(v uint64) string { return elf.Type(v).String() }},
+		{"e_machine", 2, func(v uint64) string { return elf.Machine(v).String() }},
+		{"e_version", 4, nil},
+		{"e_entry", addr, nil},
+		{"e_phoff", addr, nil},
+		{"e_shoff", addr, nil},
+		{"e_flags", 4, nil},
+		{"e_ehsize", 2, nil},
+		{"e_phentsize", 2, nil},
+		{"e_phnum", 2, nil},
+		{"e_shentsize", 2, nil},
+		{"e_shnum", 2, nil},
+		{"e_shstrndx", 2, nil},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ident, _, err := readFields(r, 0, f.ByteOrder, []structField{
+		{"EI_MAG", 4, nil},
+		{"EI_CLASS", 1, func(v uint64) string { return elf.Class(v).String() }},
+		{"EI_DATA", 1, func(v uint64) string { return elf.Data(v).String() }},
+		{"EI_VERSION", 1, nil},
+		{"EI_OSABI", 1, func(v uint64) string { return elf.OSABI(v).String() }},
+		{"EI_ABIVERSION", 1, nil},
+		{"EI_PAD", 7, nil},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ident[0].value = fmt.Sprintf("%q", elf.ELFMAG)
+	header[0].children = ident
+	nodes := []*node{group("ELF header", f.Class.String()+" "+f.Machine.String(), header)}
+
+	// program headers
+	var progs []*node
+	for i, p := range f.Progs {
+		offset := int64(h["e_phoff"] + uint64(i)*h["e_phentsize"])
+		var fields []structField
+		if addr == 8 {
+			fields = []structField{{"p_type", 4, progType}, {"p_flags", 4, progFlags},
+				{"p_offset", 8, nil}, {"p_vaddr", 8, nil}, {"p_paddr", 8, nil},
+				{"p_filesz", 8, nil}, {"p_memsz", 8, nil}, {"p_align", 8, nil}}
+		} else {
+			fields = []structField{{"p_type", 4, progType}, {"p_offset", 4, nil},
+				{"p_vaddr", 4, nil}, {"p_paddr", 4, nil}, {"p_filesz", 4, nil},
+				{"p_memsz", 4, nil}, {"p_flags", 4, progFlags}, {"p_align", 4, nil}}
+		}
+		entry, _, err := readFields(r, offset, f.ByteOrder, fields)
+		if err != nil {
+			return nodes, err
+		}
+		progs = append(progs, &node{
+			name:     fmt.Sprintf("[%d] %s", i, p.Type),
+			value:    fmt.Sprintf("%s offset 0x%X vaddr 0x%X filesz 0x%X", p.Flags, p.Off, p.Vaddr, p.Filesz),
+			start:    int64(p.Off),
+			end:      int64(p.Off + p.Filesz),
+			children: []*node{group("header", "", entry)},
+		})
+	}
+	if len(progs) > 0 {
+		n := group("Program headers", fmt.Sprintf("[%d]", len(progs)), progs)
+		n.start = int64(h["e_phoff"])
+		n.end = n.start + int64(len(progs))*int64(h["e_phentsize"])
+		nodes = append(nodes, n)
+	}
+
+	// sections
+	var sections []*node
+	for i, s := range f.Sections {
+		offset := int64(h["e_shoff"] + uint64(i)*h["e_shentsize"])
+		entry, _, err := readFields(r, offset, f.ByteOrder, []structField{
+			{"sh_name", 4, nil},
+			{"sh_type", 4, func(v uint64) string { return elf.SectionType(v).String() }},
+			{"sh_flags", addr, func(v uint64) string { return elf.SectionFlag(v).String() }},
+			{"sh_addr", addr, nil},
+			{"sh_offset", addr, nil},
+			{"sh_size", addr, nil},
+			{"sh_link", 4, nil},
+			{"sh_info", 4, nil},
+			{"sh_addralign", addr, nil},
+			{"sh_entsize", addr, nil},
+		})
+		if err != nil {
+			return nodes, err
+		}
+		n := &node{
+			name:     fmt.Sprintf("[%d] %s", i, s.Name),
+			value:    fmt.Sprintf("%s offset 0x%X addr 0x%X size 0x%X", s.Type, s.Offset, s.Addr, s.Size),
+			start:    int64(s.Offset),
+			end:      int64(s.Offset + s.FileSize),
+			children: []*node{group("header", "", entry)},
+		}
+		if s.Type == elf.SHT_NOBITS {
+			n.end = n.start
+		}
+		sections = append(sections, n)
+	}
+	if len(sections) > 0 {
+		n := group("Section headers", fmt.Sprintf("[%d]", len(sections)), sections)
+		n.start = int64(h["e_shoff"])
+		n.end = n.start + int64(len(sections))*int64(h["e_shentsize"])
+		nodes = append(nodes, n)
+	}
+
+	return nodes, nil
+}
+
+func progType(v uint64) string {
+	return elf.ProgType(v).String()
+}
+
+func progFlags(v uint64) string {
+	return elf.ProgFlag(v).String()
+}
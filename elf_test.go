@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// elfTestFile returns a 64 bit executable with a load segment covering
+// the file and a section header string table
+func elfTestFile() []byte {
+	order := binary.LittleEndian
+	b := make([]byte, 0x180)
+	copy(b, "\x7FELF\x02\x01\x01")
+	order.PutUint16(b[16:], 2)  // executable
+	order.PutUint16(b[18:], 62) // x86-64
+	order.PutUint32(b[20:], 1)  // version
+	order.PutUint64(b[24:], 0x401000)
+	order.PutUint64(b[32:], 64)    // program headers
+	order.PutUint64(b[40:], 0x100) // section headers
+	order.PutUint16(b[52:], 64)
+	order.PutUint16(b[54:], 56)
+	order.PutUint16(b[56:], 1)
+	order.PutUint16(b[58:], 64)
+	order.PutUint16(b[60:], 2)
+	order.PutUint16(b[62:], 1)
+
+	ph := b[64:]
+	order.PutUint32(ph, 1) // load
+	order.PutUint32(ph[4:], 5)
+	order.PutUint64(ph[16:], 0x400000)
+	order.PutUint64(ph[24:], 0x400000)
+	order.PutUint64(ph[32:], uint64(len(b)))
+	order.PutUint64(ph[40:], uint64(len(b)))
+	order.PutUint64(ph[48:], 0x1000)
+
+	copy(b[0xC0:], "\x00.shstrtab\x00")
+	sh := b[0x140:]
+	order.PutUint32(sh, 1) // name
+	order.PutUint32(sh[4:], 3)
+	order.PutUint64(sh[24:], 0xC0)
+	order.PutUint64(sh[32:], 11)
+	order.PutUint64(sh[48:], 1)
+	return b
+}
+
+func TestELF(t *testing.T) {
+	nodes := parseValid(t, parseELF, elfTestFile())
+	if findNode(nodes, "[0] PT_LOAD") == nil || findNode(nodes, "[1] .shstrtab") == nil {
+		t.Fatal("segment or section not decoded")
+	}
+}
+
+func TestELFTruncated(t *testing.T) {
+	parseTruncated(t, parseELF, elfTestFile())
+}
+
+func TestELFCorrupt(t *testing.T) {
+	parseCorrupt(t, parseELF, elfTestFile())
+}
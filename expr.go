@@ -0,0 +1,576 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// this file contains a small expression language used by structure templates
+// for sizes, counts and conditions, e.g. "hdr.count * 2" or "version >= 2 and flags & 1"
+
+// expr is a compiled expression, evaluated in a scope of named values.
+// values are int64, float64, bool, string, []byte, []interface{} or exprScope.
+type expr func(s exprScope) (interface{}, error)
+
+// exprScope resolves names used in expressions
+type exprScope interface {
+	lookup(name string) (interface{}, bool)
+}
+
+type exprParser struct {
+	src  string
+	toks []string
+	i    int
+}
+
+// compileExpr compiles an expression
+func compileExpr(src string) (expr, error) {
+	toks, err := tokenizeExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{src: src, toks: toks}
+	e, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.toks) {
+		return nil, fmt.Errorf("unexpected \"%s\" in expression \"%s\"", p.toks[p.i], src)
+	}
+	return e, nil
+}
+
+func tokenizeExpr(src string) ([]string, error) {
+	var toks []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case isIdentByte(c):
+			// identifier or number
+			j := i
+			for j < len(src) && (isIdentByte(src[j]) || src[j] == '.' && c >= '0' && c <= '9' && j+1 < len(src) && src[j+1] >= '0' && src[j+1] <= '9') {
+				j++
+			}
+			toks = append(toks, src[i:j])
+			i = j
+		case c == '"' || c == '\'':
+			// string literal
+			j := strings.IndexByte(src[i+1:], c)
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated string in expression \"%s\"", src)
+			}
+			toks = append(toks, src[i:i+j+2])
+			i += j + 2
+		default:
+			// operator, longest match first
+			op := ""
+			for _, o := range []string{"<<", ">>", "<=", ">=", "==", "!=", "&&", "||", "::"} {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				if !strings.ContainsRune("+-*/%&|^~!<>()[].,?:", rune(c)) {
+					return nil, fmt.Errorf("unexpected \"%c\" in expression \"%s\"", c, src)
+				}
+				op = string(c)
+			}
+			toks = append(toks, op)
+			i += len(op)
+		}
+	}
+	return toks, nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func (p *exprParser) peek() string {
+	if p.i < len(p.toks) {
+		return p.toks[p.i]
+	}
+	return ""
+}
+
+func (p *exprParser) next() string {
+	t := p.peek()
+	p.i++
+	return t
+}
+
+func (p *exprParser) expect(t string) error {
+	if p.next() != t {
+		return fmt.Errorf("expected \"%s\" in expression \"%s\"", t, p.src)
+	}
+	return nil
+}
+
+// binary operators by precedence, lowest first
+var exprLevels = [][]string{
+	{"||", "or"},
+	{"&&", "and"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *exprParser) ternary() (expr, error) {
+	cond, err := p.binary(0)
+	if err != nil || p.peek() != "?" {
+		return cond, err
+	}
+	p.next()
+	a, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	b, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	return func(s exprScope) (interface{}, error) {
+		c, err := cond(s)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(c) {
+			return a(s)
+		}
+		return b(s)
+	}, nil
+}
+
+func (p *exprParser) binary(level int) (expr, error) {
+	if level == len(exprLevels) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		found := false
+		for _, o := range exprLevels[level] {
+			found = found || o == op
+		}
+		if !found {
+			return left, nil
+		}
+		p.next()
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr(op, left, right)
+	}
+}
+
+func binaryExpr(op string, left, right expr) expr {
+	return func(s exprScope) (interface{}, error) {
+		a, err := left(s)
+		if err != nil {
+			return nil, err
+		}
+
+		// short circuit logical operators
+		switch op {
+		case "||", "or":
+			if truthy(a) {
+				return true, nil
+			}
+		case "&&", "and":
+			if !truthy(a) {
+				return false, nil
+			}
+		}
+
+		b, err := right(s)
+		if err != nil {
+			return nil, err
+		}
+		return applyBinary(op, a, b)
+	}
+}
+
+func applyBinary(op string, a, b interface{}) (interface{}, error) {
+	switch op {
+	case "||", "or", "&&", "and":
+		return truthy(b), nil
+	case "==":
+		return equal(a, b), nil
+	case "!=":
+		return !equal(a, b), nil
+	}
+
+	// string concatenation and comparison
+	if x, ok := a.(string); ok {
+		if y, ok := b.(string); ok {
+			switch op {
+			case "+":
+				return x + y, nil
+			case "<":
+				return x < y, nil
+			case "<=":
+				return x <= y, nil
+			case ">":
+				return x > y, nil
+			case ">=":
+				return x >= y, nil
+			}
+		}
+	}
+
+	// floating point arithmetic if either side is a float
+	_, af := a.(float64)
+	_, bf := b.(float64)
+	if af || bf {
+		x, err := toFloat(a)
+		if err != nil {
+			return nil, err
+		}
+		y, err := toFloat(b)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "+":
+			return x + y, nil
+		case "-":
+			return x - y, nil
+		case "*":
+			return x * y, nil
+		case "/":
+			return x / y, nil
+		case "<":
+			return x < y, nil
+		case "<=":
+			return x <= y, nil
+		case ">":
+			return x > y, nil
+		case ">=":
+			return x >= y, nil
+		}
+		return nil, fmt.Errorf("invalid operator \"%s\" for floats", op)
+	}
+
+	x, err := toInt(a)
+	if err != nil {
+		return nil, err
+	}
+	y, err := toInt(b)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "|":
+		return x | y, nil
+	case "^":
+		return x ^ y, nil
+	case "&":
+		return x & y, nil
+	case "<":
+		return x < y, nil
+	case "<=":
+		return x <= y, nil
+	case ">":
+		return x > y, nil
+	case ">=":
+		return x >= y, nil
+	case "<<":
+		return x << uint64(y), nil
+	case ">>":
+		return x >> uint64(y), nil
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/", "%":
+		if y == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		if op == "/" {
+			return x / y, nil
+		}
+		return x % y, nil
+	}
+	return nil, fmt.Errorf("invalid operator \"%s\"", op)
+}
+
+func (p *exprParser) unary() (expr, error) {
+	switch op := p.peek(); op {
+	case "-", "!", "~", "not":
+		p.next()
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(s exprScope) (interface{}, error) {
+			v, err := e(s)
+			if err != nil {
+				return nil, err
+			}
+			if op == "!" || op == "not" {
+				return !truthy(v), nil
+			}
+			if f, ok := v.(float64); ok && op == "-" {
+				return -f, nil
+			}
+			x, err := toInt(v)
+			if err != nil {
+				return nil, err
+			}
+			if op == "-" {
+				return -x, nil
+			}
+			return ^x, nil
+		}, nil
+	}
+	return p.postfix()
+}
+
+func (p *exprParser) postfix() (expr, error) {
+	e, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek() {
+		case ".":
+			// member access
+			p.next()
+			name := p.next()
+			if name == "" || !isIdentByte(name[0]) {
+				return nil, fmt.Errorf("expected name after \".\" in expression \"%s\"", p.src)
+			}
+			e = memberExpr(e, name)
+		case "[":
+			// index access
+			p.next()
+			index, err := p.ternary()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			e = indexExpr(e, index)
+		case "(":
+			// method calls without arguments, e.g. "name.length()"
+			p.next()
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+		default:
+			return e, nil
+		}
+	}
+}
+
+func memberExpr(e expr, name string) expr {
+	return func(s exprScope) (interface{}, error) {
+		v, err := e(s)
+		if err != nil {
+			return nil, err
+		}
+		switch x := v.(type) {
+		case exprScope:
+			if m, ok := x.lookup(name); ok {
+				return m, nil
+			}
+		case string:
+			switch name {
+			case "length", "size":
+				return int64(len(x)), nil
+			case "to_i":
+				return strconv.ParseInt(x, 0, 64)
+			}
+		case []byte:
+			switch name {
+			case "length", "size":
+				return int64(len(x)), nil
+			case "first", "last":
+				if len(x) == 0 {
+					return nil, fmt.Errorf("empty byte array")
+				}
+				if name == "first" {
+					return int64(x[0]), nil
+				}
+				return int64(x[len(x)-1]), nil
+			}
+		case []interface{}:
+			switch name {
+			case "length", "size":
+				return int64(len(x)), nil
+			case "first", "last":
+				if len(x) == 0 {
+					return nil, fmt.Errorf("empty array")
+				}
+				if name == "first" {
+					return x[0], nil
+				}
+				return x[len(x)-1], nil
+			}
+		case int64:
+			switch name {
+			case "to_i":
+				return x, nil
+			case "to_s":
+				return strconv.FormatInt(x, 10), nil
+			}
+		}
+		return nil, fmt.Errorf("unknown member \"%s\"", name)
+	}
+}
+
+func indexExpr(e, index expr) expr {
+	return func(s exprScope) (interface{}, error) {
+		v, err := e(s)
+		if err != nil {
+			return nil, err
+		}
+		iv, err := index(s)
+		if err != nil {
+			return nil, err
+		}
+		i, err := toInt(iv)
+		if err != nil {
+			return nil, err
+		}
+		switch x := v.(type) {
+		case []interface{}:
+			if i >= 0 && i < int64(len(x)) {
+				return x[i], nil
+			}
+		case []byte:
+			if i >= 0 && i < int64(len(x)) {
+				return int64(x[i]), nil
+			}
+		default:
+			return nil, fmt.Errorf("cannot index %T", v)
+		}
+		return nil, fmt.Errorf("index %d out of range", i)
+	}
+}
+
+func (p *exprParser) primary() (expr, error) {
+	t := p.next()
+	switch {
+	case t == "":
+		return nil, fmt.Errorf("unexpected end of expression \"%s\"", p.src)
+	case t == "(":
+		e, err := p.ternary()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	case t[0] == '"' || t[0] == '\'':
+		v := t[1 : len(t)-1]
+		return func(exprScope) (interface{}, error) { return v, nil }, nil
+	case t[0] >= '0' && t[0] <= '9':
+		var v interface{}
+		var err error
+		if strings.ContainsAny(t, ".eE") && !strings.HasPrefix(t, "0x") {
+			v, err = strconv.ParseFloat(t, 64)
+		} else {
+			v, err = strconv.ParseInt(strings.Replace(t, "_", "", -1), 0, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid number \"%s\" in expression \"%s\"", t, p.src)
+		}
+		return func(exprScope) (interface{}, error) { return v, nil }, nil
+	case t == "true" || t == "false":
+		v := t == "true"
+		return func(exprScope) (interface{}, error) { return v, nil }, nil
+	case isIdentByte(t[0]):
+		name := t
+		// enum values, e.g. "enum_name::value"
+		for p.peek() == "::" {
+			p.next()
+			name += "::" + p.next()
+		}
+		return func(s exprScope) (interface{}, error) {
+			if v, ok := s.lookup(name); ok {
+				return v, nil
+			}
+			return nil, fmt.Errorf("unknown name \"%s\"", name)
+		}, nil
+	}
+	return nil, fmt.Errorf("unexpected \"%s\" in expression \"%s\"", t, p.src)
+}
+
+// truthy converts a value to a boolean
+func truthy(v interface{}) bool {
+	switch x := v.(type) {
+	case bool:
+		return x
+	case int64:
+		return x != 0
+	case float64:
+		return x != 0
+	case string:
+		return x != ""
+	case nil:
+		return false
+	}
+	return true
+}
+
+func equal(a, b interface{}) bool {
+	switch x := a.(type) {
+	case []byte:
+		y, ok := b.([]byte)
+		return ok && string(x) == string(y)
+	case string:
+		y, ok := b.(string)
+		return ok && x == y
+	case float64:
+		y, err := toFloat(b)
+		return err == nil && x == y
+	}
+	if _, ok := b.(float64); ok {
+		return equal(b, a)
+	}
+	x, err := toInt(a)
+	y, err2 := toInt(b)
+	return err == nil && err2 == nil && x == y
+}
+
+// toInt converts a value to an integer
+func toInt(v interface{}) (int64, error) {
+	switch x := v.(type) {
+	case int64:
+		return x, nil
+	case float64:
+		return int64(x), nil
+	case bool:
+		if x {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("expected integer, got %T", v)
+}
+
+func toFloat(v interface{}) (float64, error) {
+	if f, ok := v.(float64); ok {
+		return f, nil
+	}
+	i, err := toInt(v)
+	return float64(i), err
+}
@@ -0,0 +1,103 @@
+package main
+
+import "testing"
+
+// mapScope resolves names from a map
+type mapScope map[string]interface{}
+
+func (s mapScope) lookup(name string) (interface{}, bool) {
+	v, ok := s[name]
+	return v, ok
+}
+
+func TestExpr(t *testing.T) {
+	scope := mapScope{
+		"count": int64(3),
+		"name":  "abc",
+		"data":  []byte{1, 2, 3},
+		"list":  []interface{}{int64(10), int64(20)},
+		"hdr":   mapScope{"version": int64(2), "flags": int64(5)},
+	}
+	tests := []struct {
+		src  string
+		want interface{}
+	}{
+		{"1 + 2 * 3", int64(7)},
+		{"(1 + 2) * 3", int64(9)},
+		{"-count", int64(-3)},
+		{"~0", int64(-1)},
+		{"7 / 2", int64(3)},
+		{"7 % 4", int64(3)},
+		{"1 << 4 | 1", int64(17)},
+		{"0xF0 >> 4 & 3", int64(3)},
+		{"6 ^ 3", int64(5)},
+		{"1_000", int64(1000)},
+		{"7 / 2.0", 3.5},
+		{"1.5 * 2", 3.0},
+		{"count == 3.0", true},
+		{"count != 3", false},
+		{"hdr.version >= 2 and hdr.flags & 1", true},
+		{"count < 2 || count > 2", true},
+		{"not true or false", false},
+		{"!0", true},
+		{"count > 2 ? 'big' : 'small'", "big"},
+		{"name + \"def\"", "abcdef"},
+		{"name < 'abd'", true},
+		{"name.length", int64(3)},
+		{"'0x10'.to_i", int64(16)},
+		{"count.to_s", "3"},
+		{"data.size()", int64(3)},
+		{"data.last", int64(3)},
+		{"data[1]", int64(2)},
+		{"list[count - 2]", int64(20)},
+		{"list.first", int64(10)},
+		{"list.length", int64(2)},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			e, err := compileExpr(test.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, err := e(scope)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != test.want {
+				t.Fatalf("evaluated to %v (%T), want %v (%T)", v, v, test.want, test.want)
+			}
+		})
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	tests := []string{
+		"1 / 0",
+		"1 % 0",
+		"unknown",
+		"name.unknown",
+		"data[3]",
+		"list[-1]",
+		"count[0]",
+		"1.5 | 1",
+	}
+	for _, src := range tests {
+		t.Run(src, func(t *testing.T) {
+			e, err := compileExpr(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v, err := e(mapScope{"name": "abc", "data": []byte{1, 2, 3}, "list": []interface{}{}, "count": int64(3)}); err == nil {
+				t.Fatalf("evaluated to %v, want an error", v)
+			}
+		})
+	}
+}
+
+func TestExprSyntaxErrors(t *testing.T) {
+	for _, src := range []string{"", "1 +", "(1", "1 2", "a.", "0x"} {
+		if _, err := compileExpr(src); err == nil {
+			t.Errorf("compiled invalid expression %q", src)
+		}
+	}
+}
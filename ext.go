@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// this file contains the superblock and block group descriptors of ext2,
+// ext3 and ext4 file systems
+
+const (
+	extSuperblock = 1024
+	extMagic      = 0xEF53
+	extMaxGroups  = 1 << 16
+)
+
+var extStates = map[uint64]string{1: "clean", 2: "errors", 4: "orphans"}
+
+var extOS = map[uint64]string{0: "Linux", 1: "Hurd", 2: "Masix", 3: "FreeBSD", 4: "Lites"}
+
+var extIncompat = []string{"compression", "filetype", "recover", "journal_dev", "meta_bg", "", "extents", "64bit",
+	"mmp", "flex_bg", "ea_inode", "", "dirdata", "csum_seed", "largedir", "inline_data", "encrypt", "casefold"}
+
+func detectExt(head []byte) bool {
+	return len(head) >= extSuperblock+58 && binary.LittleEndian.Uint16(head[extSuperblock+56:]) == extMagic
+}
+
+// extSuper holds the values of the superblock needed to locate blocks
+type extSuper struct {
+	blockSize  int64
+	firstBlock int64
+	blocks     int64
+	perGroup   int64
+	descSize   int64
+	compat     uint64
+	incompat   uint64
+}
+
+// extReadSuper reads the superblock fields
+func extReadSuper(r io.ReaderAt) ([]*node, extSuper, error) {
+	var s extSuper
+	fields, v, err := readFields(r, extSuperblock, binary.LittleEndian, []structField{
+		{"inodes count", 4, nil},
+		{"blocks count", 4, nil},
+		{"reserved blocks count", 4, nil},
+		{"free blocks count", 4, nil},
+		{"free inodes count", 4, nil},
+		{"first data block", 4, nil},
+		{"log block size", 4, func(v uint64) string { return fmt.Sprintf("%d bytes", 1024<<min(int(v), 32)) }},
+		{"log cluster size", 4, nil},
+		{"blocks per group", 4, nil},
+		{"clusters per group", 4, nil},
+		{"inodes per group", 4, nil},
+		{"mount time", 4, extTime},
+		{"write time", 4, extTime},
+		{"mount count", 2, nil},
+		{"max mount count", 2, nil},
+		{"magic", 2, nil},
+		{"state", 2, func(v uint64) string { return extStates[v] }},
+		{"errors", 2, nil},
+		{"minor revision", 2, nil},
+		{"last check", 4, extTime},
+		{"check interval", 4, nil},
+		{"creator OS", 4, func(v uint64) string { return extOS[v] }},
+		{"revision", 4, nil},
+		{"default reserved uid", 2, nil},
+		{"default reserved gid", 2, nil},
+		{"first inode", 4, nil},
+		{"inode size", 2, nil},
+		{"block group number", 2, nil},
+		{"compatible features", 4, nil},
+		{"incompatible features", 4, extFeatures},
+		{"read-only features", 4, nil},
+	})
+	if err != nil {
+		return nil, s, err
+	}
+	b := make([]byte, 1024)
+	if _, err := r.ReadAt(b, extSuperblock); err != nil {
+		return nil, s, err
+	}
+	text := func(name string, offset, size int64) *node {
+		return &node{name: name, value: fmt.Sprintf("%q", readCString(r, extSuperblock+offset, int(size))), start: extSuperblock + offset, end: extSuperblock + offset + size}
+	}
+	u := b[0x68:0x78]
+	fields = append(fields,
+		&node{name: "UUID", value: fmt.Sprintf("%x-%x-%x-%x-%x", u[:4], u[4:6], u[6:8], u[8:10], u[10:]), start: extSuperblock + 0x68, end: extSuperblock + 0x78},
+		text("volume name", 0x78, 16),
+		text("last mounted", 0x88, 64),
+	)
+	descSize, _, err := readFields(r, extSuperblock+0xFE, binary.LittleEndian, []structField{{"descriptor size", 2, nil}})
+	if err != nil {
+		return nil, s, err
+	}
+	fields = append(fields, descSize...)
+
+	if v["log block size"] > 16 || v["blocks per group"] == 0 || v["blocks count"] <= v["first data block"] {
+		return fields, s, fmt.Errorf("invalid ext superblock")
+	}
+	s = extSuper{
+		blockSize:  1024 << v["log block size"],
+		firstBlock: int64(v["first data block"]),
+		blocks:     int64(v["blocks count"]),
+		perGroup:   int64(v["blocks per group"]),
+		descSize:   32,
+		compat:     v["compatible features"],
+		incompat:   v["incompatible features"],
+	}
+	if s.incompat&0x80 != 0 {
+		// 64bit file systems have larger block numbers
+		s.blocks |= int64(binary.LittleEndian.Uint32(b[0x150:])) << 32
+		if d := int64(binary.LittleEndian.Uint16(b[0xFE:])); d >= 32 {
+			s.descSize = d
+		}
+	}
+	return fields, s, nil
+}
+
+func parseExt(r io.ReaderAt, size int64) ([]*node, error) {
+	fields, s, err := extReadSuper(r)
+	if fields == nil {
+		return nil, err
+	}
+	version := "ext2"
+	if s.compat&0x4 != 0 {
+		version = "ext3"
+	}
+	if s.incompat&0x2C0 != 0 {
+		// extents, 64bit or flex_bg
+		version = "ext4"
+	}
+	super := group("Superblock", fmt.Sprintf("%s, %d blocks of %d bytes", version, s.blocks, s.blockSize), fields)
+	super.end = extSuperblock + 1024
+	nodes := []*node{{name: "Boot sector", value: "1024 bytes", start: 0, end: extSuperblock}, super}
+	if err != nil {
+		return nodes, err
+	}
+
+	// group descriptors follow the superblock, in the next block
+	groups := (s.blocks - s.firstBlock + s.perGroup - 1) / s.perGroup
+	start := (s.firstBlock + 1) * s.blockSize
+	if groups > extMaxGroups || start+groups*s.descSize > size {
+		return nodes, fmt.Errorf("showing the superblock only, %d group descriptors do not fit in the file", groups)
+	}
+	table := &node{name: "Group descriptors", value: fmt.Sprintf("%d groups", groups), start: start, end: start + groups*s.descSize}
+	nodes = append(nodes, table)
+	b := make([]byte, groups*s.descSize)
+	if _, err := r.ReadAt(b, start); err != nil {
+		return nodes, err
+	}
+	for i := int64(0); i < groups; i++ {
+		d := b[i*s.descSize:]
+		block := func(lo, hi int) int64 {
+			v := int64(binary.LittleEndian.Uint32(d[lo:]))
+			if s.descSize >= 64 {
+				v |= int64(binary.LittleEndian.Uint32(d[hi:])) << 32
+			}
+			return v
+		}
+		pos := start + i*s.descSize
+		bitmap, inodes, inodeTable := block(0, 0x20), block(4, 0x24), block(8, 0x28)
+		first := s.firstBlock + i*s.perGroup
+		n := &node{
+			name:  fmt.Sprintf("group %d", i),
+			value: fmt.Sprintf("blocks %d-%d", first, min64(first+s.perGroup, s.blocks)-1),
+			start: pos,
+			end:   pos + s.descSize,
+			children: []*node{
+				{name: "block bitmap", value: fmt.Sprintf("block %d", bitmap), start: pos, end: pos + 4},
+				{name: "inode bitmap", value: fmt.Sprintf("block %d", inodes), start: pos + 4, end: pos + 8},
+				{name: "inode table", value: fmt.Sprintf("block %d", inodeTable), start: pos + 8, end: pos + 12},
+				{name: "free blocks", value: fmt.Sprint(binary.LittleEndian.Uint16(d[12:])), start: pos + 12, end: pos + 14},
+				{name: "free inodes", value: fmt.Sprint(binary.LittleEndian.Uint16(d[14:])), start: pos + 14, end: pos + 16},
+				{name: "used directories", value: fmt.Sprint(binary.LittleEndian.Uint16(d[16:])), start: pos + 16, end: pos + 18},
+				{name: "flags", value: fmt.Sprintf("0x%04X", binary.LittleEndian.Uint16(d[18:])), start: pos + 18, end: pos + 20},
+			},
+		}
+		table.children = append(table.children, n)
+	}
+	return nodes, nil
+}
+
+// extUnits numbers the blocks and block groups of the file system
+func extUnits(r io.ReaderAt, size int64) []unit {
+	_, s, err := extReadSuper(r)
+	if err != nil {
+		return nil
+	}
+	return []unit{
+		{"block", 0, 0, s.blockSize},
+		{"group", 0, s.firstBlock * s.blockSize, s.perGroup * s.blockSize},
+	}
+}
+
+// extTime formats a timestamp of the superblock, which is zero if not set
+func extTime(v uint64) string {
+	if v == 0 {
+		return "never"
+	}
+	return formatTime(time.Unix(int64(v), 0))
+}
+
+// extFeatures names the set bits of the incompatible features
+func extFeatures(v uint64) string {
+	var names []string
+	for i, name := range extIncompat {
+		if v&(1<<uint(i)) != 0 && name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// extTestImage returns an ext2 file system of four 1024 byte blocks in a
+// single group
+func extTestImage() []byte {
+	order := binary.LittleEndian
+	b := make([]byte, 4*1024)
+	s := b[extSuperblock:]
+	order.PutUint32(s[0:], 16)    // inodes
+	order.PutUint32(s[4:], 4)     // blocks
+	order.PutUint32(s[20:], 1)    // first data block
+	order.PutUint32(s[32:], 8192) // blocks per group
+	order.PutUint32(s[40:], 16)   // inodes per group
+	order.PutUint16(s[56:], extMagic)
+	order.PutUint16(s[58:], 1) // clean
+	order.PutUint32(s[76:], 1) // dynamic revision
+	order.PutUint16(s[88:], 128)
+	copy(s[0x78:], "volume")
+
+	g := b[2*1024:]
+	order.PutUint32(g[0:], 3)
+	order.PutUint32(g[4:], 3)
+	order.PutUint32(g[8:], 3)
+	return b
+}
+
+func TestExt(t *testing.T) {
+	nodes := parseValid(t, parseExt, extTestImage())
+	if n := findNode(nodes, "volume name"); n == nil || n.value != `"volume"` {
+		t.Fatal("superblock not decoded")
+	}
+	if n := findNode(nodes, "group 0"); n == nil || n.value != "blocks 1-3" {
+		t.Fatal("group descriptor not decoded")
+	}
+}
+
+func TestExtTruncated(t *testing.T) {
+	parseTruncated(t, parseExt, extTestImage())
+}
+
+func TestExtCorrupt(t *testing.T) {
+	parseCorrupt(t, parseExt, extTestImage())
+}
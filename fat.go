@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// this file contains the boot sector and regions of FAT12, FAT16 and FAT32
+// file systems
+
+// fatVolume holds the layout of a FAT file system computed from its boot
+// sector
+type fatVolume struct {
+	bits          int // of FAT entries
+	sectorSize    int64
+	clusterSize   int64
+	fatStart      int64
+	fatSize       int64
+	fats          int64
+	rootStart     int64 // of the FAT12 and FAT16 root directory
+	rootSize      int64
+	dataStart     int64
+	clusters      int64
+	rootCluster   int64 // of the FAT32 root directory
+	infoSector    int64
+	backupSector  int64
+	totalSectors  int64
+	reserved      int64
+	sectorsPerFAT int64
+}
+
+func detectFAT(head []byte) bool {
+	if len(head) < 512 || head[510] != 0x55 || head[511] != 0xAA || (head[0] != 0xEB && head[0] != 0xE9) {
+		return false
+	}
+	_, err := fatLayout(head)
+	return err == nil
+}
+
+// fatLayout computes the layout from the boot sector b
+func fatLayout(b []byte) (fatVolume, error) {
+	var v fatVolume
+	v.sectorSize = int64(binary.LittleEndian.Uint16(b[11:]))
+	perCluster := int64(b[13])
+	v.reserved = int64(binary.LittleEndian.Uint16(b[14:]))
+	v.fats = int64(b[16])
+	rootEntries := int64(binary.LittleEndian.Uint16(b[17:]))
+	v.totalSectors = int64(binary.LittleEndian.Uint16(b[19:]))
+	if v.totalSectors == 0 {
+		v.totalSectors = int64(binary.LittleEndian.Uint32(b[32:]))
+	}
+	v.sectorsPerFAT = int64(binary.LittleEndian.Uint16(b[22:]))
+	if v.sectorsPerFAT == 0 {
+		v.sectorsPerFAT = int64(binary.LittleEndian.Uint32(b[36:]))
+	}
+	if v.sectorSize < 512 || v.sectorSize > 4096 || v.sectorSize&(v.sectorSize-1) != 0 ||
+		perCluster == 0 || perCluster&(perCluster-1) != 0 || v.reserved == 0 || v.fats == 0 || v.fats > 4 || v.sectorsPerFAT == 0 {
+		return v, fmt.Errorf("invalid FAT boot sector")
+	}
+
+	// the FATs follow the reserved sectors, then the root directory of
+	// FAT12 and FAT16, then the clusters numbered from 2
+	v.clusterSize = perCluster * v.sectorSize
+	v.fatStart = v.reserved * v.sectorSize
+	v.fatSize = v.sectorsPerFAT * v.sectorSize
+	v.rootStart = v.fatStart + v.fats*v.fatSize
+	v.rootSize = (rootEntries*32 + v.sectorSize - 1) / v.sectorSize * v.sectorSize
+	v.dataStart = v.rootStart + v.rootSize
+	if v.totalSectors*v.sectorSize <= v.dataStart {
+		return v, fmt.Errorf("invalid FAT boot sector")
+	}
+	v.clusters = (v.totalSectors*v.sectorSize - v.dataStart) / v.clusterSize
+	switch {
+	case v.clusters < 4085:
+		v.bits = 12
+	case v.clusters < 65525:
+		v.bits = 16
+	default:
+		v.bits = 32
+		v.rootCluster = int64(binary.LittleEndian.Uint32(b[44:]))
+		v.infoSector = int64(binary.LittleEndian.Uint16(b[48:]))
+		v.backupSector = int64(binary.LittleEndian.Uint16(b[50:]))
+	}
+	return v, nil
+}
+
+func parseFAT(r io.ReaderAt, size int64) ([]*node, error) {
+	b := make([]byte, 512)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		return nil, err
+	}
+	v, err := fatLayout(b)
+	if err != nil {
+		return nil, err
+	}
+	fields, _, err := readFields(r, 0, binary.LittleEndian, []structField{
+		{"jump", 3, nil},
+		{"OEM name", 8, nil},
+		{"bytes per sector", 2, nil},
+		{"sectors per cluster", 1, nil},
+		{"reserved sectors", 2, nil},
+		{"FATs", 1, nil},
+		{"root entries", 2, nil},
+		{"total sectors 16", 2, nil},
+		{"media", 1, nil},
+		{"sectors per FAT 16", 2, nil},
+		{"sectors per track", 2, nil},
+		{"heads", 2, nil},
+		{"hidden sectors", 4, nil},
+		{"total sectors 32", 4, nil},
+	})
+	if err != nil {
+		return nil, err
+	}
+	fields[1].value = fmt.Sprintf("%q", readString(r, 3, 8))
+
+	// the extended BPB moves behind the FAT32 fields
+	ebpb := int64(36)
+	if v.bits == 32 {
+		fat32, _, err := readFields(r, 36, binary.LittleEndian, []structField{
+			{"sectors per FAT 32", 4, nil},
+			{"flags", 2, nil},
+			{"version", 2, nil},
+			{"root cluster", 4, nil},
+			{"FSInfo sector", 2, nil},
+			{"backup boot sector", 2, nil},
+			{"reserved", 12, nil},
+		})
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, fat32...)
+		ebpb = 64
+	}
+	extended, _, err := readFields(r, ebpb, binary.LittleEndian, []structField{
+		{"drive number", 1, nil},
+		{"reserved", 1, nil},
+		{"boot signature", 1, nil},
+		{"volume ID", 4, nil},
+		{"volume label", 11, nil},
+		{"file system type", 8, nil},
+	})
+	if err != nil {
+		return nil, err
+	}
+	extended[3].value = fmt.Sprintf("%04X-%04X", binary.LittleEndian.Uint16(b[ebpb+5:]), binary.LittleEndian.Uint16(b[ebpb+3:]))
+	extended[4].value = fmt.Sprintf("%q", readString(r, ebpb+7, 11))
+	extended[5].value = fmt.Sprintf("%q", readString(r, ebpb+18, 8))
+	fields = append(fields, extended...)
+	fields = append(fields, &node{name: "signature", value: "0xAA55", start: 510, end: 512})
+
+	boot := group("Boot sector", fmt.Sprintf("FAT%d, %d clusters of %d bytes", v.bits, v.clusters, v.clusterSize), fields)
+	boot.start, boot.end = 0, v.sectorSize
+	nodes := []*node{boot}
+	if v.bits == 32 {
+		if v.infoSector > 0 && v.infoSector < v.reserved {
+			nodes = append(nodes, fatInfo(r, v.infoSector*v.sectorSize))
+		}
+		if v.backupSector > 0 && v.backupSector < v.reserved {
+			nodes = append(nodes, &node{name: "Backup boot sector", start: v.backupSector * v.sectorSize, end: (v.backupSector + 1) * v.sectorSize})
+		}
+	}
+	for i := int64(0); i < v.fats; i++ {
+		start := v.fatStart + i*v.fatSize
+		nodes = append(nodes, &node{name: fmt.Sprintf("FAT %d", i+1), value: fmt.Sprintf("%d sectors", v.sectorsPerFAT), start: start, end: start + v.fatSize})
+	}
+	if v.rootSize > 0 {
+		nodes = append(nodes, &node{name: "Root directory", value: fmt.Sprintf("%d bytes", v.rootSize), start: v.rootStart, end: v.rootStart + v.rootSize})
+	}
+	data := &node{name: "Data", value: fmt.Sprintf("clusters 2-%d", v.clusters+1), start: v.dataStart, end: min64(v.dataStart+v.clusters*v.clusterSize, size)}
+	if v.bits == 32 {
+		data.value += fmt.Sprintf(", root directory at cluster %d", v.rootCluster)
+	}
+	nodes = append(nodes, data)
+	if data.end < v.dataStart+v.clusters*v.clusterSize {
+		return nodes, fmt.Errorf("file system is truncated, %d of %d bytes present", size, v.totalSectors*v.sectorSize)
+	}
+	return nodes, nil
+}
+
+// fatInfo decodes the FAT32 FSInfo sector at pos
+func fatInfo(r io.ReaderAt, pos int64) *node {
+	n := &node{name: "FSInfo", start: pos, end: pos + 512}
+	fields, _, err := readFields(r, pos+484, binary.LittleEndian, []structField{
+		{"signature", 4, nil},
+		{"free clusters", 4, nil},
+		{"next free cluster", 4, nil},
+	})
+	if err == nil {
+		n.children = fields
+	}
+	return n
+}
+
+// fatUnits numbers the sectors and clusters of the file system
+func fatUnits(r io.ReaderAt, size int64) []unit {
+	b := make([]byte, 512)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		return nil
+	}
+	v, err := fatLayout(b)
+	if err != nil {
+		return nil
+	}
+	return []unit{
+		{"sector", 0, 0, v.sectorSize},
+		{"cluster", 2, v.dataStart, v.clusterSize},
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// fatTestBoot returns a boot sector of sectors of 512 bytes
+func fatTestBoot(b []byte, perCluster byte, reserved, rootEntries, perFAT uint16, total uint32) {
+	order := binary.LittleEndian
+	b[0] = 0xEB
+	copy(b[3:], "TEST    ")
+	order.PutUint16(b[11:], 512)
+	b[13] = perCluster
+	order.PutUint16(b[14:], reserved)
+	b[16] = 2
+	order.PutUint16(b[17:], rootEntries)
+	order.PutUint32(b[32:], total)
+	order.PutUint16(b[22:], perFAT)
+	b[510], b[511] = 0x55, 0xAA
+}
+
+// fatTestImage returns a FAT12 file system of 16 sectors
+func fatTestImage() []byte {
+	b := make([]byte, 16*512)
+	fatTestBoot(b, 1, 1, 16, 1, 16)
+	copy(b[43:], "VOLUME     FAT12   ")
+	return b
+}
+
+// fatTestFAT32 returns the reserved sectors of a FAT32 file system, with
+// its FSInfo sector and backup boot sector
+func fatTestFAT32() []byte {
+	order := binary.LittleEndian
+	b := make([]byte, 8*512)
+	fatTestBoot(b, 1, 8, 0, 0, 70000)
+	order.PutUint32(b[36:], 600)
+	order.PutUint32(b[44:], 2)
+	order.PutUint16(b[48:], 1)
+	order.PutUint16(b[50:], 6)
+	copy(b[512+484:], "rrAa")
+	copy(b[6*512:], b[:512])
+	return b
+}
+
+func TestFAT(t *testing.T) {
+	nodes := parseValid(t, parseFAT, fatTestImage())
+	if n := findNode(nodes, "Boot sector"); n == nil || n.value != "FAT12, 12 clusters of 512 bytes" {
+		t.Fatal("boot sector not decoded")
+	}
+	if n := findNode(nodes, "Data"); n == nil || n.start != 4*512 || n.end != 16*512 {
+		t.Fatal("data region not decoded")
+	}
+
+	// the FAT32 file system is truncated after the reserved sectors
+	nodes, err := parseFAT(bytes.NewReader(fatTestFAT32()), 8*512)
+	if err == nil || findNode(nodes, "FSInfo") == nil || findNode(nodes, "Backup boot sector") == nil {
+		t.Fatal("FAT32 reserved sectors not decoded")
+	}
+}
+
+func TestFATTruncated(t *testing.T) {
+	parseTruncated(t, parseFAT, fatTestImage())
+	parseTruncated(t, parseFAT, fatTestFAT32())
+}
+
+func TestFATCorrupt(t *testing.T) {
+	parseCorrupt(t, parseFAT, fatTestImage())
+	parseCorrupt(t, parseFAT, fatTestFAT32())
+}
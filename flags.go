@@ -17,6 +17,7 @@ type flags struct {
 	Group            int
 	BytesPerRow      int
 	Encoding         string
+	VirtualAddresses bool
 	Filename         string
 }
 
@@ -31,6 +32,7 @@ func (f *flags) init() {
 	flag.IntVar(&f.Group, "group", 1, "")
 	flag.IntVar(&f.BytesPerRow, "row", 16, "")
 	flag.StringVar(&f.Encoding, "enc", "utf8", "")
+	flag.BoolVar(&f.VirtualAddresses, "va", false, "")
 	flag.Usage = func() {
 		fmt.Fprintln(flag.CommandLine.Output(), `usage: hxe [options] [file]
 valid options are:
@@ -41,7 +43,8 @@ valid options are:
  -offset_base dec|hex|oct    which radix to use for offsets (default: hex)
  -group                      how many bytes to display in a group (default: 1, options: 1, 2, 4, 8, 16)
  -row                        how many bytes to display per row (default: 16, options: 1-4096)
- -enc val                    which encoding to use for the textual representation of the data`)
+ -enc val                    which encoding to use for the textual representation of the data
+ -va                         display virtual addresses instead of file offsets for executables`)
 	}
 	flag.Parse()
 
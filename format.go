@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// this file contains the built-in file formats, which are decoded into
+// structure trees when a file in one of these formats is opened
+
+// format is a file format which can be decoded into a structure tree
+type format struct {
+	name   string
+	detect func(head []byte) bool // checks the first bytes of a file
+	parse  func(r io.ReaderAt, size int64) ([]*node, error)
+	units  func(r io.ReaderAt, size int64) []unit // numbered blocks of the file, may be nil
+}
+
+// unit is a numbered block of a file format, such as a page or a cluster,
+// which can be jumped to by its number
+type unit struct {
+	name  string
+	first int64 // number of the unit at base
+	base  int64 // file offset of the first unit
+	size  int64
+}
+
+// offset returns the file offset of unit number n
+func (u unit) offset(n int64) int64 {
+	return u.base + (n-u.first)*u.size
+}
+
+// formatHeadSize is the amount of bytes passed to format detection
+const formatHeadSize = 4096
+
+var formats = []format{
+	{"ELF", detectELF, parseELF, nil},
+	{"PE", detectPE, parsePE, nil},
+	{"Mach-O", detectMacho, parseMacho, nil},
+	{"PNG", detectPNG, parsePNG, nil},
+	{"ZIP", detectZIP, parseZIP, nil},
+	{"DER", detectDER, parseDER, nil},
+	{"SQLite", detectSQLite, parseSQLite, sqliteUnits},
+	{"PCAP", detectPCAP, parsePCAP, nil},
+	{"PCAPNG", detectPCAPNG, parsePCAPNG, nil},
+	{"tar", detectTar, parseTar, nil},
+	{"cpio", detectCPIO, parseCPIO, nil},
+	{"RIFF", detectRIFF, parseRIFF, nil},
+	{"JPEG", detectJPEG, parseJPEG, nil},
+	{"TIFF", detectTIFF, parseTIFF, nil},
+	{"ext", detectExt, parseExt, extUnits},
+	{"FAT", detectFAT, parseFAT, fatUnits},
+	{"squashfs", detectSquashfs, parseSquashfs, nil},
+	{"GPT", detectGPT, parseGPT, partitionUnits},
+	{"MBR", detectMBR, parseMBR, partitionUnits},
+}
+
+// decoder decodes bytes, usually the selection, into a structure tree.
+// args are the words following the name of the decoder in the prompt.
+type decoder struct {
+	name   string
+	decode func(b []byte, offset int64, args []string) ([]*node, error)
+}
+
+// decoderMaxSize limits the amount of bytes passed to decoders
+const decoderMaxSize = 16 << 20
+
+var decoders = []decoder{
+	{"protobuf", decodeProtobuf},
+	{"asn1", decodeASN1},
+	{"cbor", decodeCBOR},
+	{"msgpack", decodeMsgpack},
+}
+
+// decoderMaxDepth limits the nesting of items decoded by decodeItems
+const decoderMaxDepth = 256
+
+// decodeItems decodes consecutive items of a self-describing encoding in b,
+// which starts at offset in the file. item decodes the item at pos, nested
+// in depth containers, returning its node and the position after it.
+func decodeItems(b []byte, offset int64, item func(pos, depth int) (*node, int, error)) ([]*node, error) {
+	var nodes []*node
+	pos := 0
+	for pos < len(b) {
+		n, end, err := item(pos, 0)
+		if err != nil {
+			trailing := &node{
+				name:  "Trailing data",
+				value: formatBytes(b[pos:]),
+				start: offset + int64(pos),
+				end:   offset + int64(len(b)),
+			}
+			if len(nodes) == 0 {
+				return []*node{trailing}, err
+			}
+			return append(nodes, trailing), nil
+		}
+		nodes = append(nodes, n)
+		pos = end
+	}
+	return nodes, nil
+}
+
+// mapEntry returns a node for an entry of a map, named by its key
+func mapEntry(key, value *node) *node {
+	return &node{
+		name:     key.value,
+		value:    value.value,
+		start:    key.start,
+		end:      value.end,
+		children: value.children,
+	}
+}
+
+// findDecoder returns the decoder with the given name, ignoring case
+func findDecoder(name string) *decoder {
+	for i := range decoders {
+		if strings.EqualFold(decoders[i].name, name) {
+			return &decoders[i]
+		}
+	}
+	return nil
+}
+
+// completeDecoder returns the names of decoders starting with text
+func completeDecoder(text string) []string {
+	var names []string
+	for _, d := range decoders {
+		if strings.HasPrefix(d.name, strings.ToLower(text)) {
+			names = append(names, d.name)
+		}
+	}
+	return names
+}
+
+// findFormat returns the format with the given name, ignoring case
+func findFormat(name string) *format {
+	for i := range formats {
+		if strings.EqualFold(formats[i].name, name) {
+			return &formats[i]
+		}
+	}
+	return nil
+}
+
+// shiftNode moves the ranges of n and its descendants by offset
+func shiftNode(n *node, offset int64) {
+	n.start += offset
+	n.end += offset
+	for _, c := range n.children {
+		shiftNode(c, offset)
+	}
+}
+
+// structField describes a field of a fixed layout structure. fields of up
+// to 8 bytes are integers, which may be formatted by format, larger fields
+// are byte arrays.
+type structField struct {
+	name   string
+	size   int
+	format func(v uint64) string
+}
+
+// readFields decodes consecutive fields at offset, returning
+// a node for each field and the values of all integer fields
+func readFields(r io.ReaderAt, offset int64, order binary.ByteOrder, fields []structField) ([]*node, map[string]uint64, error) {
+	size := 0
+	for _, f := range fields {
+		size += f.size
+	}
+	b := make([]byte, size)
+	if _, err := r.ReadAt(b, offset); err != nil {
+		return nil, nil, fmt.Errorf("cannot read %d bytes at %08X: %v", size, offset, err)
+	}
+
+	nodes := make([]*node, 0, len(fields))
+	values := map[string]uint64{}
+	pos := 0
+	for _, f := range fields {
+		n := &node{name: f.name, start: offset + int64(pos), end: offset + int64(pos+f.size)}
+		if f.size > 8 {
+			n.value = formatBytes(b[pos : pos+f.size])
+		} else {
+			v := getUint(b[pos:], f.size, order)
+			values[f.name] = v
+			n.value = fmt.Sprintf("%d (0x%X)", v, v)
+			if f.format != nil {
+				n.value = fmt.Sprintf("%s (0x%X)", f.format(v), v)
+			}
+		}
+		nodes = append(nodes, n)
+		pos += f.size
+	}
+	return nodes, values, nil
+}
+
+// group returns a node containing children, covering the range of all children
+func group(name, value string, children []*node) *node {
+	n := &node{name: name, value: value, children: children}
+	for i, c := range children {
+		if i == 0 || c.start < n.start {
+			n.start = c.start
+		}
+		if i == 0 || c.end > n.end {
+			n.end = c.end
+		}
+	}
+	return n
+}
+
+// readCString reads a null-terminated string of up to max bytes at offset
+func readCString(r io.ReaderAt, offset int64, max int) string {
+	b := make([]byte, max)
+	n, _ := r.ReadAt(b, offset)
+	b = b[:n]
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// readString reads n bytes at offset as a string, shorter at the end of the file
+func readString(r io.ReaderAt, offset int64, n int) string {
+	b := make([]byte, n)
+	n, _ = r.ReadAt(b, offset)
+	return string(b[:n])
+}
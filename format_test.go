@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// findNode returns the first node named name in a depth first search
+func findNode(nodes []*node, name string) *node {
+	for _, n := range nodes {
+		if n.name == name {
+			return n
+		}
+		if c := findNode(n.children, name); c != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// parseValid parses a valid sample, which must decode without error
+func parseValid(t *testing.T, parse func(r io.ReaderAt, size int64) ([]*node, error), b []byte) []*node {
+	nodes, err := parse(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nodes
+}
+
+// parseTruncated parses every prefix of a valid sample, which may fail with
+// an error but must not panic
+func parseTruncated(t *testing.T, parse func(r io.ReaderAt, size int64) ([]*node, error), b []byte) {
+	for n := len(b) - 1; n >= 0; n-- {
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					t.Fatalf("parsing first %d of %d bytes panics: %v", n, len(b), err)
+				}
+			}()
+			parse(bytes.NewReader(b[:n]), int64(n))
+		}()
+	}
+}
+
+// parseCorrupt parses a valid sample with each byte in turn set to 0xFF,
+// which may fail with an error but must not panic
+func parseCorrupt(t *testing.T, parse func(r io.ReaderAt, size int64) ([]*node, error), b []byte) {
+	for i := range b {
+		c := append([]byte(nil), b...)
+		c[i] = 0xFF
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					t.Fatalf("parsing with byte %X corrupt panics: %v", i, err)
+				}
+			}()
+			parse(bytes.NewReader(c), int64(len(c)))
+		}()
+	}
+}
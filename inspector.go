@@ -0,0 +1,422 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell"
+)
+
+// this file contains the data inspector panel, which interprets
+// the bytes under the cursor as a number of generic data types
+
+type inspectorPanel struct {
+	a         *editorArea
+	bigEndian bool // byte order used for multi-byte types
+	row       int  // selected row
+}
+
+type inspectorType struct {
+	name   string
+	size   int // minimum amount of bytes needed to decode a value
+	decode func(b []byte, order binary.ByteOrder) string
+	encode func(s string, order binary.ByteOrder) ([]byte, error)
+}
+
+// inspectorSize is the maximum amount of bytes needed by any inspector type
+const inspectorSize = 16
+
+var inspectorTypes = []inspectorType{
+	intType("int8", 1, true),
+	intType("uint8", 1, false),
+	intType("int16", 2, true),
+	intType("uint16", 2, false),
+	intType("int32", 4, true),
+	intType("uint32", 4, false),
+	intType("int64", 8, true),
+	intType("uint64", 8, false),
+	{"float16", 2, func(b []byte, order binary.ByteOrder) string {
+		return strconv.FormatFloat(float16(order.Uint16(b)), 'g', -1, 32)
+	}, func(s string, order binary.ByteOrder) ([]byte, error) {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.Abs(v) > 65504 && !math.IsInf(v, 0) {
+			return nil, fmt.Errorf("invalid float16 value \"%s\"", s)
+		}
+		return putUint(uint64(toFloat16(v)), 2, order), nil
+	}},
+	{"float32", 4, func(b []byte, order binary.ByteOrder) string {
+		return strconv.FormatFloat(float64(math.Float32frombits(order.Uint32(b))), 'g', -1, 32)
+	}, func(s string, order binary.ByteOrder) ([]byte, error) {
+		v, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float32 value \"%s\"", s)
+		}
+		return putUint(uint64(math.Float32bits(float32(v))), 4, order), nil
+	}},
+	{"float64", 8, func(b []byte, order binary.ByteOrder) string {
+		return strconv.FormatFloat(math.Float64frombits(order.Uint64(b)), 'g', -1, 64)
+	}, func(s string, order binary.ByteOrder) ([]byte, error) {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float64 value \"%s\"", s)
+		}
+		return putUint(math.Float64bits(v), 8, order), nil
+	}},
+	{"binary", 1, func(b []byte, order binary.ByteOrder) string {
+		return fmt.Sprintf("%08b", b[0])
+	}, func(s string, order binary.ByteOrder) ([]byte, error) {
+		v, err := strconv.ParseUint(s, 2, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid binary value \"%s\" (00000000 to 11111111)", s)
+		}
+		return []byte{byte(v)}, nil
+	}},
+	{"octal", 1, func(b []byte, order binary.ByteOrder) string {
+		return fmt.Sprintf("%03o", b[0])
+	}, func(s string, order binary.ByteOrder) ([]byte, error) {
+		v, err := strconv.ParseUint(s, 8, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid octal value \"%s\" (000 to 377)", s)
+		}
+		return []byte{byte(v)}, nil
+	}},
+	{"time_t32", 4, func(b []byte, order binary.ByteOrder) string {
+		return formatTime(time.Unix(int64(int32(order.Uint32(b))), 0))
+	}, func(s string, order binary.ByteOrder) ([]byte, error) {
+		t, err := parseTime(s)
+		if err != nil || t.Unix() < math.MinInt32 || t.Unix() > math.MaxInt32 {
+			return nil, fmt.Errorf("invalid time_t32 value \"%s\" (1901-12-13 20:45:52 to 2038-01-19 03:14:07)", s)
+		}
+		return putUint(uint64(t.Unix()), 4, order), nil
+	}},
+	{"time_t64", 8, func(b []byte, order binary.ByteOrder) string {
+		v := int64(order.Uint64(b))
+		if v < minUnixTime || v > maxUnixTime {
+			return "invalid"
+		}
+		return formatTime(time.Unix(v, 0))
+	}, func(s string, order binary.ByteOrder) ([]byte, error) {
+		t, err := parseTime(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time_t64 value \"%s\"", s)
+		}
+		return putUint(uint64(t.Unix()), 8, order), nil
+	}},
+	{"FILETIME", 8, func(b []byte, order binary.ByteOrder) string {
+		// 100 nanosecond intervals since 1601-01-01
+		v := order.Uint64(b)
+		s := int64(v/1e7) - 11644473600
+		if s > maxUnixTime {
+			return "invalid"
+		}
+		return formatTime(time.Unix(s, int64(v%1e7)*100))
+	}, func(s string, order binary.ByteOrder) ([]byte, error) {
+		t, err := parseTime(s)
+		if err != nil || t.Unix() < -11644473600 {
+			return nil, fmt.Errorf("invalid FILETIME value \"%s\" (1601-01-01 00:00:00 to 9999-12-31 23:59:59)", s)
+		}
+		return putUint(uint64(t.Unix()+11644473600)*1e7+uint64(t.Nanosecond()/100), 8, order), nil
+	}},
+	{"DOS time", 4, func(b []byte, order binary.ByteOrder) string {
+		// date in upper word, time in lower word
+		v := order.Uint32(b)
+		d, t := v>>16, v&0xFFFF
+		return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d",
+			1980+d>>9, d>>5&0xF, d&0x1F, t>>11, t>>5&0x3F, t&0x1F*2)
+	}, func(s string, order binary.ByteOrder) ([]byte, error) {
+		t, err := parseTime(s)
+		if err != nil || t.Year() < 1980 || t.Year() > 2107 {
+			return nil, fmt.Errorf("invalid DOS time value \"%s\" (1980-01-01 00:00:00 to 2107-12-31 23:59:58)", s)
+		}
+		d := uint32(t.Year()-1980)<<9 | uint32(t.Month())<<5 | uint32(t.Day())
+		c := uint32(t.Hour())<<11 | uint32(t.Minute())<<5 | uint32(t.Second()/2)
+		return putUint(uint64(d<<16|c), 4, order), nil
+	}},
+	{"GUID", 16, func(b []byte, order binary.ByteOrder) string {
+		// first three fields use selected byte order, rest is a byte array
+		return fmt.Sprintf("%08X-%04X-%04X-%X-%X",
+			order.Uint32(b), order.Uint16(b[4:]), order.Uint16(b[6:]), b[8:10], b[10:16])
+	}, func(s string, order binary.ByteOrder) ([]byte, error) {
+		parts := strings.Split(strings.Trim(s, "{}"), "-")
+		if len(parts) != 5 {
+			return nil, fmt.Errorf("invalid GUID value \"%s\"", s)
+		}
+		b, err := hex.DecodeString(strings.Join(parts, ""))
+		if err != nil || len(b) != 16 || len(parts[0]) != 8 || len(parts[1]) != 4 || len(parts[2]) != 4 {
+			return nil, fmt.Errorf("invalid GUID value \"%s\"", s)
+		}
+		order.PutUint32(b, binary.BigEndian.Uint32(b))
+		order.PutUint16(b[4:], binary.BigEndian.Uint16(b[4:]))
+		order.PutUint16(b[6:], binary.BigEndian.Uint16(b[6:]))
+		return b, nil
+	}},
+	{"ULEB128", 1, func(b []byte, order binary.ByteOrder) string {
+		v, n := uleb128(b)
+		if n <= 0 {
+			return "invalid"
+		}
+		return fmt.Sprintf("%d (%d bytes)", v, n)
+	}, func(s string, order binary.ByteOrder) ([]byte, error) {
+		v, err := strconv.ParseUint(leadingValue(s), 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ULEB128 value \"%s\" (0 to %d)", s, uint64(math.MaxUint64))
+		}
+		return binary.AppendUvarint(nil, v), nil
+	}},
+	{"SLEB128", 1, func(b []byte, order binary.ByteOrder) string {
+		v, n := sleb128(b)
+		if n <= 0 {
+			return "invalid"
+		}
+		return fmt.Sprintf("%d (%d bytes)", v, n)
+	}, func(s string, order binary.ByteOrder) ([]byte, error) {
+		v, err := strconv.ParseInt(leadingValue(s), 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SLEB128 value \"%s\" (%d to %d)", s, math.MinInt64, math.MaxInt64)
+		}
+		return putSleb128(v), nil
+	}},
+	{"varint", 1, func(b []byte, order binary.ByteOrder) string {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return "invalid"
+		}
+		return fmt.Sprintf("%d zigzag %d (%d bytes)", v, int64(v>>1)^-int64(v&1), n)
+	}, func(s string, order binary.ByteOrder) ([]byte, error) {
+		v, err := strconv.ParseUint(leadingValue(s), 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid varint value \"%s\" (0 to %d)", s, uint64(math.MaxUint64))
+		}
+		return binary.AppendUvarint(nil, v), nil
+	}},
+}
+
+// leadingValue returns the first word of s, as the prompt for editing a
+// value starts with its decoded text, such as "300 (2 bytes)"
+func leadingValue(s string) string {
+	if words := strings.Fields(s); len(words) > 0 {
+		return words[0]
+	}
+	return s
+}
+
+// intType returns an inspector type for an integer of the given size in bytes
+func intType(name string, size int, signed bool) inspectorType {
+	bits := size * 8
+	return inspectorType{name, size, func(b []byte, order binary.ByteOrder) string {
+		v := getUint(b, size, order)
+		if signed {
+			// sign extend value to 64 bits
+			return strconv.FormatInt(int64(v<<(64-bits))>>(64-bits), 10)
+		}
+		return strconv.FormatUint(v, 10)
+	}, func(s string, order binary.ByteOrder) ([]byte, error) {
+		if signed {
+			v, err := strconv.ParseInt(s, 0, bits)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s value \"%s\" (%d to %d)", name, s, -1<<(bits-1), 1<<(bits-1)-1)
+			}
+			return putUint(uint64(v), size, order), nil
+		}
+		v, err := strconv.ParseUint(s, 0, bits)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value \"%s\" (0 to %d)", name, s, ^uint64(0)>>(64-bits))
+		}
+		return putUint(v, size, order), nil
+	}}
+}
+
+// range of unix times that can be formatted with a four digit year
+const (
+	minUnixTime = -62135596800
+	maxUnixTime = 253402300799
+)
+
+func (p *inspectorPanel) order() binary.ByteOrder {
+	if p.bigEndian {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+func (p *inspectorPanel) title() string {
+	if p.bigEndian {
+		return "Inspector (big endian)"
+	}
+	return "Inspector (little endian)"
+}
+
+func (p *inspectorPanel) draw(o obj, focused bool) {
+	b := p.a.readAt(p.a.cursor(), inspectorSize)
+	for i, t := range inspectorTypes {
+		value := "-"
+		if len(b) >= t.size {
+			value = t.decode(b, p.order())
+		}
+		drawRow(o, i, fmt.Sprintf("%-9s %s", t.name, value), focused && i == p.row)
+	}
+	for i := len(inspectorTypes); i < o.h; i++ {
+		drawRow(o, i, "", false)
+	}
+}
+
+func (p *inspectorPanel) onEvent(ev tcell.Event) error {
+	switch v := ev.(type) {
+	case *tcell.EventKey:
+		switch v.Key() {
+		case tcell.KeyUp:
+			// select previous row
+			p.row = max(p.row-1, 0)
+		case tcell.KeyDown:
+			// select next row
+			p.row = min(p.row+1, len(inspectorTypes)-1)
+		case tcell.KeyRune:
+			switch v.Rune() {
+			case 'e':
+				// toggle byte order
+				p.bigEndian = !p.bigEndian
+			}
+		case tcell.KeyEnter:
+			// edit value of selected row at cursor
+			t, order, offset := inspectorTypes[p.row], p.order(), p.a.cursor()
+			value := ""
+			if b := p.a.readAt(offset, inspectorSize); len(b) >= t.size {
+				value = t.decode(b, order)
+			}
+			return app.prompt(t.name+": ", value, func(s string) error {
+				b, err := t.encode(strings.TrimSpace(s), order)
+				if err != nil {
+					return err
+				}
+				return p.a.write(offset, b)
+			})
+		}
+	}
+	return nil
+}
+
+// float16 converts an IEEE 754 half precision float to a float64
+func float16(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp, frac := int(h>>10&0x1F), float64(h&0x3FF)
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 0x1F:
+		if frac != 0 {
+			return math.NaN()
+		}
+		return math.Inf(int(sign))
+	}
+	return sign * math.Ldexp(frac+0x400, exp-25)
+}
+
+// uleb128 decodes an unsigned LEB128 value, returning the value
+// and the amount of bytes read, or zero bytes if b is invalid
+func uleb128(b []byte) (uint64, int) {
+	var v uint64
+	for i, c := range b {
+		if i == 10 {
+			break
+		}
+		v |= uint64(c&0x7F) << (7 * uint(i))
+		if c&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// sleb128 decodes a signed LEB128 value, returning the value
+// and the amount of bytes read, or zero bytes if b is invalid
+func sleb128(b []byte) (int64, int) {
+	v, n := uleb128(b)
+	if n == 0 {
+		return 0, 0
+	}
+	if shift := 7 * uint(n); shift < 64 && b[n-1]&0x40 != 0 {
+		v |= ^uint64(0) << shift
+	}
+	return int64(v), n
+}
+
+// toFloat16 converts a float64 to the nearest IEEE 754 half precision float
+func toFloat16(f float64) uint16 {
+	bits := math.Float32bits(float32(f))
+	sign := uint16(bits >> 16 & 0x8000)
+	exp := int(bits>>23&0xFF) - 127 + 15
+	frac := bits & 0x7FFFFF
+	switch {
+	case math.IsNaN(f):
+		return 0x7E00
+	case exp >= 0x1F:
+		// overflow to infinity
+		return sign | 0x7C00
+	case exp <= 0:
+		// subnormal or zero
+		if exp < -10 {
+			return sign
+		}
+		frac |= 0x800000
+		shift := uint(14 - exp)
+		return sign | uint16((frac+1<<(shift-1))>>shift)
+	}
+	// round to nearest, carry may overflow into exponent
+	return sign | (uint16(exp)<<10 + uint16((frac+0x1000)>>13))
+}
+
+// getUint reads an unsigned integer of size bytes from b
+func getUint(b []byte, size int, order binary.ByteOrder) uint64 {
+	var v uint64
+	for i := 0; i < size; i++ {
+		if order == binary.BigEndian {
+			v = v<<8 | uint64(b[i])
+		} else {
+			v |= uint64(b[i]) << (8 * uint(i))
+		}
+	}
+	return v
+}
+
+// putUint encodes an unsigned integer as size bytes
+func putUint(v uint64, size int, order binary.ByteOrder) []byte {
+	b := make([]byte, size)
+	for i := 0; i < size; i++ {
+		if order == binary.BigEndian {
+			b[size-1-i] = byte(v >> (8 * uint(i)))
+		} else {
+			b[i] = byte(v >> (8 * uint(i)))
+		}
+	}
+	return b
+}
+
+// putSleb128 encodes a signed LEB128 value
+func putSleb128(v int64) []byte {
+	var b []byte
+	for {
+		c := byte(v & 0x7F)
+		v >>= 7
+		if v == 0 && c&0x40 == 0 || v == -1 && c&0x40 != 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05.999999999")
+}
+
+// parseTime parses a time formatted by formatTime
+func parseTime(s string) (time.Time, error) {
+	return time.Parse("2006-01-02 15:04:05", strings.TrimSpace(s))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+func findInspectorType(t *testing.T, name string) inspectorType {
+	for _, typ := range inspectorTypes {
+		if typ.name == name {
+			return typ
+		}
+	}
+	t.Fatalf("unknown inspector type %s", name)
+	return inspectorType{}
+}
+
+func TestInspectorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		bytes string // hex encoded, the value may be shorter
+		value string // decoded little endian
+	}{
+		{"int8", "80", "-128"},
+		{"uint8", "FF", "255"},
+		{"int16", "FEFF", "-2"},
+		{"uint16", "3412", "4660"},
+		{"int32", "00000080", "-2147483648"},
+		{"uint32", "78563412", "305419896"},
+		{"int64", "FFFFFFFFFFFFFF7F", "9223372036854775807"},
+		{"uint64", "FFFFFFFFFFFFFFFF", "18446744073709551615"},
+		{"float16", "003C", "1"},
+		{"float16", "0100", "5.9604645e-08"},
+		{"float32", "0000C0BF", "-1.5"},
+		{"float64", "182D4454FB210940", "3.141592653589793"},
+		{"binary", "A5", "10100101"},
+		{"octal", "FF", "377"},
+		{"time_t32", "00000080", "1901-12-13 20:45:52"},
+		{"time_t64", "00E10B5E00000000", "2020-01-01 00:00:00"},
+		{"FILETIME", "0100056936C0D501", "2020-01-01 00:00:00.0000001"},
+		{"DOS time", "00005050", "2020-02-16 00:00:00"},
+		{"GUID", "33221100554477668899AABBCCDDEEFF", "00112233-4455-6677-8899-AABBCCDDEEFF"},
+		{"ULEB128", "E58E26", "624485 (3 bytes)"},
+		{"SLEB128", "C0BB78", "-123456 (3 bytes)"},
+		{"varint", "AC02", "300 zigzag 150 (2 bytes)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name+" "+test.value, func(t *testing.T) {
+			typ := findInspectorType(t, test.name)
+			b, _ := hex.DecodeString(test.bytes)
+			b = append(b, make([]byte, inspectorSize)...)
+			if v := typ.decode(b, binary.LittleEndian); v != test.value {
+				t.Fatalf("decoded %q, want %q", v, test.value)
+			}
+			encoded, err := typ.encode(test.value, binary.LittleEndian)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, _ := hex.DecodeString(test.bytes); !bytes.Equal(encoded, want[:min(len(want), len(encoded))]) || len(encoded) < typ.size {
+				t.Fatalf("encoded % X, want % X", encoded, want)
+			}
+
+			// values in big endian are encoded in reverse
+			big, err := typ.encode(typ.decode(b, binary.LittleEndian), binary.BigEndian)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v := typ.decode(append(big, make([]byte, inspectorSize)...), binary.BigEndian); v != test.value {
+				t.Fatalf("decoded %q in big endian, want %q", v, test.value)
+			}
+		})
+	}
+}
+
+func TestInspectorInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"int8", "128"},
+		{"uint16", "-1"},
+		{"float16", "70000"},
+		{"binary", "102"},
+		{"time_t32", "2038-01-19 03:14:08"},
+		{"DOS time", "1979-12-31 23:59:59"},
+		{"GUID", "00112233-4455-6677-8899"},
+		{"ULEB128", "-1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name+" "+test.value, func(t *testing.T) {
+			typ := findInspectorType(t, test.name)
+			if b, err := typ.encode(test.value, binary.LittleEndian); err == nil {
+				t.Fatalf("encoded invalid value as % X", b)
+			}
+		})
+	}
+}
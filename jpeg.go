@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// this file contains the JPEG format, with EXIF metadata in APP1 segments
+
+const jpegMaxSegments = 1 << 16
+
+var jpegMarkers = map[byte]string{
+	0x01: "TEM",
+	0xC0: "SOF0",
+	0xC1: "SOF1",
+	0xC2: "SOF2",
+	0xC3: "SOF3",
+	0xC4: "DHT",
+	0xC5: "SOF5",
+	0xC6: "SOF6",
+	0xC7: "SOF7",
+	0xC8: "JPG",
+	0xC9: "SOF9",
+	0xCA: "SOF10",
+	0xCB: "SOF11",
+	0xCC: "DAC",
+	0xCD: "SOF13",
+	0xCE: "SOF14",
+	0xCF: "SOF15",
+	0xD8: "SOI",
+	0xD9: "EOI",
+	0xDA: "SOS",
+	0xDB: "DQT",
+	0xDC: "DNL",
+	0xDD: "DRI",
+	0xDE: "DHP",
+	0xDF: "EXP",
+	0xFE: "COM",
+}
+
+func detectJPEG(head []byte) bool {
+	return bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF})
+}
+
+func parseJPEG(r io.ReaderAt, size int64) ([]*node, error) {
+	var nodes []*node
+	pos := int64(0)
+	for i := 0; pos+2 <= size; i++ {
+		if i == jpegMaxSegments {
+			return nodes, fmt.Errorf("showing the first %d segments", jpegMaxSegments)
+		}
+		b := make([]byte, 4)
+		n, _ := r.ReadAt(b, pos)
+		if b[0] != 0xFF {
+			break
+		}
+		m := b[1]
+		if m == 0xFF {
+			// markers may be preceded by fill bytes
+			pos++
+			i--
+			continue
+		}
+		name := jpegMarkerName(m)
+		marker := &node{name: "marker", value: fmt.Sprintf("0x%02X %s", m, name), start: pos, end: pos + 2}
+
+		// markers without a segment
+		if m == 0x01 || m >= 0xD0 && m <= 0xD9 {
+			nodes = append(nodes, &node{name: fmt.Sprintf("[%d] %s", i, name), start: pos, end: pos + 2, children: []*node{marker}})
+			pos += 2
+			if m == 0xD9 {
+				break
+			}
+			continue
+		}
+		if n < 4 {
+			return nodes, fmt.Errorf("segment %s at %08X is truncated", name, pos)
+		}
+		length := int64(binary.BigEndian.Uint16(b[2:]))
+		if length < 2 || pos+2+length > size {
+			return nodes, fmt.Errorf("segment %s at %08X is truncated", name, pos)
+		}
+		start, end := pos+4, pos+2+length
+		segment := &node{
+			name:  fmt.Sprintf("[%d] %s", i, name),
+			value: fmt.Sprintf("%d bytes", length),
+			start: pos,
+			end:   end,
+			children: []*node{
+				marker,
+				{name: "length", value: fmt.Sprintf("%d (0x%X)", length, length), start: pos + 2, end: pos + 4},
+			},
+		}
+		data := make([]byte, end-start)
+		if _, err := r.ReadAt(data, start); err != nil {
+			return nodes, err
+		}
+		fields, value := jpegSegment(r, m, data, start)
+		if fields == nil {
+			fields = []*node{{name: "data", value: fmt.Sprintf("%d bytes", len(data)), start: start, end: end}}
+		}
+		if value != "" {
+			segment.value = value
+		}
+		segment.children = append(segment.children, fields...)
+		nodes = append(nodes, segment)
+		pos = end
+
+		if m == 0xDA {
+			// entropy coded data follows the scan header, up to the next
+			// marker that is not a restart marker or stuffed zero
+			scan := jpegScanEnd(r, pos, size)
+			nodes = append(nodes, &node{name: "Entropy coded data", value: fmt.Sprintf("%d bytes", scan-pos), start: pos, end: scan})
+			pos = scan
+		}
+	}
+	if pos < size {
+		nodes = append(nodes, &node{name: "Trailing data", value: fmt.Sprintf("%d bytes", size-pos), start: pos, end: size})
+	}
+	return nodes, nil
+}
+
+// jpegSegment decodes the data of a segment with marker m at offset,
+// returning its fields and a summary
+func jpegSegment(r io.ReaderAt, m byte, b []byte, offset int64) ([]*node, string) {
+	field := func(name string, pos, size int, value string) *node {
+		return &node{name: name, value: value, start: offset + int64(pos), end: offset + int64(pos+size)}
+	}
+	number := func(name string, pos, size int) *node {
+		v := getUint(b[pos:], size, binary.BigEndian)
+		return field(name, pos, size, fmt.Sprintf("%d (0x%X)", v, v))
+	}
+	switch {
+	case m == 0xE0 && bytes.HasPrefix(b, []byte("JFIF\x00")) && len(b) >= 14:
+		return []*node{
+			field("identifier", 0, 5, fmt.Sprintf("%q", b[:5])),
+			field("version", 5, 2, fmt.Sprintf("%d.%02d", b[5], b[6])),
+			field("units", 7, 1, [...]string{"none", "dots per inch", "dots per cm", "unknown"}[min(int(b[7]), 3)]),
+			number("x density", 8, 2),
+			number("y density", 10, 2),
+			number("thumbnail width", 12, 1),
+			number("thumbnail height", 13, 1),
+		}, "JFIF"
+	case m == 0xE1 && bytes.HasPrefix(b, []byte("Exif\x00")) && len(b) >= 14:
+		// a TIFF structure follows the identifier and padding
+		ifds, err := tiffNodes(r, offset+6, int64(len(b)-6))
+		t := &node{name: "TIFF", start: offset + 6, end: offset + int64(len(b)), children: ifds}
+		if err != nil {
+			t.value = err.Error()
+		}
+		return []*node{field("identifier", 0, 6, fmt.Sprintf("%q", b[:6])), t}, "EXIF"
+	case m == 0xE1 && bytes.HasPrefix(b, []byte("http://ns.adobe.com/xap/1.0/\x00")):
+		id := len("http://ns.adobe.com/xap/1.0/\x00")
+		return []*node{
+			field("identifier", 0, id, fmt.Sprintf("%q", b[:id])),
+			field("XMP", id, len(b)-id, fmt.Sprintf("%d bytes", len(b)-id)),
+		}, "XMP"
+	case m >= 0xE0 && m <= 0xEF:
+		// other application segments start with an identifier string
+		if i := bytes.IndexByte(b, 0); i > 0 && printable(b[:i]) {
+			return []*node{
+				field("identifier", 0, i+1, fmt.Sprintf("%q", b[:i])),
+				field("data", i+1, len(b)-i-1, fmt.Sprintf("%d bytes", len(b)-i-1)),
+			}, fmt.Sprintf("%q", b[:i])
+		}
+	case m == 0xFE:
+		return []*node{field("comment", 0, len(b), fmt.Sprintf("%q", b))}, fmt.Sprintf("%q", b)
+	case m == 0xDB:
+		// quantization tables of 64 bytes or 64 words
+		var tables []*node
+		for pos := 0; pos < len(b); {
+			size := 1 + 64*(1+int(b[pos]>>4))
+			if pos+size > len(b) {
+				return nil, ""
+			}
+			tables = append(tables, group(fmt.Sprintf("table %d", b[pos]&0x0F), fmt.Sprintf("%d bit", 8<<(b[pos]>>4)), []*node{
+				field("precision and id", pos, 1, fmt.Sprintf("0x%02X", b[pos])),
+				field("values", pos+1, size-1, fmt.Sprintf("%d bytes", size-1)),
+			}))
+			pos += size
+		}
+		return tables, fmt.Sprintf("%d tables", len(tables))
+	case m == 0xC4:
+		// huffman tables have 16 code length counts followed by the symbols
+		var tables []*node
+		for pos := 0; pos < len(b); {
+			if pos+17 > len(b) {
+				return nil, ""
+			}
+			count := 0
+			for _, c := range b[pos+1 : pos+17] {
+				count += int(c)
+			}
+			if pos+17+count > len(b) {
+				return nil, ""
+			}
+			class := "DC"
+			if b[pos]>>4 != 0 {
+				class = "AC"
+			}
+			tables = append(tables, group(fmt.Sprintf("%s table %d", class, b[pos]&0x0F), fmt.Sprintf("%d symbols", count), []*node{
+				field("class and id", pos, 1, fmt.Sprintf("0x%02X", b[pos])),
+				field("code lengths", pos+1, 16, formatBytes(b[pos+1:pos+17])),
+				field("symbols", pos+17, count, fmt.Sprintf("%d bytes", count)),
+			}))
+			pos += 17 + count
+		}
+		return tables, fmt.Sprintf("%d tables", len(tables))
+	case m >= 0xC0 && m <= 0xCF && m != 0xC4 && m != 0xC8 && m != 0xCC:
+		if len(b) < 6 || len(b) < 6+3*int(b[5]) {
+			return nil, ""
+		}
+		fields := []*node{number("precision", 0, 1), number("height", 1, 2), number("width", 3, 2), number("components", 5, 1)}
+		for i := 0; i < int(b[5]); i++ {
+			p := 6 + 3*i
+			fields = append(fields, group(fmt.Sprintf("component %d", b[p]), "", []*node{
+				number("id", p, 1),
+				field("sampling", p+1, 1, fmt.Sprintf("%dx%d", b[p+1]>>4, b[p+1]&0x0F)),
+				number("quantization table", p+2, 1),
+			}))
+		}
+		return fields, fmt.Sprintf("%dx%d, %d components", binary.BigEndian.Uint16(b[3:]), binary.BigEndian.Uint16(b[1:]), b[5])
+	case m == 0xDA:
+		if len(b) < 1 || len(b) < 4+2*int(b[0]) {
+			return nil, ""
+		}
+		fields := []*node{number("components", 0, 1)}
+		for i := 0; i < int(b[0]); i++ {
+			p := 1 + 2*i
+			fields = append(fields, group(fmt.Sprintf("component %d", b[p]), "", []*node{
+				number("id", p, 1),
+				field("tables", p+1, 1, fmt.Sprintf("DC %d, AC %d", b[p+1]>>4, b[p+1]&0x0F)),
+			}))
+		}
+		p := 1 + 2*int(b[0])
+		fields = append(fields, number("spectral start", p, 1), number("spectral end", p+1, 1),
+			field("approximation", p+2, 1, fmt.Sprintf("high %d, low %d", b[p+2]>>4, b[p+2]&0x0F)))
+		return fields, fmt.Sprintf("%d components", b[0])
+	case m == 0xDD && len(b) >= 2:
+		return []*node{number("restart interval", 0, 2)}, ""
+	}
+	return nil, ""
+}
+
+// jpegScanEnd returns the offset of the marker ending the entropy coded data
+// at pos
+func jpegScanEnd(r io.ReaderAt, pos, size int64) int64 {
+	b := make([]byte, 64<<10)
+	for pos < size {
+		n, _ := r.ReadAt(b, pos)
+		if n < 2 {
+			return size
+		}
+		for i := 0; i < n-1; i++ {
+			if b[i] == 0xFF && b[i+1] != 0 && b[i+1] != 0xFF && (b[i+1] < 0xD0 || b[i+1] > 0xD7) {
+				return pos + int64(i)
+			}
+		}
+		pos += int64(n - 1)
+	}
+	return size
+}
+
+// jpegMarkerName returns the name of marker m
+func jpegMarkerName(m byte) string {
+	switch {
+	case m >= 0xD0 && m <= 0xD7:
+		return fmt.Sprintf("RST%d", m-0xD0)
+	case m >= 0xE0 && m <= 0xEF:
+		return fmt.Sprintf("APP%d", m-0xE0)
+	}
+	if name, ok := jpegMarkers[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%02X", m)
+}
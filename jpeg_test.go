@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+// jpegTestFile returns an encoded 8x8 image with an EXIF segment holding
+// the TIFF structure of tiffTestFile
+func jpegTestFile(t *testing.T) []byte {
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	exif := append([]byte("Exif\x00\x00"), tiffTestFile()...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(exif)+2))
+	return append(append(append([]byte{}, b.Bytes()[:2]...), append(app1, exif...)...), b.Bytes()[2:]...)
+}
+
+func TestJPEG(t *testing.T) {
+	nodes := parseValid(t, parseJPEG, jpegTestFile(t))
+	if n := findNode(nodes, "[1] APP1"); n == nil || n.value != "EXIF" || findNode(n.children, "Make") == nil {
+		t.Fatal("EXIF segment not decoded")
+	}
+	if findNode(nodes, "Entropy coded data") == nil || nodes[len(nodes)-1].name == "Trailing data" {
+		t.Fatal("scan not decoded up to the end of the image")
+	}
+}
+
+func TestJPEGTruncated(t *testing.T) {
+	parseTruncated(t, parseJPEG, jpegTestFile(t))
+}
+
+func TestJPEGCorrupt(t *testing.T) {
+	parseCorrupt(t, parseJPEG, jpegTestFile(t))
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// this file contains support for Kaitai Struct (.ksy) format descriptions,
+// which are converted to structure templates. bit-sized integers, processing
+// of data, parametric types and terminators other than of strings by 0 are not
+// supported.
+
+type ksyType struct {
+	Meta      ksyMeta                                `yaml:"meta"`
+	Seq       []ksyAttr                              `yaml:"seq"`
+	Instances yaml.MapSlice                          `yaml:"instances"`
+	Types     map[string]ksyType                     `yaml:"types"`
+	Enums     map[string]map[interface{}]interface{} `yaml:"enums"`
+}
+
+type ksyMeta struct {
+	ID       string      `yaml:"id"`
+	Endian   interface{} `yaml:"endian"` // "le", "be" or a switch, which is not supported
+	Encoding string      `yaml:"encoding"`
+}
+
+type ksyAttr struct {
+	ID          string      `yaml:"id"`
+	Type        interface{} `yaml:"type"` // type name or switch
+	Size        interface{} `yaml:"size"`
+	SizeEOS     bool        `yaml:"size-eos"`
+	Repeat      string      `yaml:"repeat"`
+	RepeatExpr  interface{} `yaml:"repeat-expr"`
+	RepeatUntil interface{} `yaml:"repeat-until"`
+	If          interface{} `yaml:"if"`
+	Contents    interface{} `yaml:"contents"`
+	Encoding    string      `yaml:"encoding"`
+	Terminator  interface{} `yaml:"terminator"`
+	Process     string      `yaml:"process"`
+	Enum        string      `yaml:"enum"`
+	Pos         interface{} `yaml:"pos"`
+	Value       interface{} `yaml:"value"`
+}
+
+var (
+	ksyIntType   = regexp.MustCompile(`^([us])([1248])(le|be)?$`)
+	ksyFloatType = regexp.MustCompile(`^f([48])(le|be)?$`)
+	ksyBitsType  = regexp.MustCompile(`^b[0-9]+(le|be)?$`)
+)
+
+// loadKsy reads a Kaitai Struct format description as a template
+func loadKsy(filename string) (*template, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	k := ksyType{}
+	if err := yaml.Unmarshal(b, &k); err != nil {
+		return nil, fmt.Errorf("invalid format description %s: %v", filename, err)
+	}
+	if k.Meta.ID == "" {
+		return nil, fmt.Errorf("invalid format description %s: missing meta/id", filename)
+	}
+	t := &template{
+		Root:  k.Meta.ID,
+		Types: map[string][]templateField{},
+		Enums: map[string]map[string]string{},
+	}
+	if err := k.convert(t, k.Meta.ID, "", ""); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	// types and enums are named by their path, e.g. "png::chunk", so resolve
+	// references by where they are used
+	isType := func(name string) bool { return t.Types[name] != nil }
+	isEnum := func(name string) bool { return t.Enums[name] != nil }
+	for path, fields := range t.Types {
+		for i := range fields {
+			f := &fields[i]
+			f.Type = qualifiedName(path, f.Type, isType)
+			for k, v := range f.Cases {
+				f.Cases[k] = qualifiedName(path, v, isType)
+			}
+			if f.Enum != "" {
+				f.Enum = qualifiedName(path, f.Enum, isEnum)
+			}
+		}
+	}
+	return t, nil
+}
+
+// convert adds the type and its nested types and enums to the template,
+// named by their path from the root type
+func (k *ksyType) convert(t *template, name, endian, encoding string) error {
+	// byte order and encoding are inherited by nested types
+	if e, ok := k.Meta.Endian.(string); ok {
+		endian = e
+	}
+	if k.Meta.Encoding != "" {
+		encoding = k.Meta.Encoding
+	}
+
+	// sequential fields
+	fields := []templateField{}
+	for i := range k.Seq {
+		f, err := k.Seq[i].field(endian, encoding)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %v", name, k.Seq[i].ID, err)
+		}
+		fields = append(fields, f)
+	}
+
+	// instances are fields at a position or computed values
+	for _, item := range k.Instances {
+		id := fmt.Sprint(item.Key)
+		b, err := yaml.Marshal(item.Value)
+		if err != nil {
+			return err
+		}
+		a := ksyAttr{}
+		if err := yaml.Unmarshal(b, &a); err != nil {
+			return fmt.Errorf("%s.%s: %v", name, id, err)
+		}
+		a.ID = id
+		f, err := a.field(endian, encoding)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %v", name, id, err)
+		}
+		fields = append(fields, f)
+	}
+	t.Types[name] = fields
+
+	for typeName, nested := range k.Types {
+		if err := nested.convert(t, name+"::"+typeName, endian, encoding); err != nil {
+			return err
+		}
+	}
+
+	for enumName, values := range k.Enums {
+		enum := map[string]string{}
+		for v, id := range values {
+			// values are either names or maps with an id
+			if m, ok := id.(map[interface{}]interface{}); ok {
+				id = m["id"]
+			}
+			enum[fmt.Sprint(v)] = fmt.Sprint(id)
+		}
+		t.Enums[name+"::"+enumName] = enum
+	}
+	return nil
+}
+
+// field converts an attribute to a template field
+func (a *ksyAttr) field(endian, encoding string) (templateField, error) {
+	f := templateField{
+		Name:     a.ID,
+		Endian:   endian,
+		Encoding: a.Encoding,
+		Size:     ksyExpr(a.Size),
+		If:       ksyExpr(a.If),
+		Pos:      ksyExpr(a.Pos),
+		Value:    ksyExpr(a.Value),
+		Enum:     a.Enum,
+	}
+	if f.Encoding == "" {
+		f.Encoding = encoding
+	}
+	if a.SizeEOS {
+		f.Size = "_io.size - _io.pos"
+	}
+	if a.Process != "" {
+		return f, fmt.Errorf("process %s is not supported", a.Process)
+	}
+
+	switch a.Repeat {
+	case "":
+	case "expr":
+		f.Count = ksyExpr(a.RepeatExpr)
+	case "eos":
+		f.EOS = true
+	case "until":
+		f.Until = ksyExpr(a.RepeatUntil)
+	default:
+		return f, fmt.Errorf("invalid repeat \"%s\"", a.Repeat)
+	}
+
+	if a.Contents != nil {
+		contents, err := ksyContents(a.Contents)
+		if err != nil {
+			return f, err
+		}
+		f.Contents = hex.EncodeToString(contents)
+	}
+
+	switch typ := a.Type.(type) {
+	case nil:
+		// raw bytes
+		f.Type = "bytes"
+	case string:
+		var err error
+		if f.Type, err = ksyTypeName(typ); err != nil {
+			return f, err
+		}
+		if f.Type == "str" && a.Size == nil && !a.SizeEOS {
+			// strings without size are terminated
+			f.Type = "strz"
+		}
+	case map[interface{}]interface{}:
+		// type selected by switch
+		f.Switch = ksyExpr(typ["switch-on"])
+		cases, _ := typ["cases"].(map[interface{}]interface{})
+		f.Cases = map[string]string{}
+		for k, v := range cases {
+			name, err := ksyTypeName(fmt.Sprint(v))
+			if err != nil {
+				return f, err
+			}
+			f.Cases[fmt.Sprint(k)] = name
+		}
+	default:
+		return f, fmt.Errorf("invalid type %v", typ)
+	}
+	if a.Terminator != nil && (f.Type != "strz" || a.Terminator != 0) {
+		// only strings terminated by 0 are decoded
+		return f, fmt.Errorf("terminator %v is not supported", a.Terminator)
+	}
+	return f, nil
+}
+
+// ksyTypeName converts a type name to a template type name
+func ksyTypeName(typ string) (string, error) {
+	if m := ksyIntType.FindStringSubmatch(typ); m != nil {
+		return m[1] + map[string]string{"1": "8", "2": "16", "4": "32", "8": "64"}[m[2]] + m[3], nil
+	}
+	if m := ksyFloatType.FindStringSubmatch(typ); m != nil {
+		return "f" + map[string]string{"4": "32", "8": "64"}[m[1]] + m[2], nil
+	}
+	switch {
+	case typ == "str", typ == "strz":
+		return typ, nil
+	case ksyBitsType.MatchString(typ):
+		return "", fmt.Errorf("bit-sized type \"%s\" is not supported", typ)
+	case strings.Contains(typ, "("):
+		return "", fmt.Errorf("parametric type \"%s\" is not supported", typ)
+	}
+	return typ, nil
+}
+
+// ksyContents converts fixed contents, given as a string or a list of bytes and strings
+func ksyContents(v interface{}) ([]byte, error) {
+	switch x := v.(type) {
+	case string:
+		return []byte(x), nil
+	case []interface{}:
+		var b []byte
+		for _, c := range x {
+			switch y := c.(type) {
+			case int:
+				b = append(b, byte(y))
+			case string:
+				b = append(b, y...)
+			default:
+				return nil, fmt.Errorf("invalid contents %v", c)
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("invalid contents %v", v)
+}
+
+// ksyExpr converts a scalar to an expression
+func ksyExpr(v interface{}) templateExpr {
+	if v == nil {
+		return ""
+	}
+	return templateExpr(fmt.Sprint(v))
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestKsyUnsupported(t *testing.T) {
+	tests := []struct {
+		attr string
+		typ  string // converted type, empty if not supported
+	}{
+		{"{id: a, type: str, terminator: 0}", "strz"},
+		{"{id: a, type: str, terminator: 10}", ""},
+		{"{id: a, type: str, size: 4, terminator: 0}", ""},
+		{"{id: a, terminator: 0}", ""},
+		{"{id: a, type: b4}", ""},
+		{"{id: a, type: b12le}", ""},
+		{"{id: a, type: b64_header}", "b64_header"},
+		{"{id: a, size: 4, process: xor(1)}", ""},
+	}
+	for _, test := range tests {
+		a := ksyAttr{}
+		if err := yaml.Unmarshal([]byte(test.attr), &a); err != nil {
+			t.Fatal(err)
+		}
+		f, err := a.field("le", "ascii")
+		if test.typ == "" && err == nil {
+			t.Errorf("%s converted to type %s, want an error", test.attr, f.Type)
+		} else if test.typ != "" && (err != nil || f.Type != test.typ) {
+			t.Errorf("%s converted to type %s with error %v, want %s", test.attr, f.Type, err, test.typ)
+		}
+	}
+}
+
+func TestKsyNestedNames(t *testing.T) {
+	// both nested types have a type "header" and an enum "kind"
+	spec := `
+meta:
+  id: file
+seq:
+  - id: a
+    type: first
+  - id: b
+    type: second
+types:
+  first:
+    seq:
+      - id: header
+        type: header
+    types:
+      header:
+        seq:
+          - id: kind
+            type: u1
+            enum: kind
+          - id: is_one
+            value: kind == kind::one
+    enums:
+      kind:
+        1: one
+  second:
+    seq:
+      - id: header
+        type: header
+      - id: other
+        type: first::header
+    types:
+      header:
+        seq:
+          - id: kind
+            type: u2be
+            enum: kind
+    enums:
+      kind:
+        1: uno
+`
+	filename := filepath.Join(t.TempDir(), "file.ksy")
+	if err := ioutil.WriteFile(filename, []byte(spec), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := loadKsy(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte{1, 0, 1, 1}
+	nodes, err := tmpl.apply(bytes.NewReader(data), int64(len(data)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name, value string
+	}{
+		{"a.header.kind", "one (1)"},
+		{"a.header.is_one", "true"},
+		{"b.header.kind", "uno (1)"},
+		{"b.other.kind", "one (1)"},
+	}
+	for _, w := range want {
+		n := nodes[0]
+		for _, name := range strings.Split(w.name, ".") {
+			n = findNode(n.children, name)
+			if n == nil {
+				t.Fatalf("%s not decoded", w.name)
+			}
+		}
+		if n.value != w.value {
+			t.Errorf("%s decoded as %q, want %q", w.name, n.value, w.value)
+		}
+	}
+}
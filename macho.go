@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// this file contains the Mach-O executable format, including universal
+// files which contain a Mach-O file for each architecture
+
+var machoCommands = map[uint64]string{
+	0x1:        "LC_SEGMENT",
+	0x2:        "LC_SYMTAB",
+	0x4:        "LC_THREAD",
+	0x5:        "LC_UNIXTHREAD",
+	0xb:        "LC_DYSYMTAB",
+	0xc:        "LC_LOAD_DYLIB",
+	0xd:        "LC_ID_DYLIB",
+	0xe:        "LC_LOAD_DYLINKER",
+	0xf:        "LC_ID_DYLINKER",
+	0x19:       "LC_SEGMENT_64",
+	0x1b:       "LC_UUID",
+	0x1d:       "LC_CODE_SIGNATURE",
+	0x1e:       "LC_SEGMENT_SPLIT_INFO",
+	0x21:       "LC_ENCRYPTION_INFO",
+	0x22:       "LC_DYLD_INFO",
+	0x24:       "LC_VERSION_MIN_MACOSX",
+	0x25:       "LC_VERSION_MIN_IPHONEOS",
+	0x26:       "LC_FUNCTION_STARTS",
+	0x29:       "LC_DATA_IN_CODE",
+	0x2a:       "LC_SOURCE_VERSION",
+	0x2b:       "LC_DYLIB_CODE_SIGN_DRS",
+	0x2c:       "LC_ENCRYPTION_INFO_64",
+	0x32:       "LC_BUILD_VERSION",
+	0x80000018: "LC_LOAD_WEAK_DYLIB",
+	0x8000001c: "LC_RPATH",
+	0x8000001f: "LC_REEXPORT_DYLIB",
+	0x80000022: "LC_DYLD_INFO_ONLY",
+	0x80000028: "LC_MAIN",
+	0x80000033: "LC_DYLD_EXPORTS_TRIE",
+	0x80000034: "LC_DYLD_CHAINED_FIXUPS",
+}
+
+// machoLinkeditCommands point to data in the __LINKEDIT segment
+var machoLinkeditCommands = map[uint64]bool{
+	0x1d: true, 0x1e: true, 0x26: true, 0x29: true, 0x2b: true,
+	0x80000033: true, 0x80000034: true,
+}
+
+// machoStringCommands contain a string at an offset stored after cmdsize
+var machoStringCommands = map[uint64]bool{
+	0xc: true, 0xd: true, 0xe: true, 0xf: true,
+	0x80000018: true, 0x8000001c: true, 0x8000001f: true,
+}
+
+func detectMacho(head []byte) bool {
+	if len(head) < 8 {
+		return false
+	}
+	switch binary.BigEndian.Uint32(head) {
+	case macho.Magic32, macho.Magic64:
+		return true
+	case macho.MagicFat:
+		// java class files share the magic number, but store their version after it
+		return binary.BigEndian.Uint32(head[4:]) < 32
+	}
+	switch binary.LittleEndian.Uint32(head) {
+	case macho.Magic32, macho.Magic64:
+		return true
+	}
+	return false
+}
+
+func parseMacho(r io.ReaderAt, size int64) ([]*node, error) {
+	if _, err := macho.NewFile(r); err == nil {
+		return parseMachoSlice(r, 0, size)
+	}
+	f, err := macho.NewFatFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// universal header, with a file per architecture
+	header, _, err := readFields(r, 0, binary.BigEndian, []structField{
+		{"magic", 4, nil},
+		{"nfat_arch", 4, nil},
+	})
+	if err != nil {
+		return nil, err
+	}
+	nodes := []*node{group("Universal header", fmt.Sprintf("%d architectures", len(f.Arches)), header)}
+	var arches []*node
+	for i, a := range f.Arches {
+		entry, _, err := readFields(r, 8+int64(i)*20, binary.BigEndian, []structField{
+			{"cputype", 4, machoCpu},
+			{"cpusubtype", 4, nil},
+			{"offset", 4, nil},
+			{"size", 4, nil},
+			{"align", 4, nil},
+		})
+		if err != nil {
+			return nodes, err
+		}
+		nodes[0].children = append(nodes[0].children, group(fmt.Sprintf("[%d] fat_arch", i), a.Cpu.String(), entry))
+		nodes[0].end = entry[len(entry)-1].end
+
+		// architecture slices are collapsed until picked
+		slice, err := parseMachoSlice(r, int64(a.Offset), int64(a.Size))
+		arches = append(arches, &node{
+			name:     fmt.Sprintf("[%d] %s", i, a.Cpu),
+			value:    fmt.Sprintf("offset 0x%X size 0x%X", a.Offset, a.Size),
+			start:    int64(a.Offset),
+			end:      int64(a.Offset) + int64(a.Size),
+			children: slice,
+		})
+		if err != nil {
+			return append(nodes, arches...), err
+		}
+	}
+	return append(nodes, arches...), nil
+}
+
+// parseMachoSlice decodes the Mach-O file of size bytes at offset
+func parseMachoSlice(r io.ReaderAt, offset, size int64) ([]*node, error) {
+	f, err := macho.NewFile(io.NewSectionReader(r, offset, size))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// address sized fields are 4 or 8 bytes
+	addr := 4
+	fields := []structField{
+		{"magic", 4, nil},
+		{"cputype", 4, machoCpu},
+		{"cpusubtype", 4, nil},
+		{"filetype", 4, func(v uint64) string { return macho.Type(v).String() }},
+		{"ncmds", 4, nil},
+		{"sizeofcmds", 4, nil},
+		{"flags", 4, nil},
+	}
+	if f.Magic == macho.Magic64 {
+		addr = 8
+		fields = append(fields, structField{"reserved", 4, nil})
+	}
+	header, _, err := readFields(r, offset, f.ByteOrder, fields)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []*node{group("Mach header", f.Cpu.String()+" "+f.Type.String(), header)}
+
+	// load commands follow the header
+	var commands, segments []*node
+	pos := header[len(header)-1].end
+	for i, l := range f.Loads {
+		raw := l.Raw()
+		cmd := uint64(f.ByteOrder.Uint32(raw))
+		name, ok := machoCommands[cmd]
+		if !ok {
+			name = fmt.Sprintf("0x%X", cmd)
+		}
+		fields := []structField{{"cmd", 4, machoCommand}, {"cmdsize", 4, nil}}
+		value := ""
+		switch {
+		case cmd == 0x1 || cmd == 0x19:
+			fields = append(fields, []structField{{"segname", 16, nil},
+				{"vmaddr", addr, nil}, {"vmsize", addr, nil}, {"fileoff", addr, nil}, {"filesize", addr, nil},
+				{"maxprot", 4, nil}, {"initprot", 4, nil}, {"nsects", 4, nil}, {"flags", 4, nil}}...)
+		case cmd == 0x2:
+			fields = append(fields, []structField{{"symoff", 4, nil}, {"nsyms", 4, nil},
+				{"stroff", 4, nil}, {"strsize", 4, nil}}...)
+		case cmd == 0x1b:
+			fields = append(fields, structField{"uuid", 16, nil})
+		case cmd == 0x80000028:
+			fields = append(fields, []structField{{"entryoff", 8, nil}, {"stacksize", 8, nil}}...)
+		case machoLinkeditCommands[cmd]:
+			fields = append(fields, []structField{{"dataoff", 4, nil}, {"datasize", 4, nil}}...)
+		case machoStringCommands[cmd]:
+			fields = append(fields, structField{"name", 4, nil})
+			if len(raw) >= 12 {
+				if o := int(f.ByteOrder.Uint32(raw[8:])); o < len(raw) {
+					value = string(raw[o:])
+					if i := bytes.IndexByte(raw[o:], 0); i >= 0 {
+						value = string(raw[o : o+i])
+					}
+				}
+			}
+		}
+		entry, e, err := readFields(r, pos, f.ByteOrder, fields)
+		if err != nil {
+			return nodes, err
+		}
+		n := &node{
+			name:     fmt.Sprintf("[%d] %s", i, name),
+			value:    value,
+			start:    pos,
+			end:      pos + int64(len(raw)),
+			children: entry,
+		}
+		if s, ok := l.(*macho.Segment); ok {
+			entry[2].value = fmt.Sprintf("%q", s.Name)
+			n.value = s.Name
+
+			// segments map file contents, and contain sections described after the command
+			sections, err := machoSections(r, offset, f, s, entry[len(entry)-1].end, addr)
+			if err != nil {
+				return nodes, err
+			}
+			segments = append(segments, &node{
+				name:     s.Name,
+				value:    fmt.Sprintf("offset 0x%X vmaddr 0x%X filesize 0x%X", s.Offset, s.Addr, s.Filesz),
+				start:    offset + int64(s.Offset),
+				end:      offset + int64(s.Offset+s.Filesz),
+				children: sections,
+			})
+		}
+		if machoLinkeditCommands[cmd] {
+			n.value = fmt.Sprintf("dataoff 0x%X datasize 0x%X", e["dataoff"], e["datasize"])
+		}
+		commands = append(commands, n)
+		pos += int64(len(raw))
+	}
+	if len(commands) > 0 {
+		n := group("Load commands", fmt.Sprintf("[%d]", len(commands)), commands)
+		nodes = append(nodes, n)
+	}
+	if len(segments) > 0 {
+		n := group("Segments", fmt.Sprintf("[%d]", len(segments)), segments)
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+// machoSections decodes the section headers of a segment at pos, returning
+// a node covering the contents of each section
+func machoSections(r io.ReaderAt, offset int64, f *macho.File, s *macho.Segment, pos int64, addr int) ([]*node, error) {
+	size := 68
+	if addr == 8 {
+		size = 80
+	}
+	var sections []*node
+	for i := 0; i < int(s.Nsect); i++ {
+		fields := []structField{{"sectname", 16, nil}, {"segname", 16, nil},
+			{"addr", addr, nil}, {"size", addr, nil}, {"offset", 4, nil}, {"align", 4, nil},
+			{"reloff", 4, nil}, {"nreloc", 4, nil}, {"flags", 4, nil},
+			{"reserved1", 4, nil}, {"reserved2", 4, nil}}
+		if addr == 8 {
+			fields = append(fields, structField{"reserved3", 4, nil})
+		}
+		entry, e, err := readFields(r, pos+int64(i*size), f.ByteOrder, fields)
+		if err != nil {
+			return sections, err
+		}
+		name := readCString(r, entry[0].start, 16)
+		entry[0].value = fmt.Sprintf("%q", name)
+		entry[1].value = fmt.Sprintf("%q", s.Name)
+		n := &node{
+			name:     name,
+			value:    fmt.Sprintf("offset 0x%X addr 0x%X size 0x%X", e["offset"], e["addr"], e["size"]),
+			start:    offset + int64(e["offset"]),
+			end:      offset + int64(e["offset"]+e["size"]),
+			children: []*node{group("header", "", entry)},
+		}
+		if e["offset"] == 0 {
+			// zero fill sections have no contents in the file
+			n.start, n.end = entry[0].start, entry[0].start
+		}
+		sections = append(sections, n)
+	}
+	return sections, nil
+}
+
+func machoCpu(v uint64) string {
+	return macho.Cpu(v).String()
+}
+
+func machoCommand(v uint64) string {
+	if s, ok := machoCommands[v]; ok {
+		return s
+	}
+	return fmt.Sprintf("0x%X", v)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// machoTestFile returns a 64 bit executable of cpu with a __TEXT segment
+// holding a __text section
+func machoTestFile(cpu uint32) []byte {
+	order := binary.LittleEndian
+	b := make([]byte, 0x200)
+	order.PutUint32(b, 0xFEEDFACF)
+	order.PutUint32(b[4:], cpu)
+	order.PutUint32(b[12:], 2) // executable
+	order.PutUint32(b[16:], 1) // commands
+	order.PutUint32(b[20:], 152)
+
+	seg := b[32:]
+	order.PutUint32(seg, 0x19) // LC_SEGMENT_64
+	order.PutUint32(seg[4:], 152)
+	copy(seg[8:], "__TEXT")
+	order.PutUint64(seg[24:], 0x100000000)
+	order.PutUint64(seg[32:], 0x1000)
+	order.PutUint64(seg[48:], uint64(len(b)))
+	order.PutUint32(seg[56:], 5)
+	order.PutUint32(seg[60:], 5)
+	order.PutUint32(seg[64:], 1)
+
+	sect := seg[72:]
+	copy(sect, "__text")
+	copy(sect[16:], "__TEXT")
+	order.PutUint64(sect[32:], 0x100000100)
+	order.PutUint64(sect[40:], 0x10)
+	order.PutUint32(sect[48:], 0x100)
+	return b
+}
+
+// machoTestFat returns a universal file of an x86-64 and an ARM64 executable
+func machoTestFat() []byte {
+	order := binary.BigEndian
+	b := make([]byte, 0x1000)
+	order.PutUint32(b, 0xCAFEBABE)
+	order.PutUint32(b[4:], 2)
+	for i, cpu := range []uint32{0x01000007, 0x0100000C} {
+		slice := machoTestFile(cpu)
+		a := b[8+20*i:]
+		order.PutUint32(a, cpu)
+		order.PutUint32(a[8:], uint32(len(b)))
+		order.PutUint32(a[12:], uint32(len(slice)))
+		order.PutUint32(a[16:], 9)
+		b = append(b, slice...)
+	}
+	return b
+}
+
+func TestMacho(t *testing.T) {
+	nodes := parseValid(t, parseMacho, machoTestFile(0x01000007))
+	if n := findNode(nodes, "__text"); n == nil || n.start != 0x100 || n.end != 0x110 {
+		t.Fatal("section not decoded")
+	}
+
+	nodes = parseValid(t, parseMacho, machoTestFat())
+	if n := findNode(nodes, "[1] CpuArm64"); n == nil || findNode(n.children, "__text") == nil {
+		t.Fatal("second architecture not decoded")
+	}
+}
+
+func TestMachoTruncated(t *testing.T) {
+	parseTruncated(t, parseMacho, machoTestFile(0x01000007))
+	parseTruncated(t, parseMacho, machoTestFat())
+}
+
+func TestMachoCorrupt(t *testing.T) {
+	parseCorrupt(t, parseMacho, machoTestFile(0x01000007))
+	parseCorrupt(t, parseMacho, machoTestFat()[:0x1100])
+}
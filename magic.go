@@ -0,0 +1,93 @@
+package main
+
+import "bytes"
+
+// this file contains the database of magic numbers identifying file types
+
+// magic is a signature at a fixed offset identifying a file type. if format
+// is set, the structure viewer of that name must also detect the data.
+type magic struct {
+	name      string
+	offset    int
+	signature string
+	format    string
+}
+
+// magics are checked in order, so more specific signatures come first
+var magics = []magic{
+	{"ELF executable", 0, "\x7FELF", "ELF"},
+	{"PE executable", 0, "MZ", "PE"},
+	{"DOS executable", 0, "MZ", ""},
+	{"Mach-O executable", 0, "\xFE\xED\xFA\xCE", "Mach-O"},
+	{"Mach-O executable", 0, "\xFE\xED\xFA\xCF", "Mach-O"},
+	{"Mach-O executable", 0, "\xCE\xFA\xED\xFE", "Mach-O"},
+	{"Mach-O executable", 0, "\xCF\xFA\xED\xFE", "Mach-O"},
+	{"Mach-O universal binary", 0, "\xCA\xFE\xBA\xBE", "Mach-O"},
+	{"Java class", 0, "\xCA\xFE\xBA\xBE", ""},
+	{"WebAssembly module", 0, "\x00asm", ""},
+	{"PNG image", 0, "\x89PNG\r\n\x1A\n", "PNG"},
+	{"JPEG image", 0, "\xFF\xD8\xFF", "JPEG"},
+	{"GIF image", 0, "GIF87a", ""},
+	{"GIF image", 0, "GIF89a", ""},
+	{"TIFF image", 0, "II*\x00", "TIFF"},
+	{"TIFF image", 0, "MM\x00*", "TIFF"},
+	{"WebP image", 8, "WEBP", "RIFF"},
+	{"WAV audio", 8, "WAVE", "RIFF"},
+	{"AVI video", 8, "AVI ", "RIFF"},
+	{"RIFF data", 0, "RIFF", "RIFF"},
+	{"Ogg data", 0, "OggS", ""},
+	{"FLAC audio", 0, "fLaC", ""},
+	{"MP3 audio with ID3 tag", 0, "ID3\x02", ""},
+	{"MP3 audio with ID3 tag", 0, "ID3\x03", ""},
+	{"MP3 audio with ID3 tag", 0, "ID3\x04", ""},
+	{"Matroska video", 0, "\x1A\x45\xDF\xA3", ""},
+	{"ISO media", 4, "ftyp", ""},
+	{"PDF document", 0, "%PDF-", ""},
+	{"OLE compound document", 0, "\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1", ""},
+	{"ZIP archive", 0, "PK\x03\x04", "ZIP"},
+	{"ZIP archive", 0, "PK\x05\x06", "ZIP"},
+	{"gzip compressed data", 0, "\x1F\x8B\x08", ""},
+	{"bzip2 compressed data", 4, "1AY&SY", ""}, // block magic after "BZh" and the level
+	{"xz compressed data", 0, "\xFD7zXZ\x00", ""},
+	{"Zstandard compressed data", 0, "\x28\xB5\x2F\xFD", ""},
+	{"LZ4 compressed data", 0, "\x04\x22\x4D\x18", ""},
+	{"7-Zip archive", 0, "7z\xBC\xAF\x27\x1C", ""},
+	{"RAR archive", 0, "Rar!\x1A\x07", ""},
+	{"Microsoft cabinet", 0, "MSCF\x00\x00\x00\x00", ""},
+	{"tar archive", 257, "ustar", "tar"},
+	{"cpio archive", 0, "070701", "cpio"},
+	{"cpio archive", 0, "070702", "cpio"},
+	{"SQLite database", 0, "SQLite format 3\x00", "SQLite"},
+	{"pcap capture", 0, "\xD4\xC3\xB2\xA1", "PCAP"},
+	{"pcap capture", 0, "\xA1\xB2\xC3\xD4", "PCAP"},
+	{"pcap capture", 0, "\x4D\x3C\xB2\xA1", "PCAP"},
+	{"pcap capture", 0, "\xA1\xB2\x3C\x4D", "PCAP"},
+	{"pcapng capture", 0, "\x0A\x0D\x0D\x0A", "PCAPNG"},
+	{"DER certificate or key", 0, "\x30\x82", "DER"},
+	{"DER certificate or key", 0, "\x30\x83", "DER"},
+	{"PEM data", 0, "-----BEGIN ", ""},
+	{"ext file system", 1080, "\x53\xEF", "ext"},
+	{"squashfs file system", 0, "hsqs", "squashfs"},
+	{"FAT file system", 510, "\x55\xAA", "FAT"},
+	{"GPT partition table", 510, "\x55\xAA", "GPT"},
+	{"MBR partition table", 510, "\x55\xAA", "MBR"},
+	{"U-Boot image", 0, "\x27\x05\x19\x56", ""},
+	{"device tree blob", 0, "\xD0\x0D\xFE\xED", ""},
+}
+
+// identify returns the magic of data starting with head, or nil if unknown
+func identify(head []byte) *magic {
+	for i := range magics {
+		m := &magics[i]
+		if m.offset > len(head) || !bytes.HasPrefix(head[m.offset:], []byte(m.signature)) {
+			continue
+		}
+		if m.format != "" {
+			if f := findFormat(m.format); f == nil || !f.detect(head) {
+				continue
+			}
+		}
+		return m
+	}
+	return nil
+}
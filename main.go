@@ -1,9 +1,7 @@
 package main
 
 // TODO: add data editing and file save commands
-// TODO: add data editor for generic data (binary, ints, floats, time, guid, disasm?)
-// TODO: add data editor for defined data (file formats, structs, protobufs?)
-// TODO: add simple endianness switch in data editors
+// TODO: add data editor for defined data (file formats)
 // TODO: add some settings from within the editor to change flags
 
 import (
@@ -17,7 +15,8 @@ type editor struct {
 	term  term
 	areas areas
 
-	err error // error to print after closing editor
+	err     error  // error to print after closing editor
+	message string // message to show in place of key reference until next key press
 }
 
 var app = editor{
@@ -32,6 +31,7 @@ func main() {
 	app.flags.init()
 	app.term.init()
 	app.must(app.areas.add("editor", &editorArea{}))
+	app.must(app.areas.add("prompt", &promptArea{}))
 	app.areas.focus("editor")
 
 	loop()
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// this file contains the MessagePack decoder
+
+// decodeMsgpack decodes b as a sequence of MessagePack objects
+func decodeMsgpack(b []byte, offset int64, args []string) ([]*node, error) {
+	return decodeItems(b, offset, func(pos, depth int) (*node, int, error) {
+		return msgpackItem(b, offset, pos, depth)
+	})
+}
+
+// msgpackItem decodes the object at pos
+func msgpackItem(b []byte, offset int64, pos, depth int) (*node, int, error) {
+	if depth > decoderMaxDepth {
+		return nil, pos, fmt.Errorf("MessagePack nested too deeply at offset 0x%X", offset+int64(pos))
+	}
+	truncated := func() error {
+		return fmt.Errorf("truncated MessagePack object at offset 0x%X", offset+int64(pos))
+	}
+	if pos >= len(b) {
+		return nil, pos, truncated()
+	}
+
+	c := b[pos]
+	p := pos + 1
+
+	// size reads a big endian length or value of n bytes after the type
+	size := func(n int) (uint64, bool) {
+		if n > len(b)-p {
+			return 0, false
+		}
+		v := getUint(b[p:], n, binary.BigEndian)
+		p += n
+		return v, true
+	}
+
+	n := &node{start: offset + int64(pos)}
+	var length uint64 // of containers, strings, binary and extension data
+	ok := true
+	switch {
+	case c <= 0x7F:
+		n.name, n.value = "positive fixint", fmt.Sprint(c)
+	case c >= 0xE0:
+		n.name, n.value = "negative fixint", fmt.Sprint(int8(c))
+	case c <= 0x8F:
+		n.name, length = "fixmap", uint64(c&0x0F)
+	case c <= 0x9F:
+		n.name, length = "fixarray", uint64(c&0x0F)
+	case c <= 0xBF:
+		n.name, length = "fixstr", uint64(c&0x1F)
+	case c == 0xC0:
+		n.name, n.value = "nil", "nil"
+	case c == 0xC2 || c == 0xC3:
+		n.name, n.value = "bool", fmt.Sprint(c == 0xC3)
+	case c >= 0xC4 && c <= 0xC6:
+		n.name = fmt.Sprintf("bin %d", 8<<(c-0xC4))
+		length, ok = size(1 << (c - 0xC4))
+	case c >= 0xC7 && c <= 0xC9:
+		n.name = fmt.Sprintf("ext %d", 8<<(c-0xC7))
+		length, ok = size(1 << (c - 0xC7))
+	case c == 0xCA:
+		var v uint64
+		v, ok = size(4)
+		n.name, n.value = "float 32", fmt.Sprint(math.Float32frombits(uint32(v)))
+	case c == 0xCB:
+		var v uint64
+		v, ok = size(8)
+		n.name, n.value = "float 64", fmt.Sprint(math.Float64frombits(v))
+	case c >= 0xCC && c <= 0xCF:
+		var v uint64
+		v, ok = size(1 << (c - 0xCC))
+		n.name, n.value = fmt.Sprintf("uint %d", 8<<(c-0xCC)), fmt.Sprint(v)
+	case c >= 0xD0 && c <= 0xD3:
+		var v uint64
+		bits := uint(8 << (c - 0xD0))
+		v, ok = size(1 << (c - 0xD0))
+		n.name, n.value = fmt.Sprintf("int %d", bits), fmt.Sprint(int64(v<<(64-bits))>>(64-bits))
+	case c >= 0xD4 && c <= 0xD8:
+		n.name, length = fmt.Sprintf("fixext %d", 1<<(c-0xD4)), 1<<(c-0xD4)
+	case c >= 0xD9 && c <= 0xDB:
+		n.name = fmt.Sprintf("str %d", 8<<(c-0xD9))
+		length, ok = size(1 << (c - 0xD9))
+	case c == 0xDC || c == 0xDD:
+		n.name = fmt.Sprintf("array %d", 16<<(c-0xDC))
+		length, ok = size(2 << (c - 0xDC))
+	case c == 0xDE || c == 0xDF:
+		n.name = fmt.Sprintf("map %d", 16<<(c-0xDE))
+		length, ok = size(2 << (c - 0xDE))
+	default:
+		return nil, pos, fmt.Errorf("invalid MessagePack type 0x%02X at offset 0x%X", c, offset+int64(pos))
+	}
+	if !ok {
+		return nil, pos, truncated()
+	}
+
+	switch {
+	case c >= 0x80 && c <= 0x9F || c >= 0xDC && c <= 0xDF:
+		// maps count key value pairs
+		isMap := c <= 0x8F || c >= 0xDE
+		if isMap {
+			length *= 2
+		}
+		var key *node
+		for i := uint64(0); i < length; i++ {
+			e, end, err := msgpackItem(b, offset, p, depth+1)
+			if err != nil {
+				return nil, pos, err
+			}
+			p = end
+			switch {
+			case !isMap:
+				e.name = fmt.Sprintf("[%d] %s", i, e.name)
+				n.children = append(n.children, e)
+			case key == nil:
+				key = e
+			default:
+				n.children = append(n.children, mapEntry(key, e))
+				key = nil
+			}
+		}
+		n.value = fmt.Sprintf("%d elements", len(n.children))
+	case c >= 0xA0 && c <= 0xBF || c >= 0xD9 && c <= 0xDB:
+		if length > uint64(len(b)-p) {
+			return nil, pos, truncated()
+		}
+		n.value = fmt.Sprintf("%q", b[p:p+int(length)])
+		p += int(length)
+	case c >= 0xC4 && c <= 0xC6:
+		if length > uint64(len(b)-p) {
+			return nil, pos, truncated()
+		}
+		n.value = formatBytes(b[p : p+int(length)])
+		p += int(length)
+	case c >= 0xC7 && c <= 0xC9 || c >= 0xD4 && c <= 0xD8:
+		// extensions have a type before their data
+		if length >= uint64(len(b)-p) {
+			return nil, pos, truncated()
+		}
+		typ, data := int8(b[p]), b[p+1:p+1+int(length)]
+		p += 1 + int(length)
+		n.value = fmt.Sprintf("type %d: %s", typ, formatBytes(data))
+		if t, ok := msgpackTimestamp(typ, data); ok {
+			n.name, n.value = "timestamp", formatTime(t)
+		}
+	}
+	n.end = offset + int64(p)
+	return n, p, nil
+}
+
+// msgpackTimestamp decodes the data of the timestamp extension type
+func msgpackTimestamp(typ int8, data []byte) (time.Time, bool) {
+	if typ != -1 {
+		return time.Time{}, false
+	}
+	switch len(data) {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0), true
+	case 8:
+		v := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(v&(1<<34-1)), int64(v>>34)), true
+	case 12:
+		return time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(binary.BigEndian.Uint32(data))), true
+	}
+	return time.Time{}, false
+}
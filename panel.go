@@ -0,0 +1,141 @@
+package main
+
+import (
+	"github.com/gdamore/tcell"
+)
+
+// this file contains the side panels shown next to the hex data view
+
+type panels struct {
+	a       *editorArea
+	all     map[string]panel
+	current panel
+	focused bool // whether key events go to the current panel
+}
+
+type panel interface {
+	title() string
+	draw(o obj, focused bool)
+	onEvent(tcell.Event) error
+}
+
+// colorer is implemented by panels which color ranges of the file
+type colorer interface {
+	color(offset int64) (tcell.Color, bool)
+}
+
+// follower is implemented by panels which follow the cursor in the hex data view
+type follower interface {
+	follow(offset int64)
+}
+
+// highlighter is implemented by panels which highlight a range of the file
+type highlighter interface {
+	highlight() (start, end int64, ok bool)
+}
+
+// toggle shows the named panel, or hides it if it is already shown
+func (p *panels) toggle(name string) {
+	if p.all[name] == nil {
+		return
+	}
+	if p.current == p.all[name] {
+		p.hide()
+		return
+	}
+	p.current = p.all[name]
+}
+
+// show shows the named panel
+func (p *panels) show(name string) {
+	if p.all[name] != nil {
+		p.current = p.all[name]
+	}
+}
+
+// hide hides the current panel and returns focus to the hex data view
+func (p *panels) hide() {
+	p.current = nil
+	p.focused = false
+}
+
+// highlight returns the range of the file highlighted by the focused panel
+func (p *panels) highlight() (int64, int64, bool) {
+	if h, ok := p.current.(highlighter); ok && p.focused {
+		return h.highlight()
+	}
+	return 0, 0, false
+}
+
+// color returns the color of the byte at offset given by the current panel
+func (p *panels) color(offset int64) (tcell.Color, bool) {
+	if c, ok := p.current.(colorer); ok {
+		return c.color(offset)
+	}
+	return 0, false
+}
+
+// follow passes the cursor offset to the current panel, unless it is focused
+func (p *panels) follow(offset int64) {
+	if f, ok := p.current.(follower); ok && !p.focused {
+		f.follow(offset)
+	}
+}
+
+// rect returns the screen area covered by the current panel
+func (p *panels) rect() obj {
+	h := app.term.h - 2 // header + key reference
+
+	// width of a row of hex and text data views
+	x := p.a.offsetWidth() + app.flags.BytesPerRow/app.flags.Group*(app.flags.Group*2+1)
+	if app.flags.Columns["text"] {
+		x += 1 + app.flags.BytesPerRow
+	}
+
+	// place panel next to data views if there is room, otherwise overlap them
+	if app.term.w-x >= 48 {
+		return obj{pos{x, 1}, size{app.term.w - x, h}}
+	}
+	w := min(48, app.term.w/2)
+	return obj{pos{app.term.w - w, 1}, size{w, h}}
+}
+
+// draw draws the current panel with a title bar
+func (p *panels) draw() {
+	if p.current == nil {
+		return
+	}
+	o := p.rect()
+	if o.w < 2 || o.h < 2 {
+		return
+	}
+
+	// draw title bar
+	if p.focused {
+		app.term.style = app.term.style.Foreground(tcell.ColorBlack).Background(tcell.ColorWhite)
+	} else {
+		app.term.style = app.term.style.Foreground(tcell.ColorBlack).Background(tcell.ColorBlue)
+	}
+	app.term.setCursor(o.pos)
+	app.term.writeFixed(" "+p.current.title(), o.w)
+
+	// restore foreground and background
+	app.term.style = app.term.style.Foreground(tcell.ColorWhite).Background(tcell.ColorBlack)
+
+	// draw panel content below title bar
+	p.current.draw(obj{pos{o.x, o.y + 1}, size{o.w, o.h - 1}}, p.focused)
+}
+
+// drawRow draws a single row of panel content, reversed if selected
+func drawRow(o obj, row int, s string, selected bool) {
+	if row < 0 || row >= o.h {
+		return
+	}
+	style := app.term.style
+	if selected {
+		app.term.style = style.Reverse(true)
+	}
+	app.term.setCursor(pos{o.x, o.y + row})
+	app.term.writeFixed(" "+s, o.w)
+	app.term.style = style
+}
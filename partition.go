@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// this file contains the MBR and GPT partition tables of disk images and
+// block devices
+
+const (
+	mbrSectorSize    = 512
+	mbrMaxLogical    = 128
+	gptMaxEntries    = 1024
+	gptMinEntrySize  = 128
+	gptMinHeaderSize = 92
+)
+
+var mbrTypes = map[byte]string{
+	0x01: "FAT12",
+	0x04: "FAT16 <32M",
+	0x05: "extended",
+	0x06: "FAT16",
+	0x07: "NTFS/exFAT",
+	0x0B: "FAT32",
+	0x0C: "FAT32 LBA",
+	0x0E: "FAT16 LBA",
+	0x0F: "extended LBA",
+	0x27: "Windows recovery",
+	0x82: "Linux swap",
+	0x83: "Linux",
+	0x85: "Linux extended",
+	0x8E: "Linux LVM",
+	0xA5: "FreeBSD",
+	0xA6: "OpenBSD",
+	0xA8: "Mac OS X",
+	0xA9: "NetBSD",
+	0xAF: "HFS+",
+	0xEE: "GPT protective",
+	0xEF: "EFI system",
+	0xFD: "Linux RAID",
+}
+
+var gptTypes = map[string]string{
+	"C12A7328-F81F-11D2-BA4B-00A0C93EC93B": "EFI system",
+	"21686148-6449-6E6F-744E-656564454649": "BIOS boot",
+	"E3C9E316-0B5C-4DB8-817D-F92DF00215AE": "Microsoft reserved",
+	"EBD0A0A2-B9E5-4433-87C0-68B6B72699C7": "Microsoft basic data",
+	"DE94BBA4-06D1-4D40-A16A-BFD50179D6AC": "Windows recovery",
+	"0FC63DAF-8483-4772-8E79-3D69D8477DE4": "Linux filesystem",
+	"4F68BCE3-E8CD-4DB1-96E7-FBCAF984B709": "Linux root (x86-64)",
+	"B921B045-1DF0-41C3-AF44-4C6F280D3FAE": "Linux root (ARM64)",
+	"933AC7E1-2EB4-4F13-B844-0E14E2AEF915": "Linux home",
+	"0657FD6D-A4AB-43C4-84E5-0933C84B4F4F": "Linux swap",
+	"E6D6D379-F507-44C2-A23C-238F2A3DF928": "Linux LVM",
+	"A19D880F-05FC-4D3B-A006-743F0F84911E": "Linux RAID",
+	"BC13C2FF-59E6-4262-A352-B275FD6F7172": "Linux extended boot",
+	"48465300-0000-11AA-AA11-00306543ECAC": "HFS+",
+	"7C3457EF-0000-11AA-AA11-00306543ECAC": "APFS",
+	"516E7CB4-6ECF-11D6-8FF8-00022D09712B": "FreeBSD data",
+	"83BD6B9D-7F41-11DC-BE0B-001560B84F0F": "FreeBSD boot",
+	"516E7CBA-6ECF-11D6-8FF8-00022D09712B": "FreeBSD ZFS",
+	"6A898CC3-1DD2-11B2-99A6-080020736631": "ZFS",
+}
+
+func detectMBR(head []byte) bool {
+	if len(head) < mbrSectorSize || head[510] != 0x55 || head[511] != 0xAA {
+		return false
+	}
+
+	// boot sectors of file systems have the same signature, but no valid
+	// partition entries
+	used := false
+	for i := 0; i < 4; i++ {
+		e := head[446+16*i:]
+		if e[0] != 0 && e[0] != 0x80 {
+			return false
+		}
+		used = used || e[4] != 0
+	}
+	return used
+}
+
+func detectGPT(head []byte) bool {
+	if !detectMBR(head) {
+		return false
+	}
+	for i := 0; i < 4; i++ {
+		if head[446+16*i+4] == 0xEE {
+			return true
+		}
+	}
+	return false
+}
+
+func parseMBR(r io.ReaderAt, size int64) ([]*node, error) {
+	return mbrNodes(r, size, mbrSectorSize)
+}
+
+func parseGPT(r io.ReaderAt, size int64) ([]*node, error) {
+	sector := gptSectorSize(r)
+	nodes, err := mbrNodes(r, size, sector)
+	if err != nil {
+		return nodes, err
+	}
+	primary, backup, err := gptHeader(r, size, "Primary GPT header", sector, sector)
+	if primary != nil {
+		nodes = append(nodes, primary...)
+	}
+	if err != nil {
+		return nodes, err
+	}
+
+	// the backup header at the end of the disk has its own entry array
+	if backup > 0 && backup < size/sector {
+		alternate, _, err := gptHeader(r, size, "Backup GPT header", backup*sector, sector)
+		nodes = append(nodes, alternate...)
+		if err != nil {
+			return nodes, err
+		}
+	}
+	return nodes, nil
+}
+
+// partitionUnits numbers the sectors of the disk
+func partitionUnits(r io.ReaderAt, size int64) []unit {
+	return []unit{{"lba", 0, 0, gptSectorSize(r)}}
+}
+
+// gptSectorSize returns the logical sector size, which is where the GPT
+// header is found
+func gptSectorSize(r io.ReaderAt) int64 {
+	b := make([]byte, 8)
+	for _, sector := range []int64{512, 4096} {
+		if _, err := r.ReadAt(b, sector); err == nil && string(b) == "EFI PART" {
+			return sector
+		}
+	}
+	return mbrSectorSize
+}
+
+// mbrNodes decodes the MBR and the logical partitions of extended partitions,
+// which address sectors of the given size
+func mbrNodes(r io.ReaderAt, size, sector int64) ([]*node, error) {
+	b := make([]byte, mbrSectorSize)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		return nil, err
+	}
+	mbr := &node{name: "MBR", start: 0, end: mbrSectorSize}
+	mbr.children = append(mbr.children, &node{name: "boot code", value: "446 bytes", start: 0, end: 446})
+	var extended []int64
+	for i := 0; i < 4; i++ {
+		e, typ, first := mbrEntry(b[446+16*i:], int64(446+16*i), 0, i, sector, size)
+		mbr.children = append(mbr.children, e)
+		if typ == 0x05 || typ == 0x0F || typ == 0x85 {
+			extended = append(extended, first)
+		}
+	}
+	mbr.children = append(mbr.children, &node{name: "signature", value: fmt.Sprintf("0x%02X%02X", b[511], b[510]), start: 510, end: 512})
+	nodes := []*node{mbr}
+
+	// extended partitions contain a linked list of EBRs, each describing a
+	// logical partition relative to itself and the next EBR relative to the
+	// extended partition
+	for _, base := range extended {
+		ebr := base
+		for i := 0; i < mbrMaxLogical && ebr < size/sector; i++ {
+			pos := ebr * sector
+			if _, err := r.ReadAt(b, pos); err != nil {
+				return nodes, err
+			}
+			if b[510] != 0x55 || b[511] != 0xAA {
+				return nodes, fmt.Errorf("invalid EBR at %08X", pos)
+			}
+			n := &node{name: fmt.Sprintf("EBR %d", i), start: pos, end: pos + mbrSectorSize}
+			logical, _, _ := mbrEntry(b[446:], pos+446, ebr, 4+i, sector, size)
+			link, _, next := mbrEntry(b[462:], pos+462, base, -1, sector, size)
+			link.name = "next EBR"
+			n.value = logical.value
+			n.children = []*node{logical, link}
+			nodes = append(nodes, n)
+			if b[462+4] == 0 || next <= ebr {
+				break
+			}
+			ebr = next
+		}
+	}
+	return nodes, nil
+}
+
+// mbrEntry decodes the partition entry b at pos, with its first sector
+// relative to base, returning its node, type and absolute first sector
+func mbrEntry(b []byte, pos, base int64, i int, sector, size int64) (*node, byte, int64) {
+	typ := b[4]
+	first, count := int64(binary.LittleEndian.Uint32(b[8:])), int64(binary.LittleEndian.Uint32(b[12:]))
+	name := mbrTypes[typ]
+	if name == "" {
+		name = fmt.Sprintf("type 0x%02X", typ)
+	}
+	n := &node{name: fmt.Sprintf("partition %d", i+1), start: pos, end: pos + 16}
+	if typ == 0 {
+		n.value = "unused"
+	} else {
+		n.value = fmt.Sprintf("%s, LBA %d-%d, %s", name, base+first, base+first+count-1, formatSize(count*sector))
+		if b[0] == 0x80 {
+			n.value += ", bootable"
+		}
+	}
+	n.children = []*node{
+		{name: "status", value: fmt.Sprintf("0x%02X", b[0]), start: pos, end: pos + 1},
+		{name: "first CHS", value: mbrCHS(b[1:]), start: pos + 1, end: pos + 4},
+		{name: "type", value: fmt.Sprintf("0x%02X %s", typ, mbrTypes[typ]), start: pos + 4, end: pos + 5},
+		{name: "last CHS", value: mbrCHS(b[5:]), start: pos + 5, end: pos + 8},
+		{name: "first LBA", value: fmt.Sprint(first), start: pos + 8, end: pos + 12},
+		{name: "sectors", value: fmt.Sprint(count), start: pos + 12, end: pos + 16},
+	}
+	if typ != 0 && count > 0 && base+first < size/sector {
+		n.children = append(n.children, partitionData(base+first, count, sector, size))
+	}
+	return n, typ, base + first
+}
+
+// mbrCHS formats a cylinder, head and sector address
+func mbrCHS(b []byte) string {
+	return fmt.Sprintf("%d/%d/%d", int(b[2])|int(b[1]&0xC0)<<2, b[0], b[1]&0x3F)
+}
+
+// gptHeader decodes the GPT header at pos and its partition entry array,
+// returning their nodes and the LBA of the alternate header
+func gptHeader(r io.ReaderAt, size int64, name string, pos, sector int64) ([]*node, int64, error) {
+	b := make([]byte, sector)
+	if _, err := r.ReadAt(b, pos); err != nil {
+		return nil, 0, err
+	}
+	if string(b[:8]) != "EFI PART" {
+		return []*node{{name: name, value: "missing", start: pos, end: pos + sector}}, 0, nil
+	}
+	headerSize := int64(binary.LittleEndian.Uint32(b[12:]))
+	if headerSize < gptMinHeaderSize || headerSize > sector {
+		return nil, 0, fmt.Errorf("invalid GPT header size %d at %08X", headerSize, pos)
+	}
+	fields, values, err := readFields(r, pos, binary.LittleEndian, []structField{
+		{"signature", 8, nil},
+		{"revision", 4, func(v uint64) string { return fmt.Sprintf("%d.%d", v>>16, v&0xFFFF) }},
+		{"header size", 4, nil},
+		{"header CRC32", 4, nil},
+		{"reserved", 4, nil},
+		{"current LBA", 8, nil},
+		{"backup LBA", 8, nil},
+		{"first usable LBA", 8, nil},
+		{"last usable LBA", 8, nil},
+		{"disk GUID", 16, nil},
+		{"entries LBA", 8, nil},
+		{"number of entries", 4, nil},
+		{"entry size", 4, nil},
+		{"entries CRC32", 4, nil},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	fields[0].value = fmt.Sprintf("%q", b[:8])
+	fields[9].value = formatGUID(b[56:72])
+	header := group(name, "", fields)
+
+	// the entry array checksum is part of the header checksum
+	count, entrySize := int64(values["number of entries"]), int64(values["entry size"])
+	if count > gptMaxEntries || entrySize < gptMinEntrySize || entrySize > sector {
+		return []*node{header}, 0, fmt.Errorf("invalid GPT entry array of %d entries of %d bytes", count, entrySize)
+	}
+	if values["entries LBA"] >= uint64(size/sector) {
+		return []*node{header}, 0, fmt.Errorf("GPT entry array at LBA %d is past the end", values["entries LBA"])
+	}
+	start := int64(values["entries LBA"]) * sector
+	if start+count*entrySize > size {
+		return []*node{header}, 0, fmt.Errorf("GPT entry array at %08X is truncated", start)
+	}
+	entries := make([]byte, count*entrySize)
+	if _, err := r.ReadAt(entries, start); err != nil {
+		return []*node{header}, 0, err
+	}
+	status := gptCheck(fields[13], uint32(values["entries CRC32"]), crc32.ChecksumIEEE(entries))
+	h := append([]byte(nil), b[:headerSize]...)
+	binary.LittleEndian.PutUint32(h[16:], 0)
+	headerStatus := "ok"
+	if crc32.ChecksumIEEE(h) != uint32(values["header CRC32"]) {
+		headerStatus = "bad"
+	}
+	binary.LittleEndian.PutUint32(h[88:], crc32.ChecksumIEEE(entries))
+	gptCheck(fields[3], uint32(values["header CRC32"]), crc32.ChecksumIEEE(h))
+	fields[3].value = fmt.Sprintf("0x%08X %s", values["header CRC32"], headerStatus)
+	header.value = fmt.Sprintf("header CRC32 %s, entries CRC32 %s", headerStatus, status)
+
+	array := &node{name: "Partition entries", start: start, end: start + count*entrySize}
+	for i := int64(0); i < count; i++ {
+		if e := gptEntry(entries[i*entrySize:(i+1)*entrySize], start+i*entrySize, int(i), sector, size); e != nil {
+			array.children = append(array.children, e)
+		}
+	}
+	array.value = fmt.Sprintf("%d of %d used, CRC32 %s", len(array.children), count, status)
+	return []*node{header, array}, int64(values["backup LBA"]), nil
+}
+
+// gptCheck sets the value of a CRC32 field, and a fix if it is wrong
+func gptCheck(n *node, stored, expected uint32) string {
+	if stored == expected {
+		n.value = fmt.Sprintf("0x%08X ok", stored)
+		return "ok"
+	}
+	n.value = fmt.Sprintf("0x%08X bad, expected 0x%08X", stored, expected)
+	n.fix = make([]byte, 4)
+	binary.LittleEndian.PutUint32(n.fix, expected)
+	return "bad"
+}
+
+// gptEntry decodes the partition entry b at pos, or returns nil if it is
+// unused
+func gptEntry(b []byte, pos int64, i int, sector, size int64) *node {
+	if bytes.Count(b[:16], []byte{0}) == 16 {
+		return nil
+	}
+	typ := formatGUID(b[:16])
+	first, last := int64(binary.LittleEndian.Uint64(b[32:])), int64(binary.LittleEndian.Uint64(b[40:]))
+	u := make([]uint16, 36)
+	for j := range u {
+		u[j] = binary.LittleEndian.Uint16(b[56+2*j:])
+	}
+	name := strings.TrimRight(string(utf16.Decode(u)), "\x00")
+	label := name
+	if !printable([]byte(name)) {
+		label = fmt.Sprintf("%q", name)
+	}
+	kind, ok := gptTypes[typ]
+	if !ok {
+		kind = typ
+	}
+	n := &node{
+		name:  fmt.Sprintf("[%d] %s", i, label),
+		value: fmt.Sprintf("%s, LBA %d-%d, %s", kind, first, last, formatSize((last-first+1)*sector)),
+		start: pos,
+		end:   pos + int64(len(b)),
+		children: []*node{
+			{name: "type GUID", value: fmt.Sprintf("%s %s", typ, gptTypes[typ]), start: pos, end: pos + 16},
+			{name: "partition GUID", value: formatGUID(b[16:32]), start: pos + 16, end: pos + 32},
+			{name: "first LBA", value: fmt.Sprint(first), start: pos + 32, end: pos + 40},
+			{name: "last LBA", value: fmt.Sprint(last), start: pos + 40, end: pos + 48},
+			{name: "attributes", value: fmt.Sprintf("0x%016X", binary.LittleEndian.Uint64(b[48:])), start: pos + 48, end: pos + 56},
+			{name: "name", value: fmt.Sprintf("%q", name), start: pos + 56, end: pos + 128},
+		},
+	}
+	if last >= first && first >= 0 && first < size/sector {
+		n.children = append(n.children, partitionData(first, last-first+1, sector, size))
+	}
+	return n
+}
+
+// partitionData returns a node for the sectors of a partition, so that the
+// tree panel jumps to its first sector
+func partitionData(first, count, sector, size int64) *node {
+	end := min64((first+count)*sector, size)
+	return &node{name: "data", value: fmt.Sprintf("LBA %d, %s", first, formatSize(count*sector)), start: first * sector, end: end}
+}
+
+// formatGUID formats a GUID stored with its first three fields in little
+// endian byte order
+func formatGUID(b []byte) string {
+	return fmt.Sprintf("%08X-%04X-%04X-%X-%X", binary.LittleEndian.Uint32(b), binary.LittleEndian.Uint16(b[4:]),
+		binary.LittleEndian.Uint16(b[6:]), b[8:10], b[10:16])
+}
+
+// formatSize formats a number of bytes in binary units
+func formatSize(n int64) string {
+	units := "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%d bytes", n)
+	}
+	v, i := float64(n)/1024, 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %ciB", v, units[i])
+}
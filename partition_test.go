@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+	"unicode/utf16"
+)
+
+// mbrTestDisk returns a disk of 8 sectors with a Linux partition and an
+// extended partition holding a logical partition
+func mbrTestDisk() []byte {
+	order := binary.LittleEndian
+	b := make([]byte, 8*mbrSectorSize)
+	entry := func(pos int, typ byte, first, count uint32) {
+		b[pos+4] = typ
+		order.PutUint32(b[pos+8:], first)
+		order.PutUint32(b[pos+12:], count)
+	}
+	entry(446, 0x83, 1, 3)
+	entry(462, 0x05, 4, 4)
+	b[510], b[511] = 0x55, 0xAA
+	ebr := 4 * mbrSectorSize
+	entry(ebr+446, 0x83, 1, 2)
+	b[ebr+510], b[ebr+511] = 0x55, 0xAA
+	return b
+}
+
+// gptTestDisk returns a disk of 64 sectors with a protective MBR, the
+// primary and backup GPT headers and one partition
+func gptTestDisk() []byte {
+	order := binary.LittleEndian
+	const sector = 512
+	b := make([]byte, 64*sector)
+	b[446+4] = 0xEE
+	order.PutUint32(b[446+8:], 1)
+	order.PutUint32(b[446+12:], 63)
+	b[510], b[511] = 0x55, 0xAA
+
+	entries := make([]byte, 4*128)
+	copy(entries, []byte{0xAF, 0x3D, 0xC6, 0x0F, 0x83, 0x84, 0x72, 0x47, 0x8E, 0x79, 0x3D, 0x69, 0xD8, 0x47, 0x7D, 0xE4})
+	entries[16] = 1
+	order.PutUint64(entries[32:], 34)
+	order.PutUint64(entries[40:], 61)
+	for i, c := range utf16.Encode([]rune("root")) {
+		order.PutUint16(entries[56+2*i:], c)
+	}
+	header := func(current, backup, array uint64) {
+		copy(b[array*sector:], entries)
+		h := b[current*sector:]
+		copy(h, "EFI PART")
+		order.PutUint32(h[8:], 0x10000)
+		order.PutUint32(h[12:], 92)
+		order.PutUint64(h[24:], current)
+		order.PutUint64(h[32:], backup)
+		order.PutUint64(h[40:], 34)
+		order.PutUint64(h[48:], 61)
+		h[56] = 1
+		order.PutUint64(h[72:], array)
+		order.PutUint32(h[80:], 4)
+		order.PutUint32(h[84:], 128)
+		order.PutUint32(h[88:], crc32.ChecksumIEEE(entries))
+		order.PutUint32(h[16:], crc32.ChecksumIEEE(h[:92]))
+	}
+	header(1, 63, 2)
+	header(63, 1, 62)
+	return b
+}
+
+func TestMBR(t *testing.T) {
+	nodes := parseValid(t, parseMBR, mbrTestDisk())
+	if n := findNode(nodes, "partition 5"); n == nil || n.value != "Linux, LBA 5-6, 1.0 KiB" {
+		t.Fatal("logical partition not decoded")
+	}
+}
+
+func TestMBRTruncated(t *testing.T) {
+	parseTruncated(t, parseMBR, mbrTestDisk())
+}
+
+func TestMBRCorrupt(t *testing.T) {
+	parseCorrupt(t, parseMBR, mbrTestDisk())
+}
+
+func TestGPT(t *testing.T) {
+	nodes := parseValid(t, parseGPT, gptTestDisk())
+	for _, name := range []string{"Primary GPT header", "Backup GPT header"} {
+		if n := findNode(nodes, name); n == nil || n.value != "header CRC32 ok, entries CRC32 ok" {
+			t.Fatalf("%s not decoded", name)
+		}
+	}
+	if findNode(nodes, "[0] root") == nil {
+		t.Fatal("partition not decoded")
+	}
+}
+
+func TestGPTTruncated(t *testing.T) {
+	parseTruncated(t, parseGPT, gptTestDisk())
+}
+
+func TestGPTCorrupt(t *testing.T) {
+	parseCorrupt(t, parseGPT, gptTestDisk())
+}
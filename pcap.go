@@ -0,0 +1,517 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"time"
+)
+
+// this file contains the pcap and pcapng packet capture formats, decoding
+// the Ethernet, IP, TCP and UDP headers of each packet
+
+const (
+	pcapMaxPackets     = 1 << 16
+	pcapngSectionBlock = 0x0A0D0D0A
+	pcapngByteOrder    = 0x1A2B3C4D
+)
+
+var pcapLinkTypes = map[uint64]string{
+	0:   "loopback",
+	1:   "Ethernet",
+	101: "raw IP",
+	113: "Linux cooked",
+	228: "IPv4",
+	229: "IPv6",
+}
+
+var pcapngBlocks = map[uint64]string{
+	1:                  "Interface Description",
+	2:                  "Packet",
+	3:                  "Simple Packet",
+	4:                  "Name Resolution",
+	5:                  "Interface Statistics",
+	6:                  "Enhanced Packet",
+	10:                 "Decryption Secrets",
+	pcapngSectionBlock: "Section Header",
+}
+
+var ipProtocols = map[uint64]string{1: "ICMP", 2: "IGMP", 6: "TCP", 17: "UDP", 41: "IPv6", 47: "GRE", 50: "ESP", 58: "ICMPv6", 132: "SCTP"}
+
+var tcpFlags = []string{"FIN", "SYN", "RST", "PSH", "ACK", "URG", "ECE", "CWR"}
+
+func detectPCAP(head []byte) bool {
+	if len(head) < 24 {
+		return false
+	}
+	for _, magic := range []uint32{binary.LittleEndian.Uint32(head), binary.BigEndian.Uint32(head)} {
+		if magic == 0xA1B2C3D4 || magic == 0xA1B23C4D {
+			return true
+		}
+	}
+	return false
+}
+
+func parsePCAP(r io.ReaderAt, size int64) ([]*node, error) {
+	b := make([]byte, 4)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if m := binary.BigEndian.Uint32(b); m == 0xA1B2C3D4 || m == 0xA1B23C4D {
+		order = binary.BigEndian
+	}
+	header, h, err := readFields(r, 0, order, []structField{
+		{"magic", 4, nil},
+		{"version major", 2, nil},
+		{"version minor", 2, nil},
+		{"thiszone", 4, nil},
+		{"sigfigs", 4, nil},
+		{"snaplen", 4, nil},
+		{"network", 4, pcapLinkType},
+	})
+	if err != nil {
+		return nil, err
+	}
+	nano := h["magic"] == 0xA1B23C4D
+	nodes := []*node{group("File header", pcapLinkType(h["network"]), header)}
+
+	// records follow the header
+	var packets []*node
+	pos := int64(24)
+	for i := 0; pos+16 <= size; i++ {
+		if i == pcapMaxPackets {
+			err = fmt.Errorf("showing the first %d packets", pcapMaxPackets)
+			break
+		}
+		record, v, e := readFields(r, pos, order, []structField{
+			{"ts_sec", 4, nil},
+			{"ts_usec", 4, nil},
+			{"incl_len", 4, nil},
+			{"orig_len", 4, nil},
+		})
+		if e != nil {
+			err = e
+			break
+		}
+		length := int64(v["incl_len"])
+		if pos+16+length > size {
+			err = fmt.Errorf("packet %d at %08X is truncated", i, pos)
+			break
+		}
+		ts := time.Unix(int64(v["ts_sec"]), int64(v["ts_usec"])*1000)
+		if nano {
+			record[1].name = "ts_nsec"
+			ts = time.Unix(int64(v["ts_sec"]), int64(v["ts_usec"]))
+		}
+		n := pcapPacket(r, i, pos+16, length, h["network"], ts, v["orig_len"])
+		n.children = append([]*node{group("record header", "", record)}, n.children...)
+		packets = append(packets, n)
+		pos += 16 + length
+	}
+	if len(packets) > 0 {
+		nodes = append(nodes, group("Packets", fmt.Sprintf("[%d]", len(packets)), packets))
+	}
+	return nodes, err
+}
+
+func detectPCAPNG(head []byte) bool {
+	if len(head) < 12 || binary.BigEndian.Uint32(head) != pcapngSectionBlock {
+		return false
+	}
+	return binary.LittleEndian.Uint32(head[8:]) == pcapngByteOrder || binary.BigEndian.Uint32(head[8:]) == pcapngByteOrder
+}
+
+// pcapngInterface is an interface described in a pcapng section
+type pcapngInterface struct {
+	link       uint64
+	resolution byte // if_tsresol option, a negative power of 10, or of 2 if the high bit is set
+}
+
+func parsePCAPNG(r io.ReaderAt, size int64) ([]*node, error) {
+	var nodes, packets []*node
+	var interfaces []pcapngInterface
+	var order binary.ByteOrder = binary.LittleEndian
+	var err error
+	pos := int64(0)
+	for pos+12 <= size {
+		b := make([]byte, 12)
+		if _, err := r.ReadAt(b, pos); err != nil {
+			return nodes, err
+		}
+
+		// sections start with their byte order, and have their own interfaces
+		if binary.BigEndian.Uint32(b) == pcapngSectionBlock {
+			order = binary.LittleEndian
+			if binary.BigEndian.Uint32(b[8:]) == pcapngByteOrder {
+				order = binary.BigEndian
+			}
+			interfaces = nil
+		}
+		typ, length := uint64(order.Uint32(b)), int64(order.Uint32(b[4:]))
+		if length < 12 || length%4 != 0 || pos+length > size {
+			return append(nodes, pcapngGroup(packets)...), fmt.Errorf("invalid block length %d at %08X", length, pos)
+		}
+		fields := []structField{{"block type", 4, pcapngBlock}, {"block length", 4, nil}}
+		switch typ {
+		case pcapngSectionBlock:
+			fields = append(fields, []structField{{"byte order magic", 4, nil}, {"version major", 2, nil},
+				{"version minor", 2, nil}, {"section length", 8, nil}}...)
+		case 1:
+			fields = append(fields, []structField{{"link type", 2, pcapLinkType}, {"reserved", 2, nil},
+				{"snaplen", 4, nil}}...)
+		case 2:
+			fields = append(fields, []structField{{"interface id", 2, nil}, {"drops count", 2, nil},
+				{"timestamp high", 4, nil}, {"timestamp low", 4, nil}, {"captured length", 4, nil},
+				{"original length", 4, nil}}...)
+		case 3:
+			fields = append(fields, structField{"original length", 4, nil})
+		case 6:
+			fields = append(fields, []structField{{"interface id", 4, nil}, {"timestamp high", 4, nil},
+				{"timestamp low", 4, nil}, {"captured length", 4, nil}, {"original length", 4, nil}}...)
+		}
+		header, v, e := readFields(r, pos, order, fields)
+		if e != nil || header[len(header)-1].end > pos+length-4 {
+			return append(nodes, pcapngGroup(packets)...), fmt.Errorf("block at %08X is truncated", pos)
+		}
+		body := header[len(header)-1].end
+		trailer := &node{name: "block length", value: fmt.Sprint(length), start: pos + length - 4, end: pos + length}
+
+		name, ok := pcapngBlocks[typ]
+		if !ok {
+			name = fmt.Sprintf("0x%X", typ)
+		}
+		switch typ {
+		case 2, 3, 6:
+			if len(packets) == pcapMaxPackets {
+				err = fmt.Errorf("showing the first %d packets", pcapMaxPackets)
+				return append(nodes, pcapngGroup(packets)...), err
+			}
+			iface := pcapngInterface{resolution: 6}
+			if id := int(v["interface id"]); id < len(interfaces) {
+				iface = interfaces[id]
+			}
+			captured := min64(int64(v["captured length"]), pos+length-4-body)
+			if typ == 3 {
+				captured = min64(int64(v["original length"]), pos+length-4-body)
+				if len(interfaces) > 0 {
+					iface = interfaces[0]
+				}
+			}
+			ts := iface.time(v["timestamp high"]<<32 | v["timestamp low"])
+			n := pcapPacket(r, len(packets), body, captured, iface.link, ts, v["original length"])
+			n.children = append([]*node{group(name+" block", "", header)}, n.children...)
+			n.children = append(n.children, trailer)
+			packets = append(packets, n)
+		default:
+			if typ == 1 {
+				iface := pcapngInterface{link: v["link type"], resolution: 6}
+				if o, ok := pcapngOption(r, order, body, pos+length-4, 9); ok && len(o) == 1 {
+					iface.resolution = o[0]
+				}
+				interfaces = append(interfaces, iface)
+				name += fmt.Sprintf(" [%d]", len(interfaces)-1)
+			}
+			if body < pos+length-4 {
+				header = append(header, &node{name: "body", value: fmt.Sprintf("%d bytes", pos+length-4-body), start: body, end: pos + length - 4})
+			}
+			value := ""
+			if typ == 1 {
+				value = pcapLinkType(v["link type"])
+			}
+			nodes = append(nodes, group(name, value, append(header, trailer)))
+		}
+		pos += length
+	}
+	return append(nodes, pcapngGroup(packets)...), err
+}
+
+// pcapngGroup returns a node containing the packets, if any
+func pcapngGroup(packets []*node) []*node {
+	if len(packets) == 0 {
+		return nil
+	}
+	return []*node{group("Packets", fmt.Sprintf("[%d]", len(packets)), packets)}
+}
+
+// pcapngOption returns the value of the option with the given code in the
+// options from start to end
+func pcapngOption(r io.ReaderAt, order binary.ByteOrder, start, end int64, code uint16) ([]byte, bool) {
+	for pos := start; pos+4 <= end; {
+		b := make([]byte, 4)
+		if _, err := r.ReadAt(b, pos); err != nil {
+			return nil, false
+		}
+		c, length := order.Uint16(b), int64(order.Uint16(b[2:]))
+		if c == 0 || pos+4+length > end {
+			break
+		}
+		if c == code {
+			v := make([]byte, length)
+			_, err := r.ReadAt(v, pos+4)
+			return v, err == nil
+		}
+		pos += 4 + (length+3)&^3
+	}
+	return nil, false
+}
+
+// time converts a timestamp in units of the interface's resolution
+func (i pcapngInterface) time(ts uint64) time.Time {
+	if i.resolution&0x80 != 0 {
+		s := float64(ts) / math.Pow(2, float64(i.resolution&0x7F))
+		return time.Unix(0, 0).Add(time.Duration(s * 1e9))
+	}
+	units := uint64(1)
+	for n := byte(0); n < i.resolution && n < 19; n++ {
+		units *= 10
+	}
+	frac := ts % units
+	if units > 1e9 {
+		frac /= units / 1e9
+	} else {
+		frac *= 1e9 / units
+	}
+	return time.Unix(int64(ts/units), int64(frac))
+}
+
+func pcapLinkType(v uint64) string {
+	if s, ok := pcapLinkTypes[v]; ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+func pcapngBlock(v uint64) string {
+	if s, ok := pcapngBlocks[v]; ok {
+		return s
+	}
+	return fmt.Sprintf("0x%X", v)
+}
+
+// pcapPacket decodes packet i of length bytes at offset, captured at ts
+// on a link of the given type. the node covers the packet data, and has a
+// child for each protocol layer, colored by layer.
+func pcapPacket(r io.ReaderAt, i int, offset, length int64, link uint64, ts time.Time, orig uint64) *node {
+	b := make([]byte, length)
+	if _, err := r.ReadAt(b, offset); err != nil {
+		b = nil
+	}
+	summary, layers := pcapLayers(r, b, offset, link)
+	return &node{
+		name:     fmt.Sprintf("[%d] %s", i, formatTime(ts)),
+		value:    fmt.Sprintf("%d bytes %s", orig, summary),
+		start:    offset,
+		end:      offset + length,
+		children: layers,
+	}
+}
+
+// pcapLayers decodes the headers of the packet b at offset, returning a
+// summary of the packet and a node for each layer
+func pcapLayers(r io.ReaderAt, b []byte, offset int64, link uint64) (string, []*node) {
+	var layers []*node
+	pos := 0
+	end := len(b)
+
+	// layer adds a layer of fields following the previous one, returning
+	// their values, or nil if the packet is too short
+	layer := func(name string, fields []structField) map[string]uint64 {
+		size := 0
+		for _, f := range fields {
+			size += f.size
+		}
+		if size > end-pos {
+			return nil
+		}
+		nodes, v, err := readFields(r, offset+int64(pos), binary.BigEndian, fields)
+		if err != nil {
+			return nil
+		}
+		n := group(name, "", nodes)
+		n.color = treeColors[len(layers)%len(treeColors)]
+		layers = append(layers, n)
+		pos += size
+		return v
+	}
+
+	// link layer
+	summary := pcapLinkType(link)
+	var ethertype uint64
+	switch link {
+	case 0:
+		if v := layer("Loopback", []structField{{"family", 4, nil}}); v != nil {
+			// the family is in host byte order of the capturing machine
+			family := uint64(binary.LittleEndian.Uint32(b))
+			if family > 0xFFFF {
+				family = v["family"]
+			}
+			switch family {
+			case 2:
+				ethertype = 0x800
+			case 24, 28, 30:
+				ethertype = 0x86DD
+			}
+		}
+	case 1:
+		v := layer("Ethernet", []structField{{"destination", 6, formatMAC}, {"source", 6, formatMAC}, {"type", 2, nil}})
+		for v != nil {
+			ethertype = v["type"]
+			if ethertype != 0x8100 && ethertype != 0x88A8 {
+				break
+			}
+			v = layer("VLAN", []structField{{"tag control", 2, nil}, {"type", 2, nil}})
+		}
+	case 113:
+		if v := layer("Linux cooked", []structField{{"packet type", 2, nil}, {"address type", 2, nil},
+			{"address length", 2, nil}, {"address", 8, nil}, {"protocol", 2, nil}}); v != nil {
+			ethertype = v["protocol"]
+		}
+	case 101:
+		if len(b) > 0 && b[0]>>4 == 4 {
+			ethertype = 0x800
+		} else if len(b) > 0 && b[0]>>4 == 6 {
+			ethertype = 0x86DD
+		}
+	case 228:
+		ethertype = 0x800
+	case 229:
+		ethertype = 0x86DD
+	}
+	if ethertype != 0 {
+		summary = fmt.Sprintf("type 0x%04X", ethertype)
+	}
+
+	// network layer
+	var protocol uint64
+	var src, dst string
+	switch ethertype {
+	case 0x800:
+		if pos >= end || b[pos]>>4 != 4 || int(b[pos]&0xF)*4 < 20 {
+			break
+		}
+		start, ihl := pos, int(b[pos]&0xF)*4
+		fields := []structField{{"version, IHL", 1, nil}, {"DSCP, ECN", 1, nil}, {"total length", 2, nil},
+			{"identification", 2, nil}, {"flags, fragment offset", 2, nil}, {"TTL", 1, nil},
+			{"protocol", 1, ipProtocol}, {"header checksum", 2, nil}, {"source", 4, formatIPv4},
+			{"destination", 4, formatIPv4}}
+		if ihl > 20 {
+			fields = append(fields, structField{"options", ihl - 20, nil})
+		}
+		v := layer("IPv4", fields)
+		if v == nil {
+			break
+		}
+		protocol = v["protocol"]
+		src, dst = formatIPv4(v["source"]), formatIPv4(v["destination"])
+		summary = fmt.Sprintf("IPv4 %s -> %s %s", src, dst, ipProtocol(protocol))
+		if total := int(v["total length"]); total >= ihl && start+total < end {
+			end = start + total
+		}
+		if v["flags, fragment offset"]&0x1FFF != 0 {
+			// only the first fragment contains the header of the next layer
+			protocol = 0
+			summary += " fragment"
+		}
+	case 0x86DD:
+		start := pos
+		v := layer("IPv6", []structField{{"version, class, flow label", 4, nil}, {"payload length", 2, nil},
+			{"next header", 1, ipProtocol}, {"hop limit", 1, nil}, {"source", 16, nil}, {"destination", 16, nil}})
+		if v == nil {
+			break
+		}
+		ip := layers[len(layers)-1].children
+		src, dst = net.IP(b[start+8:start+24]).String(), net.IP(b[start+24:start+40]).String()
+		ip[4].value, ip[5].value = src, dst
+		src, dst = "["+src+"]", "["+dst+"]"
+		protocol = v["next header"]
+		summary = fmt.Sprintf("IPv6 %s -> %s %s", src, dst, ipProtocol(protocol))
+		if payload := int(v["payload length"]); payload > 0 && pos+payload < end {
+			end = pos + payload
+		}
+	case 0x806:
+		if v := layer("ARP", []structField{{"hardware type", 2, nil}, {"protocol type", 2, nil},
+			{"hardware length", 1, nil}, {"protocol length", 1, nil}, {"operation", 2, nil}}); v != nil {
+			summary = "ARP request"
+			if v["operation"] == 2 {
+				summary = "ARP reply"
+			}
+		}
+	}
+
+	// transport layer
+	switch protocol {
+	case 6:
+		if pos+12 >= end {
+			break
+		}
+		size := int(b[pos+12]>>4) * 4
+		fields := []structField{{"source port", 2, nil}, {"destination port", 2, nil},
+			{"sequence number", 4, nil}, {"acknowledgment number", 4, nil},
+			{"data offset, flags", 2, formatTCPFlags}, {"window", 2, nil},
+			{"checksum", 2, nil}, {"urgent pointer", 2, nil}}
+		if size > 20 {
+			fields = append(fields, structField{"options", size - 20, nil})
+		}
+		if v := layer("TCP", fields); v != nil {
+			summary = fmt.Sprintf("TCP %s:%d -> %s:%d [%s]", src, v["source port"], dst, v["destination port"],
+				formatTCPFlags(v["data offset, flags"]))
+		}
+	case 17:
+		if v := layer("UDP", []structField{{"source port", 2, nil}, {"destination port", 2, nil},
+			{"length", 2, nil}, {"checksum", 2, nil}}); v != nil {
+			summary = fmt.Sprintf("UDP %s:%d -> %s:%d", src, v["source port"], dst, v["destination port"])
+		}
+	case 1, 58:
+		if v := layer(ipProtocol(protocol), []structField{{"type", 1, nil}, {"code", 1, nil},
+			{"checksum", 2, nil}}); v != nil {
+			summary = fmt.Sprintf("%s %s -> %s type %d", ipProtocol(protocol), src, dst, v["type"])
+		}
+	}
+
+	// the remaining bytes are the payload of the last layer, followed by padding
+	if pos < end {
+		layers = append(layers, &node{
+			name:  "payload",
+			value: formatBytes(b[pos:end]),
+			start: offset + int64(pos),
+			end:   offset + int64(end),
+			color: treeColors[len(layers)%len(treeColors)],
+		})
+	}
+	if end < len(b) {
+		layers = append(layers, &node{name: "padding", start: offset + int64(end), end: offset + int64(len(b))})
+	}
+	return summary, layers
+}
+
+func ipProtocol(v uint64) string {
+	if s, ok := ipProtocols[v]; ok {
+		return s
+	}
+	return fmt.Sprintf("protocol %d", v)
+}
+
+func formatIPv4(v uint64) string {
+	return net.IPv4(byte(v>>24), byte(v>>16), byte(v>>8), byte(v)).String()
+}
+
+func formatMAC(v uint64) string {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return net.HardwareAddr(b[2:]).String()
+}
+
+// formatTCPFlags formats the flags in the data offset and flags field of TCP
+func formatTCPFlags(v uint64) string {
+	var flags []string
+	for i, f := range tcpFlags {
+		if v&(1<<uint(i)) != 0 {
+			flags = append(flags, f)
+		}
+	}
+	return strings.Join(flags, ",")
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// this file contains the PE/COFF executable format
+
+// peMaxEntries limits the number of import entries decoded in total, and of
+// export entries, so corrupt tables do not take forever
+const peMaxEntries = 65536
+
+var peMachines = map[uint64]string{
+	pe.IMAGE_FILE_MACHINE_UNKNOWN: "UNKNOWN",
+	pe.IMAGE_FILE_MACHINE_I386:    "I386",
+	pe.IMAGE_FILE_MACHINE_AMD64:   "AMD64",
+	pe.IMAGE_FILE_MACHINE_ARM:     "ARM",
+	pe.IMAGE_FILE_MACHINE_ARMNT:   "ARMNT",
+	pe.IMAGE_FILE_MACHINE_ARM64:   "ARM64",
+	pe.IMAGE_FILE_MACHINE_IA64:    "IA64",
+	pe.IMAGE_FILE_MACHINE_THUMB:   "THUMB",
+	pe.IMAGE_FILE_MACHINE_RISCV64: "RISCV64",
+}
+
+var peSubsystems = map[uint64]string{
+	pe.IMAGE_SUBSYSTEM_NATIVE:                  "NATIVE",
+	pe.IMAGE_SUBSYSTEM_WINDOWS_GUI:             "WINDOWS_GUI",
+	pe.IMAGE_SUBSYSTEM_WINDOWS_CUI:             "WINDOWS_CUI",
+	pe.IMAGE_SUBSYSTEM_POSIX_CUI:               "POSIX_CUI",
+	pe.IMAGE_SUBSYSTEM_EFI_APPLICATION:         "EFI_APPLICATION",
+	pe.IMAGE_SUBSYSTEM_EFI_BOOT_SERVICE_DRIVER: "EFI_BOOT_SERVICE_DRIVER",
+	pe.IMAGE_SUBSYSTEM_EFI_RUNTIME_DRIVER:      "EFI_RUNTIME_DRIVER",
+}
+
+var peCharacteristics = []string{
+	"RELOCS_STRIPPED", "EXECUTABLE_IMAGE", "LINE_NUMS_STRIPPED", "LOCAL_SYMS_STRIPPED",
+	"AGGRESIVE_WS_TRIM", "LARGE_ADDRESS_AWARE", "", "BYTES_REVERSED_LO",
+	"32BIT_MACHINE", "DEBUG_STRIPPED", "REMOVABLE_RUN_FROM_SWAP", "NET_RUN_FROM_SWAP",
+	"SYSTEM", "DLL", "UP_SYSTEM_ONLY", "BYTES_REVERSED_HI",
+}
+
+var peSectionFlags = []struct {
+	bit  uint64
+	name string
+}{
+	{pe.IMAGE_SCN_CNT_CODE, "CODE"},
+	{pe.IMAGE_SCN_CNT_INITIALIZED_DATA, "INITIALIZED_DATA"},
+	{pe.IMAGE_SCN_CNT_UNINITIALIZED_DATA, "UNINITIALIZED_DATA"},
+	{pe.IMAGE_SCN_MEM_DISCARDABLE, "DISCARDABLE"},
+	{0x10000000, "SHARED"},
+	{pe.IMAGE_SCN_MEM_EXECUTE, "EXECUTE"},
+	{pe.IMAGE_SCN_MEM_READ, "READ"},
+	{pe.IMAGE_SCN_MEM_WRITE, "WRITE"},
+}
+
+var peDirectories = []string{
+	"Export", "Import", "Resource", "Exception", "Certificate", "Base relocation",
+	"Debug", "Architecture", "Global pointer", "TLS", "Load config", "Bound import",
+	"IAT", "Delay import", "CLR runtime", "Reserved",
+}
+
+func detectPE(head []byte) bool {
+	if len(head) < 64 || !bytes.HasPrefix(head, []byte("MZ")) {
+		return false
+	}
+	lfanew := int(binary.LittleEndian.Uint32(head[60:]))
+	return lfanew+4 <= len(head) && bytes.Equal(head[lfanew:lfanew+4], []byte("PE\x00\x00"))
+}
+
+func parsePE(r io.ReaderAt, size int64) ([]*node, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	order := binary.LittleEndian
+
+	// DOS header and stub
+	dos, d, err := readFields(r, 0, order, []structField{
+		{"e_magic", 2, nil}, {"e_cblp", 2, nil}, {"e_cp", 2, nil}, {"e_crlc", 2, nil},
+		{"e_cparhdr", 2, nil}, {"e_minalloc", 2, nil}, {"e_maxalloc", 2, nil}, {"e_ss", 2, nil},
+		{"e_sp", 2, nil}, {"e_csum", 2, nil}, {"e_ip", 2, nil}, {"e_cs", 2, nil},
+		{"e_lfarlc", 2, nil}, {"e_ovno", 2, nil}, {"e_res", 8, nil}, {"e_oemid", 2, nil},
+		{"e_oeminfo", 2, nil}, {"e_res2", 20, nil}, {"e_lfanew", 4, nil},
+	})
+	if err != nil {
+		return nil, err
+	}
+	dos[0].value = `"MZ"`
+	nodes := []*node{group("DOS header", "", dos)}
+	lfanew := int64(d["e_lfanew"])
+	if lfanew > 64 {
+		nodes = append(nodes, &node{name: "DOS stub", value: fmt.Sprintf("%d bytes", lfanew-64), start: 64, end: lfanew})
+	}
+
+	// PE signature and COFF file header
+	header, h, err := readFields(r, lfanew, order, []structField{
+		{"Signature", 4, nil},
+		{"Machine", 2, peMachine},
+		{"NumberOfSections", 2, nil},
+		{"TimeDateStamp", 4, func(v uint64) string { return formatTime(time.Unix(int64(v), 0)) }},
+		{"PointerToSymbolTable", 4, nil},
+		{"NumberOfSymbols", 4, nil},
+		{"SizeOfOptionalHeader", 2, nil},
+		{"Characteristics", 2, func(v uint64) string { return peFlags(v, peCharacteristics) }},
+	})
+	if err != nil {
+		return nodes, err
+	}
+	header[0].value = `"PE\x00\x00"`
+	nodes = append(nodes, group("PE header", peMachine(h["Machine"]), header))
+
+	// optional header, whose address sized fields depend on its magic
+	offset := lfanew + 24
+	addr := 4
+	if _, ok := f.OptionalHeader.(*pe.OptionalHeader64); ok {
+		addr = 8
+	}
+	fields := []structField{
+		{"Magic", 2, nil},
+		{"MajorLinkerVersion", 1, nil},
+		{"MinorLinkerVersion", 1, nil},
+		{"SizeOfCode", 4, nil},
+		{"SizeOfInitializedData", 4, nil},
+		{"SizeOfUninitializedData", 4, nil},
+		{"AddressOfEntryPoint", 4, nil},
+		{"BaseOfCode", 4, nil},
+	}
+	if addr == 4 {
+		fields = append(fields, structField{"BaseOfData", 4, nil})
+	}
+	fields = append(fields, []structField{
+		{"ImageBase", addr, nil},
+		{"SectionAlignment", 4, nil},
+		{"FileAlignment", 4, nil},
+		{"MajorOperatingSystemVersion", 2, nil},
+		{"MinorOperatingSystemVersion", 2, nil},
+		{"MajorImageVersion", 2, nil},
+		{"MinorImageVersion", 2, nil},
+		{"MajorSubsystemVersion", 2, nil},
+		{"MinorSubsystemVersion", 2, nil},
+		{"Win32VersionValue", 4, nil},
+		{"SizeOfImage", 4, nil},
+		{"SizeOfHeaders", 4, nil},
+		{"CheckSum", 4, nil},
+		{"Subsystem", 2, func(v uint64) string { return peSubsystems[v] }},
+		{"DllCharacteristics", 2, nil},
+		{"SizeOfStackReserve", addr, nil},
+		{"SizeOfStackCommit", addr, nil},
+		{"SizeOfHeapReserve", addr, nil},
+		{"SizeOfHeapCommit", addr, nil},
+		{"LoaderFlags", 4, nil},
+		{"NumberOfRvaAndSizes", 4, nil},
+	}...)
+	var dirs [][2]uint32 // rva and size of data directories
+	if h["SizeOfOptionalHeader"] > 0 {
+		opt, o, err := readFields(r, offset, order, fields)
+		if err != nil {
+			return nodes, err
+		}
+		opt[0].value = "PE32"
+		if addr == 8 {
+			opt[0].value = "PE32+"
+		}
+
+		// data directories follow the fixed fields
+		pos := opt[len(opt)-1].end
+		var entries []*node
+		for i := 0; i < int(o["NumberOfRvaAndSizes"]) && i < len(peDirectories); i++ {
+			entry, e, err := readFields(r, pos+int64(i)*8, order, []structField{
+				{"VirtualAddress", 4, nil},
+				{"Size", 4, nil},
+			})
+			if err != nil {
+				return nodes, err
+			}
+			dirs = append(dirs, [2]uint32{uint32(e["VirtualAddress"]), uint32(e["Size"])})
+			n := group(fmt.Sprintf("[%d] %s", i, peDirectories[i]), "none", entry)
+			if e["Size"] > 0 {
+				n.value = fmt.Sprintf("rva 0x%X size 0x%X", e["VirtualAddress"], e["Size"])
+				n.children = []*node{group("entry", "", entry)}
+				start, ok := peOffset(f, uint32(e["VirtualAddress"]))
+				if i == 4 {
+					// the certificate table is not loaded, so its address is a file offset
+					start, ok = int64(e["VirtualAddress"]), true
+				}
+				if ok {
+					n.start, n.end = start, start+int64(e["Size"])
+				}
+			}
+			entries = append(entries, n)
+		}
+		if len(entries) > 0 {
+			n := group("Data directories", fmt.Sprintf("[%d]", len(entries)), entries)
+			n.start, n.end = pos, pos+int64(len(entries))*8
+			opt = append(opt, n)
+		}
+		n := group("Optional header", opt[0].value, opt)
+		n.start, n.end = offset, offset+int64(h["SizeOfOptionalHeader"])
+		nodes = append(nodes, n)
+	}
+
+	// section table
+	var sections []*node
+	offset += int64(h["SizeOfOptionalHeader"])
+	for i, s := range f.Sections {
+		entry, _, err := readFields(r, offset+int64(i)*40, order, []structField{
+			{"Name", 8, nil},
+			{"VirtualSize", 4, nil},
+			{"VirtualAddress", 4, nil},
+			{"SizeOfRawData", 4, nil},
+			{"PointerToRawData", 4, nil},
+			{"PointerToRelocations", 4, nil},
+			{"PointerToLinenumbers", 4, nil},
+			{"NumberOfRelocations", 2, nil},
+			{"NumberOfLinenumbers", 2, nil},
+			{"Characteristics", 4, peSectionFlag},
+		})
+		if err != nil {
+			return nodes, err
+		}
+		entry[0].value = fmt.Sprintf("%q", s.Name)
+		sections = append(sections, &node{
+			name:     fmt.Sprintf("[%d] %s", i, s.Name),
+			value:    fmt.Sprintf("offset 0x%X rva 0x%X size 0x%X", s.Offset, s.VirtualAddress, s.Size),
+			start:    int64(s.Offset),
+			end:      int64(s.Offset) + int64(s.Size),
+			children: []*node{group("header", "", entry)},
+		})
+	}
+	if len(sections) > 0 {
+		n := group("Section table", fmt.Sprintf("[%d]", len(sections)), sections)
+		n.start, n.end = offset, offset+int64(len(sections))*40
+		nodes = append(nodes, n)
+	}
+
+	// imports and exports
+	if len(dirs) > 1 && dirs[1][1] > 0 {
+		n, err := peImports(r, f, dirs[1][0], addr)
+		if n != nil {
+			nodes = append(nodes, n)
+		}
+		if err != nil {
+			return nodes, err
+		}
+	}
+	if len(dirs) > 0 && dirs[0][1] > 0 {
+		n, err := peExports(r, f, dirs[0][0])
+		if n != nil {
+			nodes = append(nodes, n)
+		}
+		if err != nil {
+			return nodes, err
+		}
+	}
+
+	return nodes, nil
+}
+
+// peImports decodes the import descriptors at rva and the functions imported from each library
+func peImports(r io.ReaderAt, f *pe.File, rva uint32, addr int) (*node, error) {
+	offset, ok := peOffset(f, rva)
+	if !ok {
+		return nil, fmt.Errorf("import directory at rva 0x%X is not in a section", rva)
+	}
+	order := binary.LittleEndian
+	var libs []*node
+	entries := 0 // descriptors and functions, shared by all libraries
+	for i := uint32(0); entries < peMaxEntries; i++ {
+		o, ok := peOffset(f, rva+i*20)
+		if !ok {
+			break
+		}
+		entries++
+		desc, d, err := readFields(r, o, order, []structField{
+			{"OriginalFirstThunk", 4, nil},
+			{"TimeDateStamp", 4, nil},
+			{"ForwarderChain", 4, nil},
+			{"Name", 4, nil},
+			{"FirstThunk", 4, nil},
+		})
+		if err != nil {
+			return group("Imports", "", libs), err
+		}
+		if d["Name"] == 0 && d["FirstThunk"] == 0 {
+			break
+		}
+		name := ""
+		if o, ok := peOffset(f, uint32(d["Name"])); ok {
+			name = readCString(r, o, 256)
+		}
+		children := []*node{group("descriptor", "", desc)}
+
+		// lookup table, which is the address table in bound imports
+		thunk := uint32(d["OriginalFirstThunk"])
+		if thunk == 0 {
+			thunk = uint32(d["FirstThunk"])
+		}
+		for j := uint32(0); thunk != 0 && entries < peMaxEntries; j++ {
+			o, ok := peOffset(f, thunk+j*uint32(addr))
+			if !ok {
+				break
+			}
+			entries++
+			b := make([]byte, addr)
+			if _, err := r.ReadAt(b, o); err != nil {
+				break
+			}
+			v := getUint(b, addr, order)
+			if v == 0 {
+				break
+			}
+			n := &node{start: o, end: o + int64(addr)}
+			if v>>(addr*8-1) != 0 {
+				n.name = fmt.Sprintf("ordinal %d", v&0xFFFF)
+			} else if h, ok := peOffset(f, uint32(v)); ok {
+				n.name = readCString(r, h+2, 256)
+				n.value = fmt.Sprintf("hint/name at 0x%X", h)
+			}
+			children = append(children, n)
+		}
+		libs = append(libs, &node{
+			name:     name,
+			value:    fmt.Sprintf("%d functions", len(children)-1),
+			start:    desc[0].start,
+			end:      desc[len(desc)-1].end,
+			children: children,
+		})
+	}
+	n := group("Imports", fmt.Sprintf("[%d]", len(libs)), libs)
+	n.start, n.end = offset, offset+int64(len(libs)+1)*20
+	return n, nil
+}
+
+// peExports decodes the export directory at rva and the exported names
+func peExports(r io.ReaderAt, f *pe.File, rva uint32) (*node, error) {
+	offset, ok := peOffset(f, rva)
+	if !ok {
+		return nil, fmt.Errorf("export directory at rva 0x%X is not in a section", rva)
+	}
+	order := binary.LittleEndian
+	dir, d, err := readFields(r, offset, order, []structField{
+		{"Characteristics", 4, nil},
+		{"TimeDateStamp", 4, nil},
+		{"MajorVersion", 2, nil},
+		{"MinorVersion", 2, nil},
+		{"Name", 4, nil},
+		{"Base", 4, nil},
+		{"NumberOfFunctions", 4, nil},
+		{"NumberOfNames", 4, nil},
+		{"AddressOfFunctions", 4, nil},
+		{"AddressOfNames", 4, nil},
+		{"AddressOfNameOrdinals", 4, nil},
+	})
+	if err != nil {
+		return nil, err
+	}
+	name := ""
+	if o, ok := peOffset(f, uint32(d["Name"])); ok {
+		name = readCString(r, o, 256)
+	}
+	children := []*node{group("directory", "", dir)}
+
+	// each name has an ordinal indexing the function address table
+	names, ok1 := peOffset(f, uint32(d["AddressOfNames"]))
+	ordinals, ok2 := peOffset(f, uint32(d["AddressOfNameOrdinals"]))
+	functions, ok3 := peOffset(f, uint32(d["AddressOfFunctions"]))
+	for i := 0; ok1 && ok2 && ok3 && i < int(d["NumberOfNames"]) && i < peMaxEntries; i++ {
+		b := make([]byte, 4)
+		if _, err := r.ReadAt(b, names+int64(i)*4); err != nil {
+			break
+		}
+		s := ""
+		if o, ok := peOffset(f, order.Uint32(b)); ok {
+			s = readCString(r, o, 256)
+		}
+		if _, err := r.ReadAt(b[:2], ordinals+int64(i)*2); err != nil {
+			break
+		}
+		ordinal := int64(order.Uint16(b))
+		entry := functions + ordinal*4
+		if _, err := r.ReadAt(b, entry); err != nil {
+			break
+		}
+		value := fmt.Sprintf("ordinal %d rva 0x%X", ordinal+int64(d["Base"]), order.Uint32(b))
+		if o, ok := peOffset(f, order.Uint32(b)); ok {
+			value += fmt.Sprintf(" offset 0x%X", o)
+		}
+		children = append(children, &node{name: s, value: value, start: entry, end: entry + 4})
+	}
+	return &node{
+		name:     "Exports",
+		value:    name,
+		start:    offset,
+		end:      offset + 40,
+		children: children,
+	}, nil
+}
+
+// peOffset converts a relative virtual address to a file offset
+func peOffset(f *pe.File, rva uint32) (int64, bool) {
+	if len(f.Sections) > 0 && rva < f.Sections[0].VirtualAddress {
+		// headers are mapped at the image base
+		return int64(rva), true
+	}
+	for _, s := range f.Sections {
+		if rva >= s.VirtualAddress && rva-s.VirtualAddress < s.Size {
+			return int64(s.Offset) + int64(rva-s.VirtualAddress), true
+		}
+	}
+	return 0, false
+}
+
+func peMachine(v uint64) string {
+	if s, ok := peMachines[v]; ok {
+		return s
+	}
+	return fmt.Sprintf("0x%X", v)
+}
+
+func peSectionFlag(v uint64) string {
+	var flags []string
+	for _, f := range peSectionFlags {
+		if v&f.bit != 0 {
+			flags = append(flags, f.name)
+		}
+	}
+	return strings.Join(flags, "+")
+}
+
+// peFlags names the set bits of v
+func peFlags(v uint64, names []string) string {
+	var flags []string
+	for i, s := range names {
+		if v&(1<<uint(i)) != 0 && s != "" {
+			flags = append(flags, s)
+		}
+	}
+	return strings.Join(flags, "+")
+}
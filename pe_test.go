@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// peTestFile returns a PE32 file with a single section at rva 0x1000
+// holding section, whose start is the import directory
+func peTestFile(section []byte) []byte {
+	order := binary.LittleEndian
+	b := make([]byte, 0x200+len(section))
+	copy(b, "MZ")
+	order.PutUint32(b[0x3C:], 0x40)
+	copy(b[0x40:], "PE\x00\x00")
+	order.PutUint16(b[0x44:], 0x14C) // I386
+	order.PutUint16(b[0x46:], 1)     // sections
+	order.PutUint16(b[0x54:], 224)   // size of optional header
+	order.PutUint16(b[0x56:], 0x102)
+
+	opt := b[0x58:]
+	order.PutUint16(opt, 0x10B)
+	order.PutUint32(opt[28:], 0x400000) // image base
+	order.PutUint32(opt[60:], 0x200)    // size of headers
+	order.PutUint32(opt[92:], 16)       // data directories
+	order.PutUint32(opt[104:], 0x1000)  // import directory
+	order.PutUint32(opt[108:], 20)
+
+	sh := b[0x58+224:]
+	copy(sh, ".idata")
+	order.PutUint32(sh[8:], uint32(len(section)))
+	order.PutUint32(sh[12:], 0x1000)
+	order.PutUint32(sh[16:], uint32(len(section)))
+	order.PutUint32(sh[20:], 0x200)
+	copy(b[0x200:], section)
+	return b
+}
+
+// peTestImports returns an import directory of one library importing one function
+func peTestImports() []byte {
+	order := binary.LittleEndian
+	s := make([]byte, 0x200)
+	order.PutUint32(s[0:], 0x1100)  // original first thunk
+	order.PutUint32(s[12:], 0x1080) // name
+	order.PutUint32(s[16:], 0x1100) // first thunk
+	copy(s[0x80:], "a.dll")
+	order.PutUint32(s[0x100:], 0x1180)
+	copy(s[0x182:], "f")
+	return s
+}
+
+func TestPE(t *testing.T) {
+	nodes := parseValid(t, parsePE, peTestFile(peTestImports()))
+	lib := findNode(nodes, "a.dll")
+	if lib == nil || len(lib.children) != 2 || lib.children[1].name != "f" {
+		t.Fatalf("imports decoded as %v", findNode(nodes, "Imports"))
+	}
+}
+
+func TestPECorrupt(t *testing.T) {
+	parseCorrupt(t, parsePE, peTestFile(peTestImports()))
+}
+
+func TestPETruncated(t *testing.T) {
+	parseTruncated(t, parsePE, peTestFile(peTestImports()))
+}
+
+func TestPELoopingImports(t *testing.T) {
+	// every descriptor and thunk refers to the start of the section, and
+	// no table is terminated
+	s := make([]byte, 1<<20)
+	for i := 0; i < len(s); i += 4 {
+		binary.LittleEndian.PutUint32(s[i:], 0x1000)
+	}
+	start := time.Now()
+	nodes := parseValid(t, parsePE, peTestFile(s))
+	entries := 0
+	for _, lib := range findNode(nodes, "Imports").children {
+		entries += len(lib.children)
+	}
+	if entries > peMaxEntries {
+		t.Fatalf("decoded %d imports, want at most %d", entries, peMaxEntries)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("decoding imports took %v", d)
+	}
+}
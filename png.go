@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// this file contains the PNG image format
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+var pngColorTypes = map[uint64]string{
+	0: "grayscale",
+	2: "truecolor",
+	3: "indexed",
+	4: "grayscale with alpha",
+	6: "truecolor with alpha",
+}
+
+func detectPNG(head []byte) bool {
+	return bytes.HasPrefix(head, []byte(pngSignature))
+}
+
+func parsePNG(r io.ReaderAt, size int64) ([]*node, error) {
+	nodes := []*node{{name: "Signature", value: fmt.Sprintf("%q", pngSignature), start: 0, end: 8}}
+
+	// chunks follow the signature until IEND
+	pos := int64(8)
+	for i := 0; pos < size; i++ {
+		head := make([]byte, 8)
+		if _, err := r.ReadAt(head, pos); err != nil {
+			return nodes, fmt.Errorf("cannot read chunk at %08X: %v", pos, err)
+		}
+		length := int64(binary.BigEndian.Uint32(head))
+		typ := string(head[4:])
+		if pos+12+length > size {
+			return nodes, fmt.Errorf("chunk %s at %08X is truncated", typ, pos)
+		}
+
+		// checksum covers type and data
+		crc := crc32.NewIEEE()
+		crc.Write(head[4:])
+		if _, err := io.Copy(crc, io.NewSectionReader(r, pos+8, length)); err != nil {
+			return nodes, err
+		}
+		b := make([]byte, 4)
+		if _, err := r.ReadAt(b, pos+8+length); err != nil {
+			return nodes, err
+		}
+		stored, expected := binary.BigEndian.Uint32(b), crc.Sum32()
+
+		data := &node{name: "data", value: fmt.Sprintf("%d bytes", length), start: pos + 8, end: pos + 8 + length}
+		switch typ {
+		case "IHDR":
+			fields, _, err := readFields(r, pos+8, binary.BigEndian, []structField{
+				{"width", 4, nil},
+				{"height", 4, nil},
+				{"bit depth", 1, nil},
+				{"color type", 1, func(v uint64) string { return pngColorTypes[v] }},
+				{"compression", 1, nil},
+				{"filter", 1, nil},
+				{"interlace", 1, nil},
+			})
+			if err == nil {
+				data.children = fields
+			}
+		case "tEXt":
+			// keyword and text separated by a null byte
+			text := readCString(r, pos+8, int(min64(length, 1024)))
+			if len(text) < int(length) {
+				value := readCString(r, pos+9+int64(len(text)), int(min64(length-int64(len(text))-1, 1024)))
+				data.value = fmt.Sprintf("%q: %q", text, value)
+			}
+		}
+		chunk := &node{
+			name:  fmt.Sprintf("[%d] %s", i, typ),
+			value: fmt.Sprintf("length %d, CRC ok", length),
+			start: pos,
+			end:   pos + 12 + length,
+			children: []*node{
+				{name: "length", value: fmt.Sprintf("%d (0x%X)", length, length), start: pos, end: pos + 4},
+				{name: "type", value: fmt.Sprintf("%q", typ), start: pos + 4, end: pos + 8},
+				data,
+				{name: "crc", value: fmt.Sprintf("0x%08X ok", stored), start: pos + 8 + length, end: pos + 12 + length},
+			},
+		}
+		if stored != expected {
+			chunk.value = fmt.Sprintf("length %d, CRC bad", length)
+			crcNode := chunk.children[3]
+			crcNode.value = fmt.Sprintf("0x%08X bad, expected 0x%08X", stored, expected)
+			crcNode.fix = make([]byte, 4)
+			binary.BigEndian.PutUint32(crcNode.fix, expected)
+		}
+		nodes = append(nodes, chunk)
+		pos += 12 + length
+		if typ == "IEND" {
+			break
+		}
+	}
+
+	// data after the last chunk is ignored by decoders
+	if pos < size {
+		nodes = append(nodes, &node{name: "Trailing data", value: fmt.Sprintf("%d bytes", size-pos), start: pos, end: size})
+	}
+	return nodes, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// pngTestFile returns an encoded 2x2 image
+func pngTestFile(t *testing.T) []byte {
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestPNG(t *testing.T) {
+	b := pngTestFile(t)
+	nodes := parseValid(t, parsePNG, b)
+	if n := findNode(nodes, "[0] IHDR"); n == nil || !strings.HasSuffix(n.value, "CRC ok") {
+		t.Fatal("header chunk not decoded")
+	}
+
+	// a wrong checksum is reported with a fix
+	b[29] ^= 1
+	nodes = parseValid(t, parsePNG, b)
+	if n := findNode(nodes, "crc"); n == nil || n.fix == nil {
+		t.Fatal("wrong checksum not fixable")
+	}
+}
+
+func TestPNGTruncated(t *testing.T) {
+	parseTruncated(t, parsePNG, pngTestFile(t))
+}
+
+func TestPNGCorrupt(t *testing.T) {
+	parseCorrupt(t, parsePNG, pngTestFile(t))
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"github.com/gdamore/tcell"
+)
+
+// this file contains the single line text prompt drawn over the key reference
+
+type promptArea struct {
+	label    string
+	text     []rune
+	done     func(string) error    // called with the entered text on enter
+	complete func(string) []string // returns completions of the entered text, may be nil
+	matches  []string              // completions cycled through on tab
+	match    int                   // index of completion in text, or -1
+}
+
+// prompt asks the user for a line of text, calling done with the result.
+// any error returned by done is shown to the user.
+func (e *editor) prompt(label, text string, done func(string) error) error {
+	return e.promptCompleted(label, text, nil, done)
+}
+
+// promptCompleted is like prompt, completing the entered text with the
+// results of complete when tab is pressed
+func (e *editor) promptCompleted(label, text string, complete func(string) []string, done func(string) error) error {
+	p := e.areas.all["prompt"].(*promptArea)
+	p.label, p.text, p.done, p.complete = label, []rune(text), done, complete
+	p.matches, p.match = nil, -1
+	return e.areas.focus("prompt")
+}
+
+func (p *promptArea) init() error {
+	return nil
+}
+
+func (p *promptArea) onEvent(ev tcell.Event) error {
+	switch v := ev.(type) {
+	case *tcell.EventResize:
+		// redraw editor below prompt
+		if err := app.areas.all["editor"].onEvent(ev); err != nil {
+			return err
+		}
+		p.draw()
+
+	case *scanEvent:
+		// update editor below prompt while scanning
+		if err := app.areas.all["editor"].onEvent(ev); err != nil {
+			return err
+		}
+		p.draw()
+
+	case *tcell.EventKey:
+		// any key but tab accepts the current completion
+		if v.Key() != tcell.KeyTab {
+			p.matches, p.match = nil, -1
+		}
+
+		switch v.Key() {
+		case tcell.KeyEnter:
+			// call handler and return to editor
+			if err := p.done(string(p.text)); err != nil {
+				app.message = err.Error()
+			}
+			return app.areas.focus("editor")
+		case tcell.KeyEscape:
+			// return to editor without calling handler
+			return app.areas.focus("editor")
+		case tcell.KeyTab:
+			// complete text, or replace completion with the next one
+			if p.complete == nil {
+				break
+			}
+			if p.matches == nil {
+				p.matches = p.complete(string(p.text))
+			}
+			if len(p.matches) > 0 {
+				p.match = (p.match + 1) % len(p.matches)
+				p.text = []rune(p.matches[p.match])
+			}
+		case tcell.KeyBackspace, tcell.KeyBackspace2:
+			// remove last character
+			if len(p.text) > 0 {
+				p.text = p.text[:len(p.text)-1]
+			}
+		case tcell.KeyCtrlU:
+			// remove all characters
+			p.text = p.text[:0]
+		case tcell.KeyRune:
+			// add character
+			p.text = append(p.text, v.Rune())
+		}
+		p.draw()
+	}
+	return nil
+}
+
+func (p *promptArea) onClose() error {
+	return nil
+}
+
+func (p *promptArea) onFocus() error {
+	p.draw()
+	return nil
+}
+
+func (p *promptArea) onUnfocus() error {
+	return nil
+}
+
+func (p *promptArea) draw() {
+	// set cursor position to last row
+	app.term.setCursor(pos{0, app.term.h - 1})
+
+	// draw label and text
+	app.term.writeOverflow(p.label)
+	app.term.writeOverflow(string(p.text))
+	cursor := app.term.pos
+
+	// draw other completions after text
+	if len(p.matches) > 1 {
+		style := app.term.style
+		app.term.style = app.term.style.Foreground(tcell.ColorGray)
+		for i := 1; i < len(p.matches) && app.term.x < app.term.w; i++ {
+			app.term.writeOverflow("  " + p.matches[(p.match+i)%len(p.matches)])
+		}
+		app.term.style = style
+	}
+
+	// draw background for rest of row
+	for app.term.x < app.term.w {
+		app.term.writeOverflow(" ")
+	}
+
+	app.term.setCursor(cursor)
+	app.term.showCursor()
+}
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// this file contains the protobuf wire format decoder, which guesses the
+// types of fields without a schema, or names them using a descriptor set
+// compiled with protoc --descriptor_set_out
+
+// wire types
+const (
+	pbVarint = 0
+	pbI64    = 1
+	pbLen    = 2
+	pbSGroup = 3
+	pbEGroup = 4
+	pbI32    = 5
+)
+
+var pbWireTypes = []string{"varint", "i64", "len", "group", "egroup", "i32"}
+
+// field types of FieldDescriptorProto
+const (
+	pbDouble   = 1
+	pbFloat    = 2
+	pbInt64    = 3
+	pbUint64   = 4
+	pbInt32    = 5
+	pbFixed64  = 6
+	pbFixed32  = 7
+	pbBool     = 8
+	pbString   = 9
+	pbGroup    = 10
+	pbMessage  = 11
+	pbBytes    = 12
+	pbUint32   = 13
+	pbEnum     = 14
+	pbSfixed32 = 15
+	pbSfixed64 = 16
+	pbSint32   = 17
+	pbSint64   = 18
+)
+
+// pbField is a field decoded from the wire format
+type pbField struct {
+	number int
+	wire   int
+	start  int       // offset of tag
+	end    int       // offset after field
+	value  uint64    // value of varint, i64 and i32 fields
+	data   int       // offset of contents of len and group fields
+	fields []pbField // fields of groups
+}
+
+// pbFields splits b into fields, stopping at the first invalid field, or
+// after the end of group number group. it returns the number of bytes
+// decoded, including the end of the group. groups nested deeper than
+// decoderMaxDepth are invalid.
+func pbFields(b []byte, group, depth int) ([]pbField, int) {
+	var fields []pbField
+	pos := 0
+	for pos < len(b) {
+		tag, n := uleb128(b[pos:])
+		if n == 0 || tag>>3 == 0 || tag>>3 > 1<<29-1 {
+			break
+		}
+		f := pbField{number: int(tag >> 3), wire: int(tag & 7), start: pos}
+		p := pos + n
+		switch f.wire {
+		case pbVarint:
+			if f.value, n = uleb128(b[p:]); n == 0 {
+				return fields, pos
+			}
+			p += n
+		case pbI64:
+			if len(b)-p < 8 {
+				return fields, pos
+			}
+			f.value = binary.LittleEndian.Uint64(b[p:])
+			p += 8
+		case pbI32:
+			if len(b)-p < 4 {
+				return fields, pos
+			}
+			f.value = uint64(binary.LittleEndian.Uint32(b[p:]))
+			p += 4
+		case pbLen:
+			if f.value, n = uleb128(b[p:]); n == 0 || f.value > uint64(len(b)-p-n) {
+				return fields, pos
+			}
+			f.data = p + n
+			p = f.data + int(f.value)
+		case pbSGroup:
+			if depth >= decoderMaxDepth {
+				return fields, pos
+			}
+			var sub []pbField
+			sub, n = pbFields(b[p:], f.number, depth+1)
+			for i := range sub {
+				sub[i].shift(p)
+			}
+			if len(sub) == 0 || sub[len(sub)-1].wire != pbEGroup {
+				return fields, pos
+			}
+			f.data, f.fields = p, sub[:len(sub)-1]
+			p += n
+		case pbEGroup:
+			if f.number != group {
+				return fields, pos
+			}
+			f.end = p
+			return append(fields, f), p
+		default:
+			return fields, pos
+		}
+		f.end = p
+		fields = append(fields, f)
+		pos = p
+	}
+	if group != 0 {
+		// groups must be ended
+		return nil, 0
+	}
+	return fields, pos
+}
+
+// shift moves the offsets of a field and its group fields by n
+func (f *pbField) shift(n int) {
+	f.start += n
+	f.end += n
+	f.data += n
+	for i := range f.fields {
+		f.fields[i].shift(n)
+	}
+}
+
+// contents returns the contents of a len field
+func (f *pbField) contents(b []byte) []byte {
+	return b[f.data : f.data+int(f.value)]
+}
+
+// pbMessageType is a message described by a descriptor set
+type pbMessageType struct {
+	name   string
+	fields map[int]*pbFieldType
+}
+
+// pbFieldType is a field of a message described by a descriptor set
+type pbFieldType struct {
+	name     string
+	typ      int
+	typeName string // fully qualified name of message and enum types
+}
+
+// pbSchema holds the message and enum types of a descriptor set, by
+// fully qualified name
+type pbSchema struct {
+	messages map[string]*pbMessageType
+	enums    map[string]map[int64]string
+	order    []string // message names in order of declaration
+}
+
+// loadProtoSchema reads a FileDescriptorSet from filename
+func loadProtoSchema(filename string) (*pbSchema, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	fields, n := pbFields(b, 0, 0)
+	if n != len(b) {
+		return nil, fmt.Errorf("%s is not a protobuf descriptor set", filename)
+	}
+	s := &pbSchema{map[string]*pbMessageType{}, map[string]map[int64]string{}, nil}
+	for _, f := range pbRepeated(fields, 1) {
+		// FileDescriptorProto
+		file := pbMessageFields(b, f)
+		prefix := "."
+		if pkg := pbStringField(b, file, 2); pkg != "" {
+			prefix += pkg + "."
+		}
+		for _, m := range pbRepeated(file, 4) {
+			s.addMessage(b, prefix, pbMessageFields(b, m))
+		}
+		for _, e := range pbRepeated(file, 5) {
+			s.addEnum(b, prefix, pbMessageFields(b, e))
+		}
+	}
+	if len(s.order) == 0 {
+		return nil, fmt.Errorf("%s contains no messages", filename)
+	}
+	return s, nil
+}
+
+// addMessage adds the message type described by the DescriptorProto fields
+// and its nested types
+func (s *pbSchema) addMessage(b []byte, prefix string, fields []pbField) {
+	m := &pbMessageType{prefix + pbStringField(b, fields, 1), map[int]*pbFieldType{}}
+	s.messages[m.name] = m
+	s.order = append(s.order, m.name)
+	for _, f := range pbRepeated(fields, 2) {
+		// FieldDescriptorProto
+		field := pbMessageFields(b, f)
+		number := pbVarintField(field, 3)
+		typ := pbVarintField(field, 5)
+		m.fields[int(number)] = &pbFieldType{
+			name:     pbStringField(b, field, 1),
+			typ:      int(typ),
+			typeName: pbStringField(b, field, 6),
+		}
+	}
+	for _, n := range pbRepeated(fields, 3) {
+		s.addMessage(b, m.name+".", pbMessageFields(b, n))
+	}
+	for _, e := range pbRepeated(fields, 4) {
+		s.addEnum(b, m.name+".", pbMessageFields(b, e))
+	}
+}
+
+// addEnum adds the enum type described by the EnumDescriptorProto fields
+func (s *pbSchema) addEnum(b []byte, prefix string, fields []pbField) {
+	values := map[int64]string{}
+	for _, v := range pbRepeated(fields, 2) {
+		value := pbMessageFields(b, v)
+		number := pbVarintField(value, 2)
+		values[int64(number)] = pbStringField(b, value, 1)
+	}
+	s.enums[prefix+pbStringField(b, fields, 1)] = values
+}
+
+// message returns the message type with the given name, which may omit
+// the package
+func (s *pbSchema) message(name string) (*pbMessageType, error) {
+	if name == "" {
+		return s.messages[s.order[0]], nil
+	}
+	if m, ok := s.messages["."+strings.TrimPrefix(name, ".")]; ok {
+		return m, nil
+	}
+	for _, n := range s.order {
+		if strings.HasSuffix(n, "."+name) {
+			return s.messages[n], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown message type \"%s\"", name)
+}
+
+// pbRepeated returns the len fields with the given number
+func pbRepeated(fields []pbField, number int) []pbField {
+	var r []pbField
+	for _, f := range fields {
+		if f.number == number && f.wire == pbLen {
+			r = append(r, f)
+		}
+	}
+	return r
+}
+
+// pbMessageFields decodes the contents of a len field as a message
+func pbMessageFields(b []byte, f pbField) []pbField {
+	fields, _ := pbFields(f.contents(b), 0, 0)
+	for i := range fields {
+		fields[i].shift(f.data)
+	}
+	return fields
+}
+
+// pbStringField returns the contents of the last len field with the given number
+func pbStringField(b []byte, fields []pbField, number int) string {
+	s := ""
+	for _, f := range pbRepeated(fields, number) {
+		s = string(f.contents(b))
+	}
+	return s
+}
+
+// pbVarintField returns the value of the last varint field with the given number
+func pbVarintField(fields []pbField, number int) uint64 {
+	var v uint64
+	for _, f := range fields {
+		if f.number == number && f.wire == pbVarint {
+			v = f.value
+		}
+	}
+	return v
+}
+
+// decodeProtobuf decodes b as a protobuf message. args may name a
+// descriptor set file and the type of the message, which defaults to the
+// first message of the descriptor set.
+func decodeProtobuf(b []byte, offset int64, args []string) ([]*node, error) {
+	var s *pbSchema
+	var m *pbMessageType
+	if len(args) > 0 {
+		var err error
+		if s, err = loadProtoSchema(args[0]); err != nil {
+			return nil, err
+		}
+		name := ""
+		if len(args) > 1 {
+			name = args[1]
+		}
+		if m, err = s.message(name); err != nil {
+			return nil, err
+		}
+	}
+	fields, n := pbFields(b, 0, 0)
+	nodes := s.nodes(b, offset, fields, m, 0)
+	if n < len(b) {
+		nodes = append(nodes, &node{
+			name:  "Trailing data",
+			value: formatBytes(b[n:]),
+			start: offset + int64(n),
+			end:   offset + int64(len(b)),
+		})
+		return nodes, fmt.Errorf("invalid protobuf field at offset 0x%X", offset+int64(n))
+	}
+	return nodes, nil
+}
+
+// nodes returns a node for each field of a message of type m, which is
+// nil if the type is unknown. b starts at offset in the file, and depth is
+// the nesting of the message.
+func (s *pbSchema) nodes(b []byte, offset int64, fields []pbField, m *pbMessageType, depth int) []*node {
+	var nodes []*node
+	for _, f := range fields {
+		var t *pbFieldType
+		if m != nil {
+			t = m.fields[f.number]
+		}
+		n := &node{
+			name:  fmt.Sprintf("%d %s", f.number, pbWireTypes[f.wire]),
+			start: offset + int64(f.start),
+			end:   offset + int64(f.end),
+		}
+		if t != nil {
+			n.name = fmt.Sprintf("%s (%d)", t.name, f.number)
+			if !s.decodeTyped(n, b, offset, f, t, depth) {
+				t = nil
+			}
+		}
+		if t == nil {
+			s.decodeGuessed(n, b, offset, f, depth)
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// decodeTyped sets the value and children of n from a field of type t,
+// returning false if the wire type does not match t
+func (s *pbSchema) decodeTyped(n *node, b []byte, offset int64, f pbField, t *pbFieldType, depth int) bool {
+	switch {
+	case f.wire == pbSGroup && t.typ == pbGroup:
+		n.children = s.nodes(b, offset, f.fields, s.messages[t.typeName], depth+1)
+		n.value = fmt.Sprintf("group, %d fields", len(f.fields))
+		return true
+	case f.wire != pbLen:
+		if pbTypeWire(t.typ) != f.wire {
+			return false
+		}
+		n.value = s.scalar(f.value, t)
+		return true
+	case t.typ == pbString:
+		n.value = fmt.Sprintf("%q", f.contents(b))
+		return true
+	case t.typ == pbBytes:
+		n.value = formatBytes(f.contents(b))
+		return true
+	case t.typ == pbMessage:
+		if depth >= decoderMaxDepth {
+			return false
+		}
+		fields, size := pbFields(f.contents(b), 0, depth+1)
+		if size != int(f.value) {
+			return false
+		}
+		n.children = s.nodes(f.contents(b), offset+int64(f.data), fields, s.messages[t.typeName], depth+1)
+		n.value = fmt.Sprintf("%s, %d fields", strings.TrimPrefix(t.typeName, "."), len(fields))
+		return true
+	}
+
+	// repeated scalars are packed into a single len field
+	wire := pbTypeWire(t.typ)
+	data := f.contents(b)
+	for pos := 0; pos < len(data); {
+		var v uint64
+		size := 0
+		switch wire {
+		case pbVarint:
+			v, size = uleb128(data[pos:])
+		case pbI64:
+			if len(data)-pos >= 8 {
+				v, size = binary.LittleEndian.Uint64(data[pos:]), 8
+			}
+		case pbI32:
+			if len(data)-pos >= 4 {
+				v, size = uint64(binary.LittleEndian.Uint32(data[pos:])), 4
+			}
+		}
+		if size == 0 {
+			n.children = nil
+			return false
+		}
+		n.children = append(n.children, &node{
+			name:  fmt.Sprintf("[%d]", len(n.children)),
+			value: s.scalar(v, t),
+			start: offset + int64(f.data+pos),
+			end:   offset + int64(f.data+pos+size),
+		})
+		pos += size
+	}
+	n.value = fmt.Sprintf("packed, %d values", len(n.children))
+	return true
+}
+
+// pbTypeWire returns the wire type of scalar field types, or -1
+func pbTypeWire(typ int) int {
+	switch typ {
+	case pbInt32, pbInt64, pbUint32, pbUint64, pbSint32, pbSint64, pbBool, pbEnum:
+		return pbVarint
+	case pbDouble, pbFixed64, pbSfixed64:
+		return pbI64
+	case pbFloat, pbFixed32, pbSfixed32:
+		return pbI32
+	}
+	return -1
+}
+
+// scalar formats the value of a scalar field of type t
+func (s *pbSchema) scalar(v uint64, t *pbFieldType) string {
+	switch t.typ {
+	case pbInt32, pbInt64, pbSfixed64:
+		return fmt.Sprint(int64(v))
+	case pbSfixed32:
+		return fmt.Sprint(int32(v))
+	case pbSint32, pbSint64:
+		return fmt.Sprint(zigzag(v))
+	case pbBool:
+		return fmt.Sprint(v != 0)
+	case pbEnum:
+		if name, ok := s.enums[t.typeName][int64(v)]; ok {
+			return fmt.Sprintf("%s (%d)", name, int64(v))
+		}
+		return fmt.Sprint(int64(v))
+	case pbDouble:
+		return fmt.Sprint(math.Float64frombits(v))
+	case pbFloat:
+		return fmt.Sprint(math.Float32frombits(uint32(v)))
+	}
+	return fmt.Sprint(v)
+}
+
+// decodeGuessed sets the value and children of n from a field of unknown
+// type. len fields are shown as text if printable, else as a message if
+// they can be decoded as one and are not nested too deeply, else as bytes.
+func (s *pbSchema) decodeGuessed(n *node, b []byte, offset int64, f pbField, depth int) {
+	switch f.wire {
+	case pbVarint:
+		// negative int32 and int64 values take ten bytes
+		v := fmt.Sprint(f.value)
+		if int64(f.value) < 0 {
+			v = fmt.Sprint(int64(f.value))
+		}
+		n.value = fmt.Sprintf("%s (0x%X), zigzag %d", v, f.value, zigzag(f.value))
+	case pbI64:
+		n.value = fmt.Sprintf("%d (0x%X), double %g", int64(f.value), f.value, math.Float64frombits(f.value))
+	case pbI32:
+		n.value = fmt.Sprintf("%d (0x%X), float %g", int32(f.value), f.value, math.Float32frombits(uint32(f.value)))
+	case pbSGroup:
+		n.children = s.nodes(b, offset, f.fields, nil, depth+1)
+		n.value = fmt.Sprintf("group, %d fields", len(f.fields))
+	case pbLen:
+		data := f.contents(b)
+		if len(data) > 0 && printable(data) {
+			n.value = fmt.Sprintf("%q", data)
+			return
+		}
+		if depth >= decoderMaxDepth {
+			n.value = formatBytes(data)
+			return
+		}
+		if fields, size := pbFields(data, 0, depth+1); len(fields) > 0 && size == len(data) {
+			n.children = s.nodes(data, offset+int64(f.data), fields, nil, depth+1)
+			n.value = fmt.Sprintf("message, %d fields", len(fields))
+			return
+		}
+		n.value = formatBytes(data)
+	}
+}
+
+// zigzag decodes a zigzag encoded signed integer
+func zigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+// printable returns whether b is text in UTF-8 without control characters
+// other than white space
+func printable(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && r != '\t' && r != '\n' && r != '\r' {
+			return false
+		}
+	}
+	return true
+}
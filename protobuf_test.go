@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// treeDepth returns the nesting of the deepest node
+func treeDepth(nodes []*node) int {
+	depth := 0
+	for _, n := range nodes {
+		depth = max(depth, 1+treeDepth(n.children))
+	}
+	return depth
+}
+
+func TestProtobufNesting(t *testing.T) {
+	// messages nested as field 1, each prefixed with its length
+	var nested []byte
+	for i := 0; i < 2*decoderMaxDepth; i++ {
+		size := len(nested)
+		var prefix []byte
+		for prefix = []byte{0x0A}; size >= 0x80; size >>= 7 {
+			prefix = append(prefix, byte(size)|0x80)
+		}
+		nested = append(append(prefix, byte(size)), nested...)
+	}
+
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"unended groups", bytes.Repeat([]byte{0x0B}, 16<<20)},
+		{"messages", nested},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nodes, _ := decodeProtobuf(test.b, 0, nil)
+			if depth := treeDepth(nodes); depth > decoderMaxDepth+1 {
+				t.Fatalf("decoded %d levels, want at most %d", depth, decoderMaxDepth+1)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// this file contains the RIFF container format, used by WAV, AVI and WebP
+
+const (
+	riffMaxChunks = 1 << 16
+	riffMaxDepth  = 16
+)
+
+var riffWaveFormats = map[uint64]string{
+	0x0001: "PCM",
+	0x0002: "ADPCM",
+	0x0003: "IEEE float",
+	0x0006: "A-law",
+	0x0007: "µ-law",
+	0x0055: "MP3",
+	0xFFFE: "extensible",
+}
+
+func detectRIFF(head []byte) bool {
+	return len(head) >= 12 && (bytes.HasPrefix(head, []byte("RIFF")) || bytes.HasPrefix(head, []byte("RIFX")))
+}
+
+func parseRIFF(r io.ReaderAt, size int64) ([]*node, error) {
+	// RIFX is the big endian variant
+	head := make([]byte, 4)
+	if _, err := r.ReadAt(head, 0); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if string(head) == "RIFX" {
+		order = binary.BigEndian
+	}
+
+	// large AVI files continue with further RIFF chunks
+	count := 0
+	return riffChunks(r, order, 0, size, "", 0, &count)
+}
+
+// riffChunks decodes the chunks between start and end of a list of the form
+// type, flagging sizes that disagree with end
+func riffChunks(r io.ReaderAt, order binary.ByteOrder, start, end int64, form string, depth int, count *int) ([]*node, error) {
+	var nodes []*node
+	pos := start
+	for i := 0; pos+8 <= end; i++ {
+		if *count == riffMaxChunks {
+			return nodes, fmt.Errorf("showing the first %d chunks", riffMaxChunks)
+		}
+		*count++
+		b := make([]byte, 12)
+		n, _ := r.ReadAt(b, pos)
+		if n < 8 {
+			return nodes, fmt.Errorf("cannot read chunk at %08X", pos)
+		}
+		id := string(b[:4])
+		if depth == 0 && id != "RIFF" && id != "RIFX" && id != "RF64" {
+			break
+		}
+		length := int64(order.Uint32(b[4:]))
+		sizeNode := &node{name: "size", value: fmt.Sprintf("%d (0x%X)", length, length), start: pos + 4, end: pos + 8}
+		chunk := &node{
+			name:     fmt.Sprintf("[%d] %s", i, riffID(id)),
+			value:    fmt.Sprintf("%d bytes", length),
+			start:    pos,
+			children: []*node{{name: "id", value: fmt.Sprintf("%q", id), start: pos, end: pos + 4}, sizeNode},
+		}
+
+		// the size must fit in the parent, or in the file at the top level
+		dataEnd := pos + 8 + length
+		if id == "RF64" && length == 0xFFFFFFFF {
+			// sizes beyond 4 GB are in the ds64 chunk
+			dataEnd = end
+		} else if dataEnd > end {
+			what := "parent chunk"
+			if depth == 0 {
+				what = "file"
+			}
+			chunk.value += fmt.Sprintf(", extends %d bytes past the end of the %s", dataEnd-end, what)
+			dataEnd = end
+			fix := make([]byte, 4)
+			order.PutUint32(fix, uint32(end-pos-8))
+			sizeNode.fix = fix
+		}
+		chunk.end = dataEnd
+
+		data := &node{name: "data", value: fmt.Sprintf("%d bytes", dataEnd-pos-8), start: pos + 8, end: dataEnd}
+		switch {
+		case (id == "RIFF" || id == "RIFX" || id == "RF64" || id == "LIST") && dataEnd-pos >= 12:
+			// lists have a form type followed by sub-chunks
+			typ := string(b[8:12])
+			chunk.name = fmt.Sprintf("[%d] %s %s", i, riffID(id), riffID(typ))
+			chunk.children = append(chunk.children, &node{name: "type", value: fmt.Sprintf("%q", typ), start: pos + 8, end: pos + 12})
+			if depth == riffMaxDepth {
+				chunk.children = append(chunk.children, data)
+				break
+			}
+			children, err := riffChunks(r, order, pos+12, dataEnd, typ, depth+1, count)
+			chunk.children = append(chunk.children, children...)
+			if err != nil {
+				return append(nodes, chunk), err
+			}
+		case id == "fmt " && length >= 16:
+			fields, _, err := readFields(r, pos+8, order, []structField{
+				{"format", 2, func(v uint64) string { return riffWaveFormats[v] }},
+				{"channels", 2, nil},
+				{"sample rate", 4, nil},
+				{"byte rate", 4, nil},
+				{"block align", 2, nil},
+				{"bits per sample", 2, nil},
+			})
+			if err == nil {
+				data.children = fields
+			}
+			chunk.children = append(chunk.children, data)
+		case form == "INFO" && length <= 1024:
+			// INFO list entries are text
+			data.value = fmt.Sprintf("%q", readCString(r, pos+8, int(dataEnd-pos-8)))
+			chunk.value = data.value
+			chunk.children = append(chunk.children, data)
+		default:
+			chunk.children = append(chunk.children, data)
+		}
+		nodes = append(nodes, chunk)
+
+		// chunks are padded to an even size
+		pos = dataEnd
+		if length%2 == 1 && pos < end {
+			chunk.children = append(chunk.children, &node{name: "padding", value: "1 byte", start: pos, end: pos + 1})
+			chunk.end = pos + 1
+			pos++
+		}
+	}
+	if pos < end && depth == 0 && len(nodes) > 0 {
+		// the last RIFF chunk should end with the file
+		last := nodes[len(nodes)-1]
+		last.value += fmt.Sprintf(", file has %d more bytes", end-pos)
+		fix := make([]byte, 4)
+		order.PutUint32(fix, uint32(end-last.start-8))
+		last.children[1].fix = fix
+	}
+	if pos < end {
+		nodes = append(nodes, &node{name: "Trailing data", value: fmt.Sprintf("%d bytes", end-pos), start: pos, end: end})
+	}
+	return nodes, nil
+}
+
+// riffID returns a four character code, quoted if it is not printable
+func riffID(id string) string {
+	if !printable([]byte(id)) {
+		return fmt.Sprintf("%q", id)
+	}
+	return id
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// riffTestFile returns a WAV file with an INFO list and odd sized data
+func riffTestFile() []byte {
+	chunk := func(id string, data []byte) []byte {
+		b := append([]byte(id), 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(b[4:], uint32(len(data)))
+		b = append(b, data...)
+		if len(data)%2 == 1 {
+			b = append(b, 0)
+		}
+		return b
+	}
+	format := []byte{1, 0, 1, 0, 0x40, 0x1F, 0, 0, 0x40, 0x1F, 0, 0, 1, 0, 8, 0}
+	var wave []byte
+	wave = append(wave, "WAVE"...)
+	wave = append(wave, chunk("fmt ", format)...)
+	wave = append(wave, chunk("LIST", append([]byte("INFO"), chunk("INAM", []byte("test\x00"))...))...)
+	wave = append(wave, chunk("data", []byte{1, 2, 3, 4, 5})...)
+	return chunk("RIFF", wave)
+}
+
+func TestRIFF(t *testing.T) {
+	nodes := parseValid(t, parseRIFF, riffTestFile())
+	if n := findNode(nodes, "[0] INAM"); n == nil || n.value != `"test"` {
+		t.Fatal("INFO list not decoded")
+	}
+	if n := findNode(nodes, "[2] data"); n == nil || findNode(n.children, "padding") == nil {
+		t.Fatal("padding not decoded")
+	}
+}
+
+func TestRIFFTruncated(t *testing.T) {
+	parseTruncated(t, parseRIFF, riffTestFile())
+}
+
+func TestRIFFCorrupt(t *testing.T) {
+	parseCorrupt(t, parseRIFF, riffTestFile())
+}
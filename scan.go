@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/gdamore/tcell"
+)
+
+// this file contains the carving scan, which searches the whole file for
+// magic numbers of embedded files in the background
+
+// scanChunkSize is the amount of bytes searched at once
+const scanChunkSize = 1 << 20
+
+// scan is a search for embedded files running in the background. the
+// search adds its progress under mu, which the editor copies to the
+// progress it shows when woken up by an event.
+type scan struct {
+	size   int64
+	cancel chan struct{}
+	screen tcell.Screen // receiving the events
+
+	mu       sync.Mutex
+	found    []*node // hits not yet copied by the editor
+	searched int64
+	ended    bool
+	err      error
+
+	hits     []*node
+	done     int64 // bytes searched so far
+	finished bool
+}
+
+// scanEvent wakes up the editor to show the progress of a scan
+type scanEvent struct {
+	tcell.EventTime
+	s *scan
+}
+
+// startScan starts searching r in the background, posting events to the
+// screen until the scan is finished or cancelled
+func startScan(r io.ReaderAt, size int64) *scan {
+	s := &scan{size: size, cancel: make(chan struct{}), screen: app.term.screen}
+	go s.run(r)
+	return s
+}
+
+// report adds hits and progress of the search, and wakes up the editor
+func (s *scan) report(hits []*node, searched int64, ended bool, err error) {
+	s.mu.Lock()
+	s.found = append(s.found, hits...)
+	s.searched, s.ended = searched, ended
+	if err != nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+
+	// events are dropped if the queue is full, which is fine for progress
+	// shown with the next event, but not for the last one
+	ev := &scanEvent{s: s}
+	ev.SetEventNow()
+	if ended {
+		s.screen.PostEventWait(ev)
+	} else {
+		s.screen.PostEvent(ev)
+	}
+}
+
+// update copies the progress reported by the search, returning its error
+func (s *scan) update() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hits = append(s.hits, s.found...)
+	s.found = nil
+	s.done, s.finished = s.searched, s.ended
+	err := s.err
+	s.err = nil
+	return err
+}
+
+// stop cancels the scan if it is still running
+func (s *scan) stop() {
+	if !s.finished {
+		close(s.cancel)
+		s.finished = true
+	}
+}
+
+// title describes the progress of the scan
+func (s *scan) title() string {
+	percent := int64(100)
+	if s.size > 0 {
+		percent = s.done * 100 / s.size
+	}
+	switch {
+	case s.cancelled():
+		return fmt.Sprintf("scan cancelled at %d%%, %d hits", percent, len(s.hits))
+	case !s.finished:
+		return fmt.Sprintf("scan %d%%, %d hits", percent, len(s.hits))
+	}
+	return fmt.Sprintf("scan, %d hits", len(s.hits))
+}
+
+// cancelled returns whether the scan was cancelled
+func (s *scan) cancelled() bool {
+	select {
+	case <-s.cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *scan) run(r io.ReaderAt) {
+	var pos int64
+
+	// parsers of corrupt data may panic, which must not close the editor
+	defer func() {
+		if v := recover(); v != nil {
+			s.report(nil, pos, true, fmt.Errorf("scan stopped at offset 0x%X: %v", pos, v))
+		}
+	}()
+
+	// data without a format ends where the next hit starts, so it is held
+	// back until then
+	var pending *node
+	var pendingName string
+	ends := map[string]int64{} // of hits by type
+	b := make([]byte, scanChunkSize+formatHeadSize)
+	for ; pos < s.size; pos += scanChunkSize {
+		if s.cancelled() {
+			return
+		}
+		n, err := r.ReadAt(b, pos)
+		if err != nil && err != io.EOF {
+			s.report(nil, pos, true, err)
+			return
+		}
+		var hits []*node
+		for _, start := range scanCandidates(b[:n], pos) {
+			if s.cancelled() {
+				return
+			}
+			m := identify(b[start-pos : min(int(start-pos)+formatHeadSize, n)])
+			if m == nil || (m.format == "" && len(m.signature) < 3) {
+				// short signatures without a format to check are too common
+				continue
+			}
+			if start < ends[m.name] || (pending != nil && m.name == pendingName) {
+				// part of a previous hit, such as an entry of a ZIP archive
+				// or a thumbnail of a JPEG image
+				continue
+			}
+			if pending != nil {
+				pending.end = start
+				pending.value += fmt.Sprintf(", %d bytes", pending.end-pending.start)
+				hits = append(hits, pending)
+				pending = nil
+			}
+			hit := &node{name: fmt.Sprintf("%08X", start), value: m.name, start: start, end: s.size}
+			if end, ok := scanLength(r, m, start, s.size); ok {
+				hit.end = end
+				hit.value += fmt.Sprintf(", %d bytes", end-start)
+				hits = append(hits, hit)
+				ends[m.name] = end
+			} else {
+				pending, pendingName = hit, m.name
+			}
+		}
+		s.report(hits, min64(pos+scanChunkSize, s.size), false, nil)
+	}
+	var hits []*node
+	if pending != nil {
+		pending.value += fmt.Sprintf(", up to %d bytes", pending.end-pending.start)
+		hits = append(hits, pending)
+	}
+	s.report(hits, s.size, true, nil)
+}
+
+// scanCandidates returns the sorted offsets of data in b, read from the file
+// at pos, whose magic number matches. only data starting in the first
+// scanChunkSize bytes of b is returned, the rest is searched with the next
+// chunk.
+func scanCandidates(b []byte, pos int64) []int64 {
+	found := map[int64]bool{}
+	for _, m := range magics {
+		sig := []byte(m.signature)
+		for i := 0; ; {
+			j := bytes.Index(b[i:], sig)
+			if j < 0 {
+				break
+			}
+			i += j
+			if start := i - m.offset; start >= 0 && start < scanChunkSize {
+				found[pos+int64(start)] = true
+			}
+			i++
+		}
+	}
+	offsets := make([]int64, 0, len(found))
+	for offset := range found {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets
+}
+
+// scanLength estimates the end of the data at start by decoding it in the
+// format of its magic number, ignoring data the format does not cover
+func scanLength(r io.ReaderAt, m *magic, start, size int64) (int64, bool) {
+	f := findFormat(m.format)
+	if f == nil {
+		return 0, false
+	}
+	nodes, _ := f.parse(io.NewSectionReader(r, start, size-start), size-start)
+	end := int64(0)
+	for _, n := range nodes {
+		if n.name != "Trailing data" && n.name != "Padding" {
+			end = max64(end, n.end)
+		}
+	}
+	if end == 0 {
+		return 0, false
+	}
+	return start + min64(end, size-start), true
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell"
+)
+
+// panicReader panics when reading past its data, as a broken parser would
+type panicReader struct {
+	*bytes.Reader
+}
+
+func (r panicReader) ReadAt(b []byte, off int64) (int, error) {
+	if off >= r.Size() {
+		panic("read past end")
+	}
+	return r.Reader.ReadAt(b, off)
+}
+
+// runScan scans r on a simulation screen, waiting for the scan to finish
+func runScan(t *testing.T, r io.ReaderAt, size int64) (*scan, error) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer screen.Fini()
+	app.term.screen = screen
+
+	s := startScan(r, size)
+	deadline := time.Now().Add(10 * time.Second)
+	for !s.finished {
+		if time.Now().After(deadline) {
+			t.Fatal("scan did not finish")
+		}
+		if _, ok := screen.PollEvent().(*scanEvent); ok {
+			if err := s.update(); err != nil {
+				return s, err
+			}
+		}
+	}
+	return s, nil
+}
+
+func TestScan(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1A\n\x00\x00\x00\x00IEND\xAE\x42\x60\x82")
+	gzip := []byte("\x1F\x8B\x08\x00\x00\x00\x00\x00\x00\x03")
+	var b []byte
+	b = append(b, bytes.Repeat([]byte{'A'}, 100)...)
+	b = append(b, png...)
+	b = append(b, bytes.Repeat([]byte{'B'}, 50)...)
+	b = append(b, gzip...)
+	b = append(b, bytes.Repeat([]byte{'C'}, 30)...)
+
+	s, err := runScan(t, bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		start, end int64
+	}{
+		{100, 100 + int64(len(png))},
+		{170, int64(len(b))},
+	}
+	if len(s.hits) != len(want) {
+		t.Fatalf("found %d hits, want %d", len(s.hits), len(want))
+	}
+	for i, w := range want {
+		if h := s.hits[i]; h.start != w.start || h.end != w.end {
+			t.Errorf("hit %d covers %d-%d, want %d-%d", i, h.start, h.end, w.start, w.end)
+		}
+	}
+}
+
+func TestScanPanic(t *testing.T) {
+	// the ZIP parser reads the end of the file, which panics
+	b := []byte("PK\x03\x04" + string(make([]byte, 60)))
+	r := panicReader{bytes.NewReader(b)}
+	s, err := runScan(t, r, int64(len(b))+1<<17)
+	if err == nil || !s.finished {
+		t.Fatal("panic not reported as an error")
+	}
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"unicode/utf16"
+)
+
+// this file contains the SQLite database format, decoding each page of the
+// database including the free space of b-tree pages, which may contain
+// deleted rows
+
+const (
+	sqliteSignature  = "SQLite format 3\x00"
+	sqliteHeaderSize = 100
+	sqliteMaxPages   = 1 << 16
+	sqliteLockByte   = 1 << 30 // offset of the lock byte page, which is never used
+)
+
+var sqlitePageTypes = map[byte]string{
+	2:  "interior index",
+	5:  "interior table",
+	10: "leaf index",
+	13: "leaf table",
+}
+
+var sqliteEncodings = map[uint64]string{1: "UTF-8", 2: "UTF-16le", 3: "UTF-16be"}
+
+// sqliteDB holds the values of the database header needed to decode pages
+type sqliteDB struct {
+	r        io.ReaderAt
+	pageSize int64
+	usable   int64 // page size without the reserved space at the end of each page
+	encoding uint64
+}
+
+func detectSQLite(head []byte) bool {
+	return bytes.HasPrefix(head, []byte(sqliteSignature))
+}
+
+func parseSQLite(r io.ReaderAt, size int64) ([]*node, error) {
+	header, h, err := readFields(r, 0, binary.BigEndian, []structField{
+		{"magic", 16, nil},
+		{"page size", 2, func(v uint64) string { return fmt.Sprint(sqlitePageSize(v)) }},
+		{"write version", 1, nil},
+		{"read version", 1, nil},
+		{"reserved space", 1, nil},
+		{"max payload fraction", 1, nil},
+		{"min payload fraction", 1, nil},
+		{"leaf payload fraction", 1, nil},
+		{"change counter", 4, nil},
+		{"database size", 4, nil},
+		{"first freelist trunk page", 4, nil},
+		{"freelist pages", 4, nil},
+		{"schema cookie", 4, nil},
+		{"schema format", 4, nil},
+		{"default cache size", 4, nil},
+		{"largest root page", 4, nil},
+		{"text encoding", 4, func(v uint64) string { return sqliteEncodings[v] }},
+		{"user version", 4, nil},
+		{"incremental vacuum", 4, nil},
+		{"application id", 4, nil},
+		{"reserved", 20, nil},
+		{"version valid for", 4, nil},
+		{"SQLite version", 4, nil},
+	})
+	if err != nil {
+		return nil, err
+	}
+	header[0].value = fmt.Sprintf("%q", sqliteSignature)
+	nodes := []*node{group("Database header", "", header)}
+
+	d := &sqliteDB{r: r, pageSize: sqlitePageSize(h["page size"]), encoding: h["text encoding"]}
+	d.usable = d.pageSize - int64(h["reserved space"])
+	if d.usable < 480 {
+		return nodes, fmt.Errorf("invalid page size %d", d.pageSize)
+	}
+
+	// the database size is only valid if written by a version which updates it
+	count := size / d.pageSize
+	if h["version valid for"] == h["change counter"] && h["database size"] > 0 {
+		count = min64(count, int64(h["database size"]))
+	}
+	nodes[0].value = fmt.Sprintf("page size %d, %d pages", d.pageSize, count)
+	if count > sqliteMaxPages {
+		err = fmt.Errorf("showing the first %d of %d pages", sqliteMaxPages, count)
+		count = sqliteMaxPages
+	}
+
+	// pages which are not b-tree pages are found by following lists
+	kinds := make([]string, count+1)
+	d.freelist(kinds, uint32(h["first freelist trunk page"]))
+	if h["largest root page"] != 0 {
+		// pointer map pages follow page 1 at intervals of the number of entries they hold
+		for p := int64(2); p <= count; p += d.usable/5 + 1 {
+			kinds[p] = "pointer map"
+		}
+	}
+	if sqliteLockByte < size && sqliteLockByte/d.pageSize+1 <= count {
+		kinds[sqliteLockByte/d.pageSize+1] = "lock byte"
+	}
+
+	pages := make([]*node, count+1)
+	for p := int64(1); p <= count; p++ {
+		if kinds[p] == "" {
+			var overflow []uint32
+			pages[p], overflow = d.btreePage(p)
+			for _, o := range overflow {
+				d.overflow(kinds, o, p)
+			}
+		}
+	}
+	for p := int64(1); p <= count; p++ {
+		if pages[p] == nil {
+			kind := kinds[p]
+			if kind == "" {
+				kind = "unused"
+			}
+			pages[p] = &node{name: fmt.Sprintf("[%d] %s", p, kind), start: (p - 1) * d.pageSize, end: p * d.pageSize}
+		}
+	}
+	return append(nodes, group("Pages", fmt.Sprintf("[%d]", count), pages[1:])), err
+}
+
+func sqliteUnits(r io.ReaderAt, size int64) []unit {
+	b := make([]byte, 2)
+	if _, err := r.ReadAt(b, 16); err != nil {
+		return nil
+	}
+	return []unit{{"page", 1, 0, sqlitePageSize(uint64(binary.BigEndian.Uint16(b)))}}
+}
+
+// sqlitePageSize returns the page size stored in the database header
+func sqlitePageSize(v uint64) int64 {
+	if v == 1 {
+		return 65536
+	}
+	return int64(v)
+}
+
+// page reads page number p
+func (d *sqliteDB) page(p int64) []byte {
+	b := make([]byte, d.pageSize)
+	if _, err := d.r.ReadAt(b, (p-1)*d.pageSize); err != nil {
+		return nil
+	}
+	return b
+}
+
+// freelist marks the trunk and leaf pages of the freelist starting at trunk
+func (d *sqliteDB) freelist(kinds []string, trunk uint32) {
+	for int64(trunk) > 1 && int64(trunk) < int64(len(kinds)) && kinds[trunk] == "" {
+		kinds[trunk] = "freelist trunk"
+		b := d.page(int64(trunk))
+		if b == nil {
+			return
+		}
+		n := int64(binary.BigEndian.Uint32(b[4:]))
+		for i := int64(0); i < n && 8+4*i+4 <= d.usable; i++ {
+			if leaf := binary.BigEndian.Uint32(b[8+4*i:]); int64(leaf) < int64(len(kinds)) && leaf > 1 {
+				kinds[leaf] = "freelist leaf"
+			}
+		}
+		trunk = binary.BigEndian.Uint32(b)
+	}
+}
+
+// overflow marks the overflow pages of a cell on page owner, starting at first
+func (d *sqliteDB) overflow(kinds []string, first uint32, owner int64) {
+	for p := first; int64(p) > 1 && int64(p) < int64(len(kinds)) && kinds[p] == ""; {
+		kinds[p] = fmt.Sprintf("overflow of page %d", owner)
+		b := d.page(int64(p))
+		if b == nil {
+			return
+		}
+		p = binary.BigEndian.Uint32(b)
+	}
+}
+
+// btreePage decodes page p if it is a b-tree page, returning its node and
+// the first overflow page of each cell
+func (d *sqliteDB) btreePage(p int64) (*node, []uint32) {
+	b := d.page(p)
+	if b == nil {
+		return nil, nil
+	}
+	start := (p - 1) * d.pageSize
+	h := int64(0)
+	if p == 1 {
+		h = sqliteHeaderSize
+	}
+	typ := b[h]
+	kind, ok := sqlitePageTypes[typ]
+	if !ok {
+		return nil, nil
+	}
+	fields := []structField{
+		{"page type", 1, func(v uint64) string { return sqlitePageTypes[byte(v)] }},
+		{"first freeblock", 2, nil},
+		{"cells", 2, nil},
+		{"cell content area", 2, nil},
+		{"fragmented free bytes", 1, nil},
+	}
+	if typ == 2 || typ == 5 {
+		fields = append(fields, structField{"right-most pointer", 4, nil})
+	}
+	header, v, err := readFields(d.r, start+h, binary.BigEndian, fields)
+	if err != nil {
+		return nil, nil
+	}
+	n := &node{
+		name:     fmt.Sprintf("[%d] %s", p, kind),
+		value:    fmt.Sprintf("%d cells", v["cells"]),
+		start:    start,
+		end:      start + d.pageSize,
+		children: []*node{group("page header", "", header)},
+	}
+
+	// cell pointers follow the header
+	var pointers, cells []*node
+	var overflow []uint32
+	pos := header[len(header)-1].end - start
+	for i := 0; i < int(v["cells"]) && pos+2 <= d.usable; i++ {
+		cell := int64(binary.BigEndian.Uint16(b[pos:]))
+		pointers = append(pointers, &node{
+			name:  fmt.Sprintf("[%d]", i),
+			value: fmt.Sprintf("0x%X", cell),
+			start: start + pos,
+			end:   start + pos + 2,
+		})
+		pos += 2
+		if cell < pos || cell >= d.usable {
+			continue
+		}
+		c, o := d.cell(b[:d.usable], start, typ, i, cell)
+		cells = append(cells, c)
+		if o != 0 {
+			overflow = append(overflow, o)
+		}
+	}
+	if len(pointers) > 0 {
+		n.children = append(n.children, group("cell pointers", fmt.Sprintf("[%d]", len(pointers)), pointers))
+	}
+
+	// unallocated space lies between the cell pointers and the cell content area
+	content := int64(v["cell content area"])
+	if content == 0 {
+		content = 65536
+	}
+	if content = min64(content, d.usable); content > pos {
+		n.children = append(n.children, &node{
+			name:  "unallocated",
+			value: fmt.Sprintf("%d bytes", content-pos),
+			start: start + pos,
+			end:   start + content,
+		})
+	}
+	if len(cells) > 0 {
+		n.children = append(n.children, group("cells", fmt.Sprintf("[%d]", len(cells)), cells))
+	}
+
+	// freeblocks form a list in the cell content area, and keep deleted cells
+	var free []*node
+	seen := map[int64]bool{}
+	for f := int64(v["first freeblock"]); f > 0 && f+4 <= d.usable && !seen[f]; {
+		seen[f] = true
+		size := min64(int64(binary.BigEndian.Uint16(b[f+2:])), d.usable-f)
+		free = append(free, &node{
+			name:  fmt.Sprintf("[%d]", len(free)),
+			value: fmt.Sprintf("%d bytes: %s", size, formatBytes(b[f+4:f+max64(size, 4)])),
+			start: start + f,
+			end:   start + f + max64(size, 4),
+		})
+		f = int64(binary.BigEndian.Uint16(b[f:]))
+	}
+	if len(free) > 0 {
+		n.children = append(n.children, group("freeblocks", fmt.Sprintf("[%d]", len(free)), free))
+	}
+	return n, overflow
+}
+
+// cell decodes cell i of a page of type typ at pos, returning its node and
+// its first overflow page, or 0
+func (d *sqliteDB) cell(b []byte, start int64, typ byte, i int, pos int64) (*node, uint32) {
+	n := &node{name: fmt.Sprintf("[%d]", i), start: start + pos}
+	p := pos
+	field := func(name string, size int64, value string) {
+		n.children = append(n.children, &node{name: name, value: value, start: start + p, end: start + p + size})
+		p += size
+	}
+	varint := func(name string) (uint64, bool) {
+		v, size := sqliteVarint(b[p:])
+		if size == 0 {
+			return 0, false
+		}
+		field(name, int64(size), fmt.Sprint(v))
+		return v, true
+	}
+
+	if typ == 2 || typ == 5 {
+		if p+4 > int64(len(b)) {
+			n.end = n.start
+			return n, 0
+		}
+		child := binary.BigEndian.Uint32(b[p:])
+		field("left child page", 4, fmt.Sprint(child))
+		n.value = fmt.Sprintf("child %d", child)
+	}
+	if typ == 5 {
+		if rowid, ok := varint("rowid"); ok {
+			n.value += fmt.Sprintf(", rowid %d", rowid)
+		}
+		n.end = start + p
+		return n, 0
+	}
+	payload, ok := varint("payload size")
+	if !ok {
+		n.end = start + p
+		return n, 0
+	}
+	if typ == 13 {
+		if rowid, ok := varint("rowid"); ok {
+			n.value = fmt.Sprintf("rowid %d", rowid)
+		}
+	}
+
+	// payload which does not fit in the page continues on overflow pages.
+	// sizes are unsigned, so corrupt sizes of 2^63 or more stay in the page
+	u := uint64(d.usable)
+	x := u - 35
+	if typ != 13 {
+		x = (u-12)*64/255 - 23
+	}
+	inPage := payload
+	if inPage > x {
+		m := (u-12)*32/255 - 23
+		inPage = m + (payload-m)%(u-4)
+		if inPage > x {
+			inPage = m
+		}
+	}
+	local := min64(int64(inPage), int64(len(b))-p)
+	if local < 0 {
+		n.end = start + p
+		return n, 0
+	}
+	record := d.record(b[p:p+local], start+p)
+	if record.value != "" {
+		n.value += ", " + record.value
+		if typ != 13 {
+			n.value = record.value
+		}
+	}
+	n.children = append(n.children, record)
+	p += local
+
+	var overflow uint32
+	if uint64(local) < payload && p+4 <= int64(len(b)) {
+		overflow = binary.BigEndian.Uint32(b[p:])
+		field("overflow page", 4, fmt.Sprint(overflow))
+	}
+	n.end = start + p
+	return n, overflow
+}
+
+// record decodes a record at offset, which may be truncated at the start
+// of overflow pages
+func (d *sqliteDB) record(b []byte, offset int64) *node {
+	n := &node{name: "record", start: offset, end: offset + int64(len(b))}
+	size, p := sqliteVarint(b)
+	if p == 0 || size > uint64(len(b)) {
+		n.value = formatBytes(b)
+		return n
+	}
+
+	// the header contains the serial type of each column
+	var types []uint64
+	for p < int(size) {
+		t, k := sqliteVarint(b[p:size])
+		if k == 0 {
+			break
+		}
+		types = append(types, t)
+		p += k
+	}
+	n.children = append(n.children, &node{
+		name:  "header",
+		value: fmt.Sprint(types),
+		start: offset,
+		end:   offset + int64(size),
+	})
+
+	// the values of the columns follow the header
+	var values []string
+	body := int(size)
+	for i, t := range types {
+		name, length := sqliteSerialType(t)
+		if length > uint64(len(b)-body) {
+			n.children = append(n.children, &node{name: fmt.Sprintf("[%d] %s", i, name), value: "on overflow pages"})
+			values = append(values, "...")
+			break
+		}
+		end := body + int(length)
+		value := d.value(t, b[body:end])
+		n.children = append(n.children, &node{
+			name:  fmt.Sprintf("[%d] %s", i, name),
+			value: value,
+			start: offset + int64(body),
+			end:   offset + int64(end),
+		})
+		values = append(values, value)
+		body = end
+	}
+	n.value = strings.Join(values, ", ")
+	return n
+}
+
+// sqliteSerialType returns the name and size of the values of a serial type.
+// the size is unsigned, as corrupt serial types give sizes beyond int64.
+func sqliteSerialType(t uint64) (string, uint64) {
+	switch {
+	case t == 0:
+		return "NULL", 0
+	case t <= 4:
+		return "integer", t
+	case t == 5:
+		return "integer", 6
+	case t == 6:
+		return "integer", 8
+	case t == 7:
+		return "float", 8
+	case t == 8 || t == 9:
+		return "integer", 0
+	case t >= 12 && t%2 == 0:
+		return "blob", (t - 12) / 2
+	case t >= 13:
+		return "text", (t - 13) / 2
+	}
+	return "reserved", 0
+}
+
+// value formats a value of serial type t
+func (d *sqliteDB) value(t uint64, b []byte) string {
+	switch {
+	case t == 0:
+		return "NULL"
+	case t <= 6:
+		v := getUint(b, len(b), binary.BigEndian)
+		shift := uint(64 - 8*len(b))
+		return fmt.Sprint(int64(v<<shift) >> shift)
+	case t == 7:
+		return fmt.Sprint(math.Float64frombits(binary.BigEndian.Uint64(b)))
+	case t == 8 || t == 9:
+		return fmt.Sprint(t - 8)
+	case t >= 13 && t%2 == 1:
+		if d.encoding == 2 || d.encoding == 3 {
+			s := make([]uint16, len(b)/2)
+			for i := range s {
+				if d.encoding == 2 {
+					s[i] = binary.LittleEndian.Uint16(b[2*i:])
+				} else {
+					s[i] = binary.BigEndian.Uint16(b[2*i:])
+				}
+			}
+			return fmt.Sprintf("%q", string(utf16.Decode(s)))
+		}
+		return fmt.Sprintf("%q", b)
+	}
+	return formatBytes(b)
+}
+
+// sqliteVarint decodes a big endian variable length integer of up to 9
+// bytes, returning the value and its size, or 0 if b is too short
+func sqliteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i, c := range b {
+		if i == 8 {
+			return v<<8 | uint64(c), 9
+		}
+		v = v<<7 | uint64(c&0x7F)
+		if c&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
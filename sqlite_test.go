@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// sqliteTestDB returns a database of one 512 byte leaf table page holding
+// a single cell
+func sqliteTestDB(cell []byte) []byte {
+	b := make([]byte, 512)
+	copy(b, sqliteSignature)
+	b[16], b[17] = 0x02, 0x00 // page size
+	b[18], b[19] = 1, 1
+	b[21], b[22], b[23] = 64, 32, 32
+	b[100] = 13                // leaf table page
+	b[103], b[104] = 0, 1      // cells
+	b[105], b[106] = 0x01, 0x0 // cell content area
+	b[108], b[109] = 0x01, 0x0 // cell pointer
+	copy(b[0x100:], cell)
+	return b
+}
+
+func TestSQLiteCorruptCells(t *testing.T) {
+	huge := []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFE}
+	tests := []struct {
+		name string
+		cell []byte
+	}{
+		{"payload size of 2^64-2", append(append([]byte{}, huge...), 1)},
+		{"serial type of 2^64-2", append([]byte{20, 1, 10}, huge...)},
+		{"truncated payload size", []byte{0x80, 0x80}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := sqliteTestDB(test.cell)
+			if _, err := parseSQLite(bytes.NewReader(db), int64(len(db))); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
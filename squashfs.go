@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// this file contains the superblock and tables of squashfs file systems
+
+const squashfsSuperblockSize = 96
+
+var squashfsCompressors = map[uint64]string{1: "gzip", 2: "lzma", 3: "lzo", 4: "xz", 5: "lz4", 6: "zstd"}
+
+func detectSquashfs(head []byte) bool {
+	return bytes.HasPrefix(head, []byte("hsqs"))
+}
+
+func parseSquashfs(r io.ReaderAt, size int64) ([]*node, error) {
+	fields, v, err := squashfsSuper(r)
+	if err != nil {
+		return nil, err
+	}
+	super := group("Superblock", fmt.Sprintf("%s, %d inodes, blocks of %d bytes", squashfsCompressors[v["compressor"]], v["inode count"], v["block size"]), fields)
+	nodes := []*node{super}
+
+	// compressed data blocks follow the superblock, then the tables, each
+	// ending where the next one starts; blocks have no fixed offsets, so
+	// there are no units to go to
+	tables := []struct {
+		name   string
+		offset uint64
+	}{
+		{"Data", squashfsSuperblockSize},
+		{"Inode table", v["inode table"]},
+		{"Directory table", v["directory table"]},
+		{"Fragment table", v["fragment table"]},
+		{"Export table", v["export table"]},
+		{"ID table", v["ID table"]},
+		{"Xattr table", v["xattr table"]},
+	}
+	sort.SliceStable(tables, func(i, j int) bool { return tables[i].offset < tables[j].offset })
+	used := v["bytes used"]
+	for i, t := range tables {
+		// unused tables have all bits set
+		if t.offset == 1<<64-1 || t.offset >= used {
+			continue
+		}
+		end := used
+		if i+1 < len(tables) && tables[i+1].offset < used {
+			end = tables[i+1].offset
+		}
+		nodes = append(nodes, &node{name: t.name, value: fmt.Sprintf("%d bytes", end-t.offset), start: int64(t.offset), end: int64(end)})
+	}
+	if used > uint64(size) {
+		return nodes, fmt.Errorf("file system is truncated, %d of %d bytes present", size, used)
+	}
+	if used < uint64(size) {
+		nodes = append(nodes, &node{name: "Padding", value: fmt.Sprintf("%d bytes", size-int64(used)), start: int64(used), end: size})
+	}
+	return nodes, nil
+}
+
+// squashfsSuper reads the superblock fields
+func squashfsSuper(r io.ReaderAt) ([]*node, map[string]uint64, error) {
+	fields, v, err := readFields(r, 0, binary.LittleEndian, []structField{
+		{"magic", 4, nil},
+		{"inode count", 4, nil},
+		{"modification time", 4, func(v uint64) string { return formatTime(time.Unix(int64(v), 0)) }},
+		{"block size", 4, nil},
+		{"fragment count", 4, nil},
+		{"compressor", 2, func(v uint64) string { return squashfsCompressors[v] }},
+		{"block log", 2, nil},
+		{"flags", 2, nil},
+		{"ID count", 2, nil},
+		{"major version", 2, nil},
+		{"minor version", 2, nil},
+		{"root inode", 8, nil},
+		{"bytes used", 8, nil},
+		{"ID table", 8, nil},
+		{"xattr table", 8, nil},
+		{"inode table", 8, nil},
+		{"directory table", 8, nil},
+		{"fragment table", 8, nil},
+		{"export table", 8, nil},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	fields[0].value = `"hsqs"`
+	if v["block size"] == 0 || v["major version"] != 4 {
+		return nil, nil, fmt.Errorf("unsupported squashfs version %d", v["major version"])
+	}
+	return fields, v, nil
+}
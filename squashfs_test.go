@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// squashfsTestImage returns a superblock followed by tables of 16 bytes,
+// without export and xattr tables
+func squashfsTestImage() []byte {
+	order := binary.LittleEndian
+	b := make([]byte, 256)
+	copy(b, "hsqs")
+	order.PutUint32(b[4:], 1)
+	order.PutUint32(b[12:], 128<<10)
+	order.PutUint16(b[20:], 1) // gzip
+	order.PutUint16(b[22:], 17)
+	order.PutUint16(b[26:], 1)
+	order.PutUint16(b[28:], 4)
+	order.PutUint64(b[40:], 176)     // bytes used
+	order.PutUint64(b[48:], 160)     // ID table
+	order.PutUint64(b[56:], 1<<64-1) // xattr table
+	order.PutUint64(b[64:], 112)     // inode table
+	order.PutUint64(b[72:], 128)     // directory table
+	order.PutUint64(b[80:], 144)     // fragment table
+	order.PutUint64(b[88:], 1<<64-1) // export table
+	return b
+}
+
+func TestSquashfs(t *testing.T) {
+	nodes := parseValid(t, parseSquashfs, squashfsTestImage())
+	want := []struct {
+		name       string
+		start, end int64
+	}{
+		{"Data", 96, 112},
+		{"Inode table", 112, 128},
+		{"Directory table", 128, 144},
+		{"Fragment table", 144, 160},
+		{"ID table", 160, 176},
+		{"Padding", 176, 256},
+	}
+	if len(nodes) != len(want)+1 {
+		t.Fatalf("decoded %d regions, want superblock and %d", len(nodes), len(want))
+	}
+	for i, w := range want {
+		if n := nodes[i+1]; n.name != w.name || n.start != w.start || n.end != w.end {
+			t.Errorf("decoded %s at %d-%d, want %s at %d-%d", n.name, n.start, n.end, w.name, w.start, w.end)
+		}
+	}
+}
+
+func TestSquashfsTruncated(t *testing.T) {
+	parseTruncated(t, parseSquashfs, squashfsTestImage())
+}
+
+func TestSquashfsCorrupt(t *testing.T) {
+	parseCorrupt(t, parseSquashfs, squashfsTestImage())
+}
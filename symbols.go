@@ -0,0 +1,194 @@
+package main
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// this file contains symbol lookup from ELF symbol tables and DWARF debug
+// information, mapping names to file offsets
+
+// symbolMatches limits the number of completions of a symbol name
+const symbolMatches = 100
+
+type symbol struct {
+	name   string
+	offset int64 // file offset of first byte
+	size   int64 // size in bytes, or 0 if unknown
+}
+
+// symbolTable holds symbols sorted by offset
+type symbolTable []symbol
+
+// loadSymbols returns the function and data symbols of an ELF file, or nil
+// if it has none. addrs maps symbol addresses to file offsets.
+func loadSymbols(r io.ReaderAt, addrs addrMap) symbolTable {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	// symbols of object files are relative to their section
+	offset := func(section elf.SectionIndex, value uint64) (int64, bool) {
+		if f.Type == elf.ET_REL {
+			if int(section) >= len(f.Sections) || f.Sections[section].Type == elf.SHT_NOBITS {
+				return 0, false
+			}
+			return int64(f.Sections[section].Offset + value), true
+		}
+		return addrs.offset(value)
+	}
+
+	var t symbolTable
+	seen := map[int64]bool{}
+	symbols, _ := f.Symbols()
+	dynamic, _ := f.DynamicSymbols()
+	for _, s := range append(symbols, dynamic...) {
+		typ := elf.ST_TYPE(s.Info)
+		if s.Name == "" || s.Section == elf.SHN_UNDEF || s.Section >= elf.SHN_LORESERVE ||
+			typ != elf.STT_FUNC && typ != elf.STT_OBJECT {
+			continue
+		}
+		if o, ok := offset(s.Section, s.Value); ok {
+			t = append(t, symbol{s.Name, o, int64(s.Size)})
+			seen[o] = true
+		}
+	}
+
+	// functions described by DWARF, which may remain when the symbol table is stripped
+	if d, err := f.DWARF(); err == nil {
+		dr := d.Reader()
+		for {
+			e, err := dr.Next()
+			if err != nil || e == nil {
+				break
+			}
+			if e.Tag != dwarf.TagSubprogram {
+				continue
+			}
+			name, _ := e.Val(dwarf.AttrName).(string)
+			low, ok := e.Val(dwarf.AttrLowpc).(uint64)
+			if name == "" || !ok {
+				continue
+			}
+			var size int64
+			switch high := e.Val(dwarf.AttrHighpc).(type) {
+			case uint64:
+				size = int64(high - low)
+			case int64:
+				size = high
+			}
+			if o, ok := addrs.offset(low); ok && !seen[o] {
+				t = append(t, symbol{name, o, size})
+				seen[o] = true
+			}
+		}
+	}
+
+	// aliases at the same offset are ordered by size, so sized symbols are found first
+	sort.SliceStable(t, func(i, j int) bool {
+		if t[i].offset != t[j].offset {
+			return t[i].offset < t[j].offset
+		}
+		return t[i].size > t[j].size
+	})
+	return t
+}
+
+// lookup returns the symbol containing offset. symbols of unknown size
+// extend to the next symbol.
+func (t symbolTable) lookup(offset int64) (symbol, bool) {
+	i := sort.Search(len(t), func(i int) bool { return t[i].offset > offset }) - 1
+	if i < 0 {
+		return symbol{}, false
+	}
+	for i > 0 && t[i-1].offset == t[i].offset {
+		i--
+	}
+	if t[i].size == 0 || offset < t[i].offset+t[i].size {
+		return t[i], true
+	}
+	return symbol{}, false
+}
+
+// describe returns offset as symbol name plus offset into the symbol, if any
+func (t symbolTable) describe(offset int64) string {
+	s, ok := t.lookup(offset)
+	if !ok {
+		return ""
+	}
+	if offset == s.offset {
+		return s.name
+	}
+	return fmt.Sprintf("%s+0x%x", s.name, offset-s.offset)
+}
+
+// find returns the symbol with the given name
+func (t symbolTable) find(name string) (symbol, bool) {
+	for _, s := range t {
+		if s.name == name {
+			return s, true
+		}
+	}
+	return symbol{}, false
+}
+
+// complete returns the names of symbols matching text, ignoring case.
+// names starting with text come first, then names containing it, then
+// names containing its characters in order.
+func (t symbolTable) complete(text string) []string {
+	text = strings.ToLower(text)
+	type match struct {
+		name  string
+		score int
+	}
+	var matches []match
+	seen := map[string]bool{}
+	for _, s := range t {
+		name := strings.ToLower(s.name)
+		score := -1
+		switch {
+		case strings.HasPrefix(name, text):
+			score = 0
+		case strings.Contains(name, text):
+			score = 1
+		case subsequence(name, text):
+			score = 2
+		}
+		if score >= 0 && !seen[s.name] {
+			matches = append(matches, match{s.name, score})
+			seen[s.name] = true
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score < matches[j].score
+		}
+		if len(matches[i].name) != len(matches[j].name) {
+			return len(matches[i].name) < len(matches[j].name)
+		}
+		return matches[i].name < matches[j].name
+	})
+	names := make([]string, 0, min(len(matches), symbolMatches))
+	for i := 0; i < len(matches) && i < symbolMatches; i++ {
+		names = append(names, matches[i].name)
+	}
+	return names
+}
+
+// subsequence returns whether the characters of sub appear in s in order
+func subsequence(s, sub string) bool {
+	for _, c := range sub {
+		i := strings.IndexRune(s, c)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(string(c)):]
+	}
+	return true
+}
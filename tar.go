@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// this file contains the tar archive format, including the ustar, GNU and
+// PAX extensions
+
+const (
+	tarBlockSize  = 512
+	tarMaxMembers = 1 << 20
+)
+
+var tarTypes = map[byte]string{
+	0:   "file",
+	'0': "file",
+	'1': "hard link",
+	'2': "symbolic link",
+	'3': "character device",
+	'4': "block device",
+	'5': "directory",
+	'6': "fifo",
+	'7': "contiguous file",
+	'g': "PAX global header",
+	'x': "PAX header",
+	'L': "GNU long name",
+	'K': "GNU long link name",
+	'S': "GNU sparse file",
+	'V': "GNU volume header",
+}
+
+// tarField is a field of a tar header, which is either a string or a number
+type tarField struct {
+	name   string
+	size   int
+	number bool
+}
+
+var tarFields = []tarField{
+	{"name", 100, false},
+	{"mode", 8, true},
+	{"uid", 8, true},
+	{"gid", 8, true},
+	{"size", 12, true},
+	{"mtime", 12, true},
+	{"chksum", 8, true},
+	{"typeflag", 1, false},
+	{"linkname", 100, false},
+	{"magic", 6, false},
+	{"version", 2, false},
+	{"uname", 32, false},
+	{"gname", 32, false},
+	{"devmajor", 8, true},
+	{"devminor", 8, true},
+	{"prefix", 155, false},
+}
+
+func detectTar(head []byte) bool {
+	return len(head) >= tarBlockSize && bytes.HasPrefix(head[257:], []byte("ustar"))
+}
+
+func parseTar(r io.ReaderAt, size int64) ([]*node, error) {
+	var nodes []*node
+
+	// extended headers apply to the next member
+	var longName, longLink string
+	pax := map[string]string{}
+	global := map[string]string{}
+
+	pos := int64(0)
+	for i := 0; pos+tarBlockSize <= size; i++ {
+		if i == tarMaxMembers {
+			return nodes, fmt.Errorf("showing the first %d members", tarMaxMembers)
+		}
+		b := make([]byte, tarBlockSize)
+		if _, err := r.ReadAt(b, pos); err != nil {
+			return nodes, err
+		}
+		if bytes.Count(b, []byte{0}) == tarBlockSize {
+			// the archive ends with zero blocks, up to the end of the last record
+			end := pos
+			for end+tarBlockSize <= size {
+				if _, err := r.ReadAt(b, end); err != nil || bytes.Count(b, []byte{0}) != tarBlockSize {
+					break
+				}
+				end += tarBlockSize
+			}
+			nodes = append(nodes, &node{name: "End of archive", value: fmt.Sprintf("%d zero blocks", (end-pos)/tarBlockSize), start: pos, end: end})
+			if end < size {
+				nodes = append(nodes, &node{name: "Trailing data", value: fmt.Sprintf("%d bytes", size-end), start: end, end: size})
+			}
+			return nodes, nil
+		}
+
+		header, values := tarHeader(b, pos)
+		stored, expected := values["chksum"], tarChecksum(b)
+		status := "ok"
+		if stored != expected {
+			if !bytes.HasPrefix(b[257:], []byte("ustar")) {
+				nodes = append(nodes, &node{name: "Trailing data", value: fmt.Sprintf("%d bytes", size-pos), start: pos, end: size})
+				return nodes, fmt.Errorf("invalid tar header at %08X", pos)
+			}
+			status = "bad"
+			header.children[6].fix = []byte(fmt.Sprintf("%06o\x00 ", expected))
+		}
+		header.value = "checksum " + status
+
+		typ := b[156]
+		name := tarString(b[0:100])
+		if prefix := tarString(b[345:500]); prefix != "" && strings.HasPrefix(string(b[257:]), "ustar\x00") {
+			name = prefix + "/" + name
+		}
+		link := tarString(b[157:257])
+		length := int64(values["size"])
+		for k, v := range global {
+			if _, ok := pax[k]; !ok {
+				pax[k] = v
+			}
+		}
+		if v, ok := pax["path"]; ok {
+			name = v
+		}
+		if v, ok := pax["linkpath"]; ok {
+			link = v
+		}
+		if v, ok := pax["size"]; ok {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil && typ != 'x' && typ != 'g' {
+				length = n
+			}
+		}
+		if longName != "" {
+			name = longName
+		}
+		if longLink != "" {
+			link = longLink
+		}
+		if length < 0 || pos+tarBlockSize+length > size {
+			return append(nodes, header), fmt.Errorf("member %s at %08X is truncated", name, pos)
+		}
+
+		kind, ok := tarTypes[typ]
+		if !ok {
+			kind = fmt.Sprintf("type %q", typ)
+		}
+		value := fmt.Sprintf("%s, %d bytes, checksum %s", kind, length, status)
+		if link != "" {
+			value += " -> " + link
+		}
+		data := &node{name: "data", value: fmt.Sprintf("%d bytes", length), start: pos + tarBlockSize, end: pos + tarBlockSize + length}
+		member := &node{
+			name:     fmt.Sprintf("[%d] %s", i, name),
+			value:    value,
+			start:    pos,
+			end:      data.end,
+			children: []*node{header, data},
+		}
+
+		// extended headers describe the next member in their data
+		var content []byte
+		if typ == 'x' || typ == 'g' || typ == 'L' || typ == 'K' {
+			content = make([]byte, length)
+			if _, err := r.ReadAt(content, data.start); err != nil {
+				return nodes, err
+			}
+		}
+		next := map[string]string{}
+		switch typ {
+		case 'x', 'g':
+			records := tarPAXRecords(content, data.start)
+			data.children = records
+			for _, n := range records {
+				if n.children != nil {
+					next[n.children[0].value] = n.children[1].value
+				}
+			}
+			member.name = fmt.Sprintf("[%d] %s", i, kind)
+			if typ == 'g' {
+				for k, v := range next {
+					global[k] = v
+				}
+				next = map[string]string{}
+			}
+			longName, longLink = "", ""
+		case 'L':
+			longName = tarString(content)
+			data.value = fmt.Sprintf("%q", longName)
+			member.name = fmt.Sprintf("[%d] %s", i, kind)
+		case 'K':
+			longLink = tarString(content)
+			data.value = fmt.Sprintf("%q", longLink)
+			member.name = fmt.Sprintf("[%d] %s", i, kind)
+		default:
+			longName, longLink = "", ""
+		}
+		pax = next
+		nodes = append(nodes, member)
+		pos += tarBlockSize + (length+tarBlockSize-1)/tarBlockSize*tarBlockSize
+	}
+	if pos < size {
+		nodes = append(nodes, &node{name: "Trailing data", value: fmt.Sprintf("%d bytes", size-pos), start: pos, end: size})
+	}
+	return nodes, nil
+}
+
+// tarHeader decodes the header block b at pos, returning its node and the
+// values of its number fields
+func tarHeader(b []byte, pos int64) (*node, map[string]uint64) {
+	values := map[string]uint64{}
+	var fields []*node
+	o := 0
+	for _, f := range tarFields {
+		n := &node{name: f.name, start: pos + int64(o), end: pos + int64(o+f.size)}
+		raw := b[o : o+f.size]
+		switch {
+		case f.number:
+			v := tarNumber(raw)
+			values[f.name] = v
+			n.value = fmt.Sprintf("%q (%d)", tarString(raw), v)
+			if f.name == "mode" {
+				n.value = fmt.Sprintf("%q (%04o)", tarString(raw), v)
+			} else if f.name == "mtime" {
+				n.value = fmt.Sprintf("%q (%s)", tarString(raw), formatTime(time.Unix(int64(v), 0)))
+			}
+			if raw[0]&0x80 != 0 {
+				// GNU base-256 encoding of large numbers
+				n.value = fmt.Sprintf("%d", v)
+			}
+		case f.name == "typeflag":
+			n.value = fmt.Sprintf("%q", raw)
+			if s, ok := tarTypes[raw[0]]; ok {
+				n.value += " " + s
+			}
+		default:
+			n.value = fmt.Sprintf("%q", tarString(raw))
+			if f.name == "magic" || f.name == "version" {
+				n.value = fmt.Sprintf("%q", raw)
+			}
+		}
+		fields = append(fields, n)
+		o += f.size
+	}
+	header := group("header", "", fields)
+	header.end = pos + tarBlockSize
+	return header, values
+}
+
+// tarChecksum returns the sum of the header bytes, counting the checksum
+// field as spaces
+func tarChecksum(b []byte) uint64 {
+	var sum uint64
+	for i, c := range b[:tarBlockSize] {
+		if i >= 148 && i < 156 {
+			c = ' '
+		}
+		sum += uint64(c)
+	}
+	return sum
+}
+
+// tarString returns a field up to the first null byte
+func tarString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// tarNumber decodes an octal number, or a base-256 number if the high bit
+// of the first byte is set
+func tarNumber(b []byte) uint64 {
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		v := uint64(b[0] & 0x7F)
+		for _, c := range b[1:] {
+			v = v<<8 | uint64(c)
+		}
+		return v
+	}
+	v, _ := strconv.ParseUint(strings.Trim(tarString(b), " "), 8, 64)
+	return v
+}
+
+// tarPAXRecords decodes the "length key=value\n" records of a PAX header
+func tarPAXRecords(b []byte, offset int64) []*node {
+	var records []*node
+	pos := 0
+	for pos < len(b) {
+		sp := bytes.IndexByte(b[pos:], ' ')
+		if sp <= 0 {
+			break
+		}
+		length, err := strconv.Atoi(string(b[pos : pos+sp]))
+		if err != nil || length <= sp+1 || pos+length > len(b) {
+			break
+		}
+		record := string(b[pos+sp+1 : pos+length])
+		record = strings.TrimSuffix(record, "\n")
+		n := &node{name: fmt.Sprintf("[%d]", len(records)), value: fmt.Sprintf("%q", record), start: offset + int64(pos), end: offset + int64(pos+length)}
+		if eq := strings.IndexByte(record, '='); eq > 0 {
+			key := offset + int64(pos+sp+1)
+			n.name = record[:eq]
+			n.value = fmt.Sprintf("%q", record[eq+1:])
+			n.children = []*node{
+				{name: "key", value: record[:eq], start: key, end: key + int64(eq)},
+				{name: "value", value: record[eq+1:], start: key + int64(eq+1), end: key + int64(len(record))},
+			}
+		}
+		records = append(records, n)
+		pos += length
+	}
+	return records
+}
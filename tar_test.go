@@ -0,0 +1,49 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// tarTestFile returns an archive of a directory, a file with a name too
+// long for its header and a symbolic link
+func tarTestFile(t *testing.T) []byte {
+	var b bytes.Buffer
+	w := tar.NewWriter(&b)
+	long := strings.Repeat("x", 120)
+	for _, h := range []*tar.Header{
+		{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: long, Typeflag: tar.TypeReg, Mode: 0644, Size: 5, Format: tar.FormatPAX},
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "dir"},
+	} {
+		if err := w.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Size > 0 {
+			if _, err := w.Write([]byte("hello")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestTar(t *testing.T) {
+	nodes := parseValid(t, parseTar, tarTestFile(t))
+	if findNode(nodes, "[0] dir/") == nil || findNode(nodes, "[2] "+strings.Repeat("x", 120)) == nil || findNode(nodes, "[3] link") == nil {
+		t.Fatal("members not decoded")
+	}
+}
+
+func TestTarTruncated(t *testing.T) {
+	parseTruncated(t, parseTar, tarTestFile(t))
+}
+
+func TestTarCorrupt(t *testing.T) {
+	parseCorrupt(t, parseTar, tarTestFile(t))
+}
@@ -0,0 +1,626 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/unicode"
+)
+
+// this file contains structure templates, which describe binary structures
+// in JSON and decode them into structure trees. example:
+//
+//	{
+//		"endian": "le",
+//		"root": "header",
+//		"types": {
+//			"header": [
+//				{"name": "magic", "type": "bytes", "size": 4},
+//				{"name": "version", "type": "u16"},
+//				{"name": "count", "type": "u32be"},
+//				{"name": "flags", "type": "u8", "if": "version >= 2"},
+//				{"name": "entries", "type": "entry", "count": "count"}
+//			],
+//			"entry": [
+//				{"name": "name_len", "type": "u8"},
+//				{"name": "name", "type": "str", "size": "name_len"},
+//				{"name": "value", "type": "f32"}
+//			]
+//		}
+//	}
+//
+// integer types are u8, u16, u32, u64, s8, s16, s32 and s64, float types
+// are f32 and f64, each optionally suffixed with le or be. other types are
+// bytes, str (sized string), strz (null-terminated string) or the name of
+// another type. bytes without contents and str need a size. sizes, counts
+// and conditions are expressions, see expr.go.
+//
+// integer fields may name an enum, mapping values to names:
+//
+//	"enums": {"color": {"1": "red", "2": "green"}}
+//
+// enum values can be used in expressions as "color::red". types and enums
+// may be named by paths like "header::color", and are then looked up in the
+// type of the struct and the types containing it, as in Kaitai Struct.
+
+type template struct {
+	Endian   string                       `json:"endian"`   // default byte order, "le" or "be"
+	Encoding string                       `json:"encoding"` // default encoding of str and strz fields
+	Root     string                       `json:"root"`     // type to decode, defaults to "main"
+	Types    map[string][]templateField   `json:"types"`
+	Enums    map[string]map[string]string `json:"enums"`
+}
+
+type templateField struct {
+	Name     string            `json:"name"`
+	Type     string            `json:"type"`
+	Endian   string            `json:"endian"`   // byte order, overriding template byte order
+	Size     templateExpr      `json:"size"`     // size in bytes of bytes, str or struct fields
+	Count    templateExpr      `json:"count"`    // repeat field count times
+	Until    templateExpr      `json:"until"`    // repeat field until true, "_" is the last element
+	EOS      bool              `json:"eos"`      // repeat field until end of data
+	If       templateExpr      `json:"if"`       // only decode field if true
+	Pos      templateExpr      `json:"pos"`      // decode field at offset from start of data
+	Encoding string            `json:"encoding"` // encoding of str and strz fields, default ascii
+	Contents string            `json:"contents"` // expected contents of bytes field, as hex
+	Value    templateExpr      `json:"value"`    // computed value, which covers no bytes
+	Enum     string            `json:"enum"`     // enum naming values of integer field
+	Switch   templateExpr      `json:"switch"`   // value selecting type from cases
+	Cases    map[string]string `json:"cases"`    // types by value of switch, "_" is the default
+}
+
+// templateExpr is an expression, which may be written as a JSON string, number or boolean
+type templateExpr string
+
+func (e *templateExpr) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*e = templateExpr(s)
+		return nil
+	}
+	*e = templateExpr(b)
+	return nil
+}
+
+// loadTemplate reads a template from a file, which may also
+// be a Kaitai Struct format description with the .ksy extension
+func loadTemplate(filename string) (*template, error) {
+	if strings.ToLower(filepath.Ext(filename)) == ".ksy" {
+		return loadKsy(filename)
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	t := &template{}
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, fmt.Errorf("invalid template %s: %v", filename, err)
+	}
+	return t, nil
+}
+
+// apply decodes the root type of the template at offset.
+// if decoding fails, the tree decoded so far is returned with the error.
+func (t *template) apply(r io.ReaderAt, size, offset int64) ([]*node, error) {
+	root := t.Root
+	if root == "" {
+		root = "main"
+	}
+	if t.Types[root] == nil {
+		return nil, fmt.Errorf("template has no type \"%s\"", root)
+	}
+	p := &templateParser{t: t, r: r, exprs: map[templateExpr]expr{}, enums: map[string]map[int64]string{}}
+	for name, enum := range t.Enums {
+		p.enums[name] = map[int64]string{}
+		for k, v := range enum {
+			x, err := strconv.ParseInt(k, 0, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value \"%s\" of enum \"%s\"", k, name)
+			}
+			p.enums[name][x] = v
+		}
+	}
+	for _, f := range t.Types {
+		for i := range f {
+			if f[i].Contents != "" {
+				if _, err := hex.DecodeString(f[i].Contents); err != nil {
+					return nil, fmt.Errorf("invalid contents of field \"%s\": %v", f[i].Name, err)
+				}
+			}
+		}
+	}
+	n, _, err := p.parseStruct(root, root, nil, offset, size)
+	return []*node{n}, err
+}
+
+type templateParser struct {
+	t      *template
+	r      io.ReaderAt
+	exprs  map[templateExpr]expr       // compiled expressions
+	enums  map[string]map[int64]string // names of enum values
+	values int                         // values decoded so far
+}
+
+// limits of decoding data with counts or positions referring to itself
+const (
+	templateMaxDepth  = 256     // of nested structs
+	templateMaxValues = 1 << 20 // decoded in total
+	templateMaxString = 1 << 20 // bytes of null-terminated strings without size
+)
+
+// templateLimitError is returned if data exceeds the limits of decoding. it
+// is not prefixed with the fields containing it, which repeat if so deep.
+type templateLimitError string
+
+func (e templateLimitError) Error() string {
+	return string(e)
+}
+
+// templateScope holds the values of decoded fields of a struct
+type templateScope struct {
+	p      *templateParser
+	names  map[string]interface{}
+	parent *templateScope
+	typ    string
+	depth  int   // of nested structs
+	start  int64 // offset of start of data
+	pos    int64 // offset of next field
+	limit  int64 // offset of end of data
+}
+
+func (s *templateScope) lookup(name string) (interface{}, bool) {
+	switch name {
+	case "_parent":
+		return s.parent, s.parent != nil
+	case "_root":
+		root := s
+		for root.parent != nil {
+			root = root.parent
+		}
+		return root, true
+	case "_io":
+		return ioScope{s.limit - s.start, s.pos - s.start}, true
+	}
+	if i := strings.LastIndex(name, "::"); i >= 0 {
+		// enum value, possibly prefixed by names of types
+		enum := qualifiedName(s.typ, name[:i], func(name string) bool { return s.p.enums[name] != nil })
+		for k, v := range s.p.enums[enum] {
+			if v == name[i+2:] {
+				return k, true
+			}
+		}
+		return nil, false
+	}
+	if v, ok := s.names[name]; ok {
+		return v, true
+	}
+	if s.parent != nil {
+		return s.parent.lookup(name)
+	}
+	return nil, false
+}
+
+// qualifiedName returns the full path of the type or enum name used in the
+// type at path, looking in that type first and then in the types containing
+// it. if no such path exists, name is returned.
+func qualifiedName(path, name string, exists func(name string) bool) string {
+	for path != "" {
+		if exists(path + "::" + name) {
+			return path + "::" + name
+		}
+		i := strings.LastIndex(path, "::")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return name
+}
+
+// ioScope describes the data a struct is decoded from
+type ioScope struct {
+	size, pos int64
+}
+
+func (s ioScope) lookup(name string) (interface{}, bool) {
+	switch name {
+	case "size":
+		return s.size, true
+	case "pos":
+		return s.pos, true
+	case "eof":
+		return s.pos >= s.size, true
+	}
+	return nil, false
+}
+
+func (p *templateParser) eval(e templateExpr, s *templateScope) (interface{}, error) {
+	if p.exprs[e] == nil {
+		c, err := compileExpr(string(e))
+		if err != nil {
+			return nil, err
+		}
+		p.exprs[e] = c
+	}
+	return p.exprs[e](s)
+}
+
+func (p *templateParser) evalInt(e templateExpr, s *templateScope) (int64, error) {
+	v, err := p.eval(e, s)
+	if err != nil {
+		return 0, err
+	}
+	return toInt(v)
+}
+
+// parseStruct decodes the fields of a type from pos up to limit
+func (p *templateParser) parseStruct(name, typ string, parent *templateScope, pos, limit int64) (*node, *templateScope, error) {
+	s := &templateScope{p: p, names: map[string]interface{}{}, parent: parent, typ: typ, start: pos, pos: pos, limit: limit}
+	if parent != nil {
+		s.depth = parent.depth + 1
+		if s.depth > templateMaxDepth {
+			return &node{name: name, start: pos, end: pos}, s, templateLimitError(fmt.Sprintf("structs nested more than %d levels deep at %08X", templateMaxDepth, pos))
+		}
+		if parent.limit == limit {
+			// struct without size shares data with its parent
+			s.start = parent.start
+		}
+	}
+	n := &node{name: name, start: pos, end: pos}
+	for i := range p.t.Types[typ] {
+		f := &p.t.Types[typ][i]
+		c, v, err := p.parseField(f, s)
+		if c != nil {
+			n.children = append(n.children, c)
+			n.end = max64(n.end, c.end)
+		}
+		if _, ok := err.(templateLimitError); ok {
+			return n, s, err
+		}
+		if err != nil {
+			return n, s, fmt.Errorf("%s.%s: %v", typ, f.Name, err)
+		}
+		if c != nil {
+			s.names[f.Name] = v
+		}
+	}
+	return n, s, nil
+}
+
+// parseField decodes a field, or an array of fields, at the current position of s
+func (p *templateParser) parseField(f *templateField, s *templateScope) (*node, interface{}, error) {
+	if f.If != "" {
+		v, err := p.eval(f.If, s)
+		if err != nil || !truthy(v) {
+			return nil, nil, err
+		}
+	}
+
+	// fields with a position do not move the current position
+	pos, advance := s.pos, true
+	if f.Pos != "" {
+		offset, err := p.evalInt(f.Pos, s)
+		if err != nil {
+			return nil, nil, err
+		}
+		pos, advance = s.start+offset, false
+	}
+
+	// computed value
+	if f.Value != "" {
+		v, err := p.eval(f.Value, s)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &node{name: f.Name, value: p.format(f, v), start: pos, end: pos}, v, nil
+	}
+
+	// single field
+	if f.Count == "" && f.Until == "" && !f.EOS {
+		n, v, err := p.parseValue(f, f.Name, s, pos)
+		if err == nil && advance {
+			s.pos = n.end
+		}
+		return n, v, err
+	}
+
+	// array of fields
+	count := int64(-1)
+	if f.Count != "" {
+		var err error
+		if count, err = p.evalInt(f.Count, s); err != nil {
+			return nil, nil, err
+		}
+	}
+	n := &node{name: f.Name, start: pos, end: pos}
+	var values []interface{}
+	s.names["_index"] = int64(0)
+	for i := int64(0); count < 0 || i < count; i++ {
+		if f.EOS && pos >= s.limit {
+			break
+		}
+		c, v, err := p.parseValue(f, fmt.Sprintf("[%d]", i), s, pos)
+		if c != nil {
+			n.children = append(n.children, c)
+			n.end, pos = c.end, c.end
+		}
+		if err != nil {
+			return n, values, err
+		}
+		values = append(values, v)
+		s.names["_index"] = i + 1
+		if f.Until != "" {
+			s.names["_"] = v
+			done, err := p.eval(f.Until, s)
+			if err != nil {
+				return n, values, err
+			}
+			if truthy(done) {
+				break
+			}
+		}
+		if c.end == c.start && count < 0 {
+			// avoid looping forever on empty elements
+			break
+		}
+	}
+	n.value = fmt.Sprintf("[%d]", len(values))
+	if advance {
+		s.pos = n.end
+	}
+	return n, values, nil
+}
+
+// parseValue decodes a single value of the field type at pos
+func (p *templateParser) parseValue(f *templateField, name string, s *templateScope, pos int64) (*node, interface{}, error) {
+	if p.values++; p.values > templateMaxValues {
+		return nil, nil, templateLimitError(fmt.Sprintf("more than %d values at %08X", templateMaxValues, pos))
+	}
+	limit := s.limit
+	size := int64(-1)
+	if f.Size != "" {
+		var err error
+		if size, err = p.evalInt(f.Size, s); err != nil {
+			return nil, nil, err
+		}
+		if size < 0 || pos+size > limit {
+			return nil, nil, fmt.Errorf("size %d at %08X exceeds end of data", size, pos)
+		}
+		limit = pos + size
+	}
+
+	// select type by switch value
+	typ := f.Type
+	if f.Switch != "" {
+		v, err := p.eval(f.Switch, s)
+		if err != nil {
+			return nil, nil, err
+		}
+		if typ, err = p.switchType(f, v, s); err != nil {
+			return nil, nil, err
+		}
+		if typ == "" {
+			// no matching case, decode as bytes
+			typ = "bytes"
+			if size < 0 {
+				return nil, nil, fmt.Errorf("no case for value %v", v)
+			}
+		}
+	}
+
+	// struct types
+	if p.t.Types[typ] != nil {
+		n, v, err := p.parseStruct(name, typ, s, pos, limit)
+		if size >= 0 {
+			n.end = limit
+		}
+		return n, v, err
+	}
+
+	// primitive types
+	order := p.order(f)
+	if strings.HasSuffix(typ, "le") || strings.HasSuffix(typ, "be") {
+		if strings.HasSuffix(typ, "be") {
+			order = binary.BigEndian
+		} else {
+			order = binary.LittleEndian
+		}
+		typ = typ[:len(typ)-2]
+	}
+	switch typ {
+	case "u8", "u16", "u32", "u64", "s8", "s16", "s32", "s64", "f32", "f64":
+		n := map[string]int64{"8": 1, "16": 2, "32": 4, "64": 8}[typ[1:]]
+		b, err := p.read(pos, n, limit)
+		if err != nil {
+			return nil, nil, err
+		}
+		u := getUint(b, int(n), order)
+		var v interface{} = int64(u)
+		switch typ[0] {
+		case 's':
+			// sign extend value to 64 bits
+			v = int64(u<<(64-8*uint(n))) >> (64 - 8*uint(n))
+		case 'f':
+			v = math.Float64frombits(u)
+			if n == 4 {
+				v = float64(math.Float32frombits(uint32(u)))
+			}
+		}
+		return &node{name: name, value: p.format(f, v), start: pos, end: pos + n}, v, nil
+
+	case "bytes":
+		end := limit
+		contents, _ := hex.DecodeString(f.Contents)
+		if f.Contents != "" {
+			// fixed contents, e.g. magic signatures
+			end = pos + int64(len(contents))
+		} else if size < 0 {
+			return nil, nil, fmt.Errorf("missing size of bytes at %08X", pos)
+		}
+		b, err := p.read(pos, end-pos, limit)
+		if err != nil {
+			return nil, nil, err
+		}
+		n := &node{name: name, value: formatBytes(b), start: pos, end: end}
+		if f.Contents != "" && string(b) != string(contents) {
+			return n, b, fmt.Errorf("expected % X at %08X", contents, pos)
+		}
+		return n, b, nil
+
+	case "str", "strz":
+		var b []byte
+		var err error
+		end := limit
+		switch {
+		case size >= 0:
+			if b, err = p.read(pos, size, limit); err != nil {
+				return nil, nil, err
+			}
+			if typ == "strz" {
+				// stop after null terminator
+				if i := strings.IndexByte(string(b), 0); i >= 0 {
+					b, end = b[:i], pos+int64(i)+1
+				}
+			}
+		case typ == "strz":
+			if b, err = p.readStrz(pos, limit); err != nil {
+				return nil, nil, err
+			}
+			end = pos + int64(len(b)) + 1
+		default:
+			return nil, nil, fmt.Errorf("missing size of string at %08X", pos)
+		}
+		encoding := f.Encoding
+		if encoding == "" {
+			encoding = p.t.Encoding
+		}
+		str, err := decodeString(b, encoding)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &node{name: name, value: fmt.Sprintf("%q", str), start: pos, end: end}, str, nil
+	}
+	return nil, nil, fmt.Errorf("unknown type \"%s\"", f.Type)
+}
+
+// switchType returns the type of the case matching v, or the default type
+func (p *templateParser) switchType(f *templateField, v interface{}, s *templateScope) (string, error) {
+	for k, typ := range f.Cases {
+		if k == "_" {
+			continue
+		}
+		c, err := p.eval(templateExpr(k), s)
+		if err != nil {
+			return "", err
+		}
+		if equal(v, c) {
+			return typ, nil
+		}
+	}
+	return f.Cases["_"], nil
+}
+
+// format formats a value, using the enum of the field if any
+func (p *templateParser) format(f *templateField, v interface{}) string {
+	switch x := v.(type) {
+	case int64:
+		if name, ok := p.enums[f.Enum][x]; ok {
+			return fmt.Sprintf("%s (%d)", name, x)
+		}
+		if x < 0 {
+			return fmt.Sprint(x)
+		}
+		return fmt.Sprintf("%d (0x%X)", x, x)
+	case []byte:
+		return formatBytes(x)
+	case string:
+		return fmt.Sprintf("%q", x)
+	case *templateScope, []interface{}:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// order returns the byte order of a field
+func (p *templateParser) order(f *templateField) binary.ByteOrder {
+	endian := f.Endian
+	if endian == "" {
+		endian = p.t.Endian
+	}
+	if endian == "be" {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// read reads n bytes at pos, failing if they exceed limit
+func (p *templateParser) read(pos, n, limit int64) ([]byte, error) {
+	if n < 0 || pos+n > limit {
+		return nil, fmt.Errorf("%d bytes at %08X exceed end of data", n, pos)
+	}
+	b := make([]byte, n)
+	if _, err := p.r.ReadAt(b, pos); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// readStrz reads a null-terminated string at pos in chunks, so only the
+// string is read and not all data up to limit
+func (p *templateParser) readStrz(pos, limit int64) ([]byte, error) {
+	var b []byte
+	for len(b) < templateMaxString {
+		at := pos + int64(len(b))
+		if at >= limit {
+			break
+		}
+		chunk, err := p.read(at, min64(4096, limit-at), limit)
+		if err != nil {
+			return nil, err
+		}
+		if i := strings.IndexByte(string(chunk), 0); i >= 0 {
+			return append(b, chunk[:i]...), nil
+		}
+		b = append(b, chunk...)
+	}
+	if len(b) >= templateMaxString {
+		return nil, fmt.Errorf("string at %08X is longer than %d bytes", pos, templateMaxString)
+	}
+	return nil, fmt.Errorf("missing null terminator for string at %08X", pos)
+}
+
+// decodeString converts a string in the given encoding to UTF-8
+func decodeString(b []byte, encoding string) (string, error) {
+	switch strings.ToLower(encoding) {
+	case "", "ascii", "utf8", "utf-8":
+		return string(b), nil
+	case "utf-16le", "utf16le":
+		b, err := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewDecoder().Bytes(b)
+		return string(b), err
+	case "utf-16be", "utf16be":
+		b, err := unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewDecoder().Bytes(b)
+		return string(b), err
+	}
+	cm, err := getCharmap(strings.ToLower(encoding))
+	if err != nil {
+		return "", err
+	}
+	b, err = cm.NewDecoder().Bytes(b)
+	return string(b), err
+}
+
+// formatBytes formats bytes as hex, shortened if there are many
+func formatBytes(b []byte) string {
+	if len(b) > 16 {
+		return fmt.Sprintf("% X ... (%d bytes)", b[:16], len(b))
+	}
+	return fmt.Sprintf("% X", b)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTemplateLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+	}{
+		{"self containing type", `{"types": {"main": [{"name": "next", "type": "main"}]}}`},
+		{"position loop", `{"types": {"main": [{"name": "a", "type": "u8"}, {"name": "again", "type": "main", "pos": "0"}]}}`},
+		{"empty elements", `{"types": {"main": [{"name": "a", "type": "empty", "count": "0x7FFFFFFFFFFFFFFF"}], "empty": []}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl := &template{}
+			if err := json.Unmarshal([]byte(test.template), tmpl); err != nil {
+				t.Fatal(err)
+			}
+			data := make([]byte, 16)
+			nodes, err := tmpl.apply(bytes.NewReader(data), int64(len(data)), 0)
+			if _, ok := err.(templateLimitError); !ok {
+				t.Fatalf("decoding returned %v, want a limit error", err)
+			}
+			if len(nodes) != 1 || nodes[0] == nil {
+				t.Fatal("tree decoded so far not returned")
+			}
+		})
+	}
+}
+
+func TestTemplateStrings(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		data  []byte
+		value string // empty if decoding fails
+	}{
+		{"strz", `{"name": "s", "type": "strz"}`, []byte("abc\x00def"), `"abc"`},
+		{"strz past chunk", `{"name": "s", "type": "strz"}`, append(bytes.Repeat([]byte{'a'}, 5000), 0), `"` + strings.Repeat("a", 5000) + `"`},
+		{"strz without terminator", `{"name": "s", "type": "strz"}`, []byte("abc"), ""},
+		{"strz too long", `{"name": "s", "type": "strz"}`, bytes.Repeat([]byte{'a'}, templateMaxString+1), ""},
+		{"sized strz", `{"name": "s", "type": "strz", "size": 4}`, []byte("ab\x00cd"), `"ab"`},
+		{"str", `{"name": "s", "type": "str", "size": 2}`, []byte("abc"), `"ab"`},
+		{"str without size", `{"name": "s", "type": "str"}`, []byte("abc"), ""},
+		{"bytes without size", `{"name": "s", "type": "bytes"}`, []byte("abc"), ""},
+		{"contents", `{"name": "s", "type": "bytes", "contents": "6162"}`, []byte("abc"), "61 62"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl := &template{}
+			if err := json.Unmarshal([]byte(`{"types": {"main": [`+test.field+`]}}`), tmpl); err != nil {
+				t.Fatal(err)
+			}
+			nodes, err := tmpl.apply(bytes.NewReader(test.data), int64(len(test.data)), 0)
+			if test.value == "" {
+				if err == nil {
+					t.Fatal("decoded without error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v := nodes[0].children[0].value; v != test.value {
+				t.Fatalf("decoded %.40s, want %.40s", v, test.value)
+			}
+		})
+	}
+}
@@ -105,6 +105,27 @@ func (t *term) writeOverflow(s string) {
 	}
 }
 
+// writeFixed writes s truncated or padded with spaces to exactly w cells
+func (t *term) writeFixed(s string, w int) {
+	if w <= 0 {
+		return
+	}
+	t.modified = true
+	for _, c := range s {
+		if w == 0 {
+			break
+		}
+		if c < ' ' {
+			c = '.'
+		}
+		t.writeRune(c)
+		w--
+	}
+	for ; w > 0; w-- {
+		t.writeRune(' ')
+	}
+}
+
 func (t *term) close() {
 	t.screen.Fini()
 }
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// this file contains the TIFF format, which is also used for EXIF metadata
+
+const (
+	tiffMaxEntries = 1024
+	tiffMaxIFDs    = 64
+	tiffMaxValues  = 16
+)
+
+// tiffTypeSizes are the sizes of the field types, by type number
+var tiffTypeSizes = []int64{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8, 4}
+
+var tiffTypes = []string{"", "BYTE", "ASCII", "SHORT", "LONG", "RATIONAL", "SBYTE", "UNDEFINED",
+	"SSHORT", "SLONG", "SRATIONAL", "FLOAT", "DOUBLE", "IFD"}
+
+var tiffTags = map[uint16]string{
+	0x00FE: "NewSubfileType",
+	0x0100: "ImageWidth",
+	0x0101: "ImageLength",
+	0x0102: "BitsPerSample",
+	0x0103: "Compression",
+	0x0106: "PhotometricInterpretation",
+	0x010E: "ImageDescription",
+	0x010F: "Make",
+	0x0110: "Model",
+	0x0111: "StripOffsets",
+	0x0112: "Orientation",
+	0x0115: "SamplesPerPixel",
+	0x0116: "RowsPerStrip",
+	0x0117: "StripByteCounts",
+	0x011A: "XResolution",
+	0x011B: "YResolution",
+	0x011C: "PlanarConfiguration",
+	0x0128: "ResolutionUnit",
+	0x0131: "Software",
+	0x0132: "DateTime",
+	0x013B: "Artist",
+	0x013E: "WhitePoint",
+	0x013F: "PrimaryChromaticities",
+	0x0142: "TileWidth",
+	0x0143: "TileLength",
+	0x0144: "TileOffsets",
+	0x0145: "TileByteCounts",
+	0x014A: "SubIFDs",
+	0x0201: "JPEGInterchangeFormat",
+	0x0202: "JPEGInterchangeFormatLength",
+	0x0211: "YCbCrCoefficients",
+	0x0212: "YCbCrSubSampling",
+	0x0213: "YCbCrPositioning",
+	0x0214: "ReferenceBlackWhite",
+	0x02BC: "XMP",
+	0x8298: "Copyright",
+	0x829A: "ExposureTime",
+	0x829D: "FNumber",
+	0x83BB: "IPTC",
+	0x8769: "ExifIFD",
+	0x8773: "ICCProfile",
+	0x8822: "ExposureProgram",
+	0x8825: "GPSIFD",
+	0x8827: "ISOSpeedRatings",
+	0x8830: "SensitivityType",
+	0x9000: "ExifVersion",
+	0x9003: "DateTimeOriginal",
+	0x9004: "DateTimeDigitized",
+	0x9010: "OffsetTime",
+	0x9011: "OffsetTimeOriginal",
+	0x9012: "OffsetTimeDigitized",
+	0x9101: "ComponentsConfiguration",
+	0x9102: "CompressedBitsPerPixel",
+	0x9201: "ShutterSpeedValue",
+	0x9202: "ApertureValue",
+	0x9203: "BrightnessValue",
+	0x9204: "ExposureBiasValue",
+	0x9205: "MaxApertureValue",
+	0x9206: "SubjectDistance",
+	0x9207: "MeteringMode",
+	0x9208: "LightSource",
+	0x9209: "Flash",
+	0x920A: "FocalLength",
+	0x9214: "SubjectArea",
+	0x927C: "MakerNote",
+	0x9286: "UserComment",
+	0x9290: "SubSecTime",
+	0x9291: "SubSecTimeOriginal",
+	0x9292: "SubSecTimeDigitized",
+	0xA000: "FlashpixVersion",
+	0xA001: "ColorSpace",
+	0xA002: "PixelXDimension",
+	0xA003: "PixelYDimension",
+	0xA004: "RelatedSoundFile",
+	0xA005: "InteroperabilityIFD",
+	0xA20E: "FocalPlaneXResolution",
+	0xA20F: "FocalPlaneYResolution",
+	0xA210: "FocalPlaneResolutionUnit",
+	0xA215: "ExposureIndex",
+	0xA217: "SensingMethod",
+	0xA300: "FileSource",
+	0xA301: "SceneType",
+	0xA302: "CFAPattern",
+	0xA401: "CustomRendered",
+	0xA402: "ExposureMode",
+	0xA403: "WhiteBalance",
+	0xA404: "DigitalZoomRatio",
+	0xA405: "FocalLengthIn35mmFilm",
+	0xA406: "SceneCaptureType",
+	0xA407: "GainControl",
+	0xA408: "Contrast",
+	0xA409: "Saturation",
+	0xA40A: "Sharpness",
+	0xA40C: "SubjectDistanceRange",
+	0xA420: "ImageUniqueID",
+	0xA430: "CameraOwnerName",
+	0xA431: "BodySerialNumber",
+	0xA432: "LensSpecification",
+	0xA433: "LensMake",
+	0xA434: "LensModel",
+	0xA435: "LensSerialNumber",
+}
+
+var tiffGPSTags = map[uint16]string{
+	0x0000: "GPSVersionID",
+	0x0001: "GPSLatitudeRef",
+	0x0002: "GPSLatitude",
+	0x0003: "GPSLongitudeRef",
+	0x0004: "GPSLongitude",
+	0x0005: "GPSAltitudeRef",
+	0x0006: "GPSAltitude",
+	0x0007: "GPSTimeStamp",
+	0x0008: "GPSSatellites",
+	0x0009: "GPSStatus",
+	0x000A: "GPSMeasureMode",
+	0x000B: "GPSDOP",
+	0x000C: "GPSSpeedRef",
+	0x000D: "GPSSpeed",
+	0x000E: "GPSTrackRef",
+	0x000F: "GPSTrack",
+	0x0010: "GPSImgDirectionRef",
+	0x0011: "GPSImgDirection",
+	0x0012: "GPSMapDatum",
+	0x001B: "GPSProcessingMethod",
+	0x001D: "GPSDateStamp",
+}
+
+var tiffInteropTags = map[uint16]string{
+	0x0001: "InteroperabilityIndex",
+	0x0002: "InteroperabilityVersion",
+}
+
+// tiffSubIFDs are the tags pointing to other IFDs, with their tag names
+var tiffSubIFDs = map[uint16]map[uint16]string{
+	0x8769: tiffTags,
+	0x8825: tiffGPSTags,
+	0xA005: tiffInteropTags,
+	0x014A: tiffTags,
+}
+
+func detectTIFF(head []byte) bool {
+	return bytes.HasPrefix(head, []byte("II*\x00")) || bytes.HasPrefix(head, []byte("MM\x00*"))
+}
+
+func parseTIFF(r io.ReaderAt, size int64) ([]*node, error) {
+	return tiffNodes(r, 0, size)
+}
+
+// tiffNodes decodes the TIFF structure at base, in which offsets are
+// relative to base
+func tiffNodes(r io.ReaderAt, base, size int64) ([]*node, error) {
+	b := make([]byte, 8)
+	if size < 8 {
+		return nil, fmt.Errorf("TIFF header at %08X is truncated", base)
+	}
+	if _, err := r.ReadAt(b, base); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if string(b[:2]) == "MM" {
+		order = binary.BigEndian
+	}
+	header := group("Header", "", []*node{
+		{name: "byte order", value: fmt.Sprintf("%q", b[:2]), start: base, end: base + 2},
+		{name: "magic", value: fmt.Sprint(order.Uint16(b[2:])), start: base + 2, end: base + 4},
+		{name: "IFD offset", value: fmt.Sprintf("0x%X", order.Uint32(b[4:])), start: base + 4, end: base + 8},
+	})
+	t := &tiff{r: r, base: base, size: size, order: order, seen: map[int64]bool{}}
+	nodes := []*node{header}
+
+	// IFDs form a linked list, the second one describing a thumbnail
+	offset := int64(order.Uint32(b[4:]))
+	for i := 0; offset != 0; i++ {
+		if i == tiffMaxIFDs {
+			return nodes, fmt.Errorf("showing the first %d IFDs", tiffMaxIFDs)
+		}
+		ifd, next, err := t.ifd(fmt.Sprintf("IFD%d", i), offset, tiffTags, 0)
+		if ifd != nil {
+			nodes = append(nodes, ifd)
+		}
+		if err != nil {
+			return nodes, err
+		}
+		offset = next
+	}
+	return nodes, nil
+}
+
+// tiff holds the state of decoding a TIFF structure
+type tiff struct {
+	r     io.ReaderAt
+	base  int64
+	size  int64
+	order binary.ByteOrder
+	seen  map[int64]bool // IFD offsets, to stop at loops
+}
+
+// ifd decodes the IFD at offset, returning its node and the offset of the
+// next IFD
+func (t *tiff) ifd(name string, offset int64, tags map[uint16]string, depth int) (*node, int64, error) {
+	if t.seen[offset] || depth > tiffMaxIFDs {
+		return nil, 0, fmt.Errorf("%s at %08X is a loop", name, t.base+offset)
+	}
+	t.seen[offset] = true
+	pos := t.base + offset
+	if offset+2 > t.size {
+		return nil, 0, fmt.Errorf("%s at %08X is past the end", name, pos)
+	}
+	b := make([]byte, 2)
+	if _, err := t.r.ReadAt(b, pos); err != nil {
+		return nil, 0, err
+	}
+	count := int64(t.order.Uint16(b))
+	if count > tiffMaxEntries || offset+2+12*count+4 > t.size {
+		return nil, 0, fmt.Errorf("%s at %08X is truncated", name, pos)
+	}
+	b = make([]byte, 12*count+4)
+	if _, err := t.r.ReadAt(b, pos+2); err != nil {
+		return nil, 0, err
+	}
+
+	n := &node{name: name, value: fmt.Sprintf("%d entries", count), start: pos, end: pos + 2 + 12*count + 4}
+	n.children = append(n.children, &node{name: "count", value: fmt.Sprint(count), start: pos, end: pos + 2})
+	var thumbnail, thumbnailLength int64
+	for i := int64(0); i < count; i++ {
+		e := t.entry(b[12*i:], pos+2+12*i, tags)
+		n.children = append(n.children, e.node)
+		if sub, ok := tiffSubIFDs[e.tag]; ok && (e.typ == 4 || e.typ == 13) {
+			for j, v := range e.values {
+				name := tiffTagName(tags, e.tag)
+				if len(e.values) > 1 {
+					name = fmt.Sprintf("%s[%d]", name, j)
+				}
+				child, _, err := t.ifd(name, int64(v), sub, depth+1)
+				if err != nil {
+					return n, 0, err
+				}
+				e.node.children = append(e.node.children, child)
+			}
+		}
+		if len(e.values) == 1 {
+			switch e.tag {
+			case 0x0201:
+				thumbnail = int64(e.values[0])
+			case 0x0202:
+				thumbnailLength = int64(e.values[0])
+			}
+		}
+	}
+	if thumbnailLength > 0 && thumbnail+thumbnailLength <= t.size {
+		n.children = append(n.children, &node{name: "thumbnail", value: fmt.Sprintf("%d bytes", thumbnailLength),
+			start: t.base + thumbnail, end: t.base + thumbnail + thumbnailLength})
+	}
+	next := t.order.Uint32(b[12*count:])
+	n.children = append(n.children, &node{name: "next IFD", value: fmt.Sprintf("0x%X", next), start: n.end - 4, end: n.end})
+	return n, int64(next), nil
+}
+
+// tiffEntry is a decoded IFD entry
+type tiffEntry struct {
+	node   *node
+	tag    uint16
+	typ    uint16
+	values []uint64 // of integer types
+}
+
+// entry decodes the 12 byte IFD entry b at pos
+func (t *tiff) entry(b []byte, pos int64, tags map[uint16]string) tiffEntry {
+	tag, typ, count := t.order.Uint16(b), t.order.Uint16(b[2:]), int64(t.order.Uint32(b[4:]))
+	e := tiffEntry{tag: tag, typ: typ}
+	typeName := fmt.Sprintf("type %d", typ)
+	if int(typ) < len(tiffTypes) && typ > 0 {
+		typeName = tiffTypes[typ]
+	}
+	e.node = &node{
+		name:  tiffTagName(tags, tag),
+		start: pos,
+		end:   pos + 12,
+		children: []*node{
+			{name: "tag", value: fmt.Sprintf("0x%04X", tag), start: pos, end: pos + 2},
+			{name: "type", value: typeName, start: pos + 2, end: pos + 4},
+			{name: "count", value: fmt.Sprint(count), start: pos + 4, end: pos + 8},
+		},
+	}
+	if int(typ) >= len(tiffTypeSizes) || typ == 0 {
+		e.node.value = "unknown type"
+		e.node.children = append(e.node.children, &node{name: "value", value: formatBytes(b[8:12]), start: pos + 8, end: pos + 12})
+		return e
+	}
+
+	// values of up to 4 bytes are stored in the entry instead of their offset
+	size := tiffTypeSizes[typ] * count
+	data := &node{name: "value", start: pos + 8, end: pos + 8 + min64(size, 4)}
+	if size > 4 {
+		offset := int64(t.order.Uint32(b[8:]))
+		e.node.children = append(e.node.children, &node{name: "offset", value: fmt.Sprintf("0x%X", offset), start: pos + 8, end: pos + 12})
+		if count > t.size || offset+size > t.size {
+			e.node.value = "past the end"
+			return e
+		}
+		data.start, data.end = t.base+offset, t.base+offset+size
+	}
+	v := make([]byte, data.end-data.start)
+	if _, err := t.r.ReadAt(v, data.start); err != nil {
+		e.node.value = err.Error()
+		return e
+	}
+	e.node.value, e.values = t.value(v, typ, count)
+	data.value = e.node.value
+	e.node.children = append(e.node.children, data)
+	return e
+}
+
+// value formats count values of type typ in b
+func (t *tiff) value(b []byte, typ uint16, count int64) (string, []uint64) {
+	switch typ {
+	case 2:
+		return fmt.Sprintf("%q", strings.TrimRight(string(b), "\x00")), nil
+	case 7:
+		if printable(bytes.TrimRight(b, "\x00")) && len(b) > 1 {
+			return fmt.Sprintf("%q", bytes.TrimRight(b, "\x00")), nil
+		}
+		return formatBytes(b), nil
+	}
+	var s []string
+	var values []uint64
+	size := int(tiffTypeSizes[typ])
+	for i := 0; i < int(count); i++ {
+		if i == tiffMaxValues {
+			s = append(s, "...")
+			break
+		}
+		p := b[i*size:]
+		switch typ {
+		case 1, 3, 4, 13:
+			v := getUint(p, size, t.order)
+			values = append(values, v)
+			s = append(s, fmt.Sprint(v))
+		case 6:
+			s = append(s, fmt.Sprint(int8(p[0])))
+		case 8:
+			s = append(s, fmt.Sprint(int16(t.order.Uint16(p))))
+		case 9:
+			s = append(s, fmt.Sprint(int32(t.order.Uint32(p))))
+		case 5:
+			s = append(s, fmt.Sprintf("%d/%d", t.order.Uint32(p), t.order.Uint32(p[4:])))
+		case 10:
+			s = append(s, fmt.Sprintf("%d/%d", int32(t.order.Uint32(p)), int32(t.order.Uint32(p[4:]))))
+		case 11:
+			s = append(s, fmt.Sprint(math.Float32frombits(t.order.Uint32(p))))
+		case 12:
+			s = append(s, fmt.Sprint(math.Float64frombits(t.order.Uint64(p))))
+		}
+	}
+	return strings.Join(s, ", "), values
+}
+
+// tiffTagName returns the name of tag
+func tiffTagName(tags map[uint16]string, tag uint16) string {
+	if name, ok := tags[tag]; ok {
+		return name
+	}
+	return fmt.Sprintf("tag 0x%04X", tag)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// tiffTestFile returns a little endian TIFF structure with an IFD holding a
+// short, a string and an EXIF IFD
+func tiffTestFile() []byte {
+	order := binary.LittleEndian
+	b := make([]byte, 0x60)
+	copy(b, "II*\x00")
+	order.PutUint32(b[4:], 8)
+	entry := func(pos int, tag, typ uint16, count, value uint32) {
+		order.PutUint16(b[pos:], tag)
+		order.PutUint16(b[pos+2:], typ)
+		order.PutUint32(b[pos+4:], count)
+		order.PutUint32(b[pos+8:], value)
+	}
+	order.PutUint16(b[8:], 3)
+	entry(10, 0x0100, 3, 1, 2)    // ImageWidth
+	entry(22, 0x010F, 2, 6, 0x50) // Make
+	entry(34, 0x8769, 4, 1, 0x32) // ExifIFD
+	order.PutUint16(b[0x32:], 1)  // EXIF IFD
+	entry(0x34, 0x9000, 7, 4, 0x30323230)
+	copy(b[0x50:], "maker\x00")
+	return b
+}
+
+func TestTIFF(t *testing.T) {
+	nodes := parseValid(t, parseTIFF, tiffTestFile())
+	if n := findNode(nodes, "Make"); n == nil || n.value != `"maker"` {
+		t.Fatal("string not decoded")
+	}
+	if n := findNode(nodes, "ExifVersion"); n == nil || n.value != `"0220"` {
+		t.Fatal("EXIF IFD not decoded")
+	}
+}
+
+func TestTIFFTruncated(t *testing.T) {
+	parseTruncated(t, parseTIFF, tiffTestFile())
+}
+
+func TestTIFFCorrupt(t *testing.T) {
+	parseCorrupt(t, parseTIFF, tiffTestFile())
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell"
+)
+
+// this file contains the structure panel, which shows a tree of fields
+// decoded from the file, each mapped to the range of bytes it covers
+
+// node is an entry in a structure tree
+type node struct {
+	name     string
+	value    string
+	start    int64 // file offset of first byte
+	end      int64 // file offset after last byte
+	children []*node
+	expanded bool
+	fix      []byte      // bytes replacing the node's range to repair it, e.g. a checksum
+	color    tcell.Color // color of the bytes of the node and its children, or 0 to alternate colors
+}
+
+type treePanel struct {
+	a     *editorArea
+	name  string     // name of structure shown in title
+	roots []*node    // top level nodes
+	row   int        // selected row
+	top   int        // first row in view
+	spans []treeSpan // ranges of leaf nodes sorted by start, used to color bytes
+}
+
+// treeSpan is the range of a leaf node and its color
+type treeSpan struct {
+	start int64
+	end   int64
+	color tcell.Color
+}
+
+// treeRow is a visible row of the tree
+type treeRow struct {
+	n     *node
+	depth int
+}
+
+// treeColors are cycled through to color consecutive fields
+var treeColors = []tcell.Color{tcell.ColorTeal, tcell.ColorOlive, tcell.ColorPurple, tcell.ColorNavy}
+
+// show replaces the tree shown in the panel
+func (p *treePanel) show(name string, roots []*node) {
+	p.name, p.roots, p.row, p.top = name, roots, 0, 0
+	p.index()
+
+	// expand top level nodes
+	for _, n := range roots {
+		n.expanded = true
+	}
+}
+
+// update replaces the tree after the file changed, keeping the selected row
+// and the nodes expanded in the previous tree
+func (p *treePanel) update(roots []*node) {
+	expanded := map[string]bool{}
+	walkPaths(p.roots, "", func(n *node, path string) {
+		expanded[path] = n.expanded
+	})
+	walkPaths(roots, "", func(n *node, path string) {
+		n.expanded = expanded[path]
+	})
+	p.roots = roots
+	p.index()
+	p.row = max(min(p.row, len(p.rows())-1), 0)
+}
+
+// index collects leaf nodes for coloring
+func (p *treePanel) index() {
+	p.spans = p.spans[:0]
+	var walk func(nodes []*node, color tcell.Color)
+	walk = func(nodes []*node, color tcell.Color) {
+		for _, n := range nodes {
+			c := color
+			if n.color != 0 {
+				c = n.color
+			}
+			if len(n.children) == 0 && n.end > n.start {
+				p.spans = append(p.spans, treeSpan{n.start, n.end, c})
+			}
+			walk(n.children, c)
+		}
+	}
+	walk(p.roots, 0)
+	sort.SliceStable(p.spans, func(i, j int) bool { return p.spans[i].start < p.spans[j].start })
+
+	// consecutive fields without a color are colored differently
+	for i := range p.spans {
+		if p.spans[i].color == 0 {
+			p.spans[i].color = treeColors[i%len(treeColors)]
+		}
+	}
+}
+
+// walkPaths calls f for all nodes, with the path of names leading to each node
+func walkPaths(nodes []*node, prefix string, f func(n *node, path string)) {
+	for _, n := range nodes {
+		path := prefix + "/" + n.name
+		f(n, path)
+		walkPaths(n.children, path, f)
+	}
+}
+
+// rows returns the rows of all nodes whose parents are expanded
+func (p *treePanel) rows() []treeRow {
+	var rows []treeRow
+	var walk func(nodes []*node, depth int)
+	walk = func(nodes []*node, depth int) {
+		for _, n := range nodes {
+			rows = append(rows, treeRow{n, depth})
+			if n.expanded {
+				walk(n.children, depth+1)
+			}
+		}
+	}
+	walk(p.roots, 0)
+	return rows
+}
+
+// selected returns the selected node, if any
+func (p *treePanel) selected() *node {
+	rows := p.rows()
+	if p.row < 0 || p.row >= len(rows) {
+		return nil
+	}
+	return rows[p.row].n
+}
+
+func (p *treePanel) title() string {
+	if p.name == "" {
+		return "Structure"
+	}
+	return "Structure (" + p.name + ")"
+}
+
+func (p *treePanel) draw(o obj, focused bool) {
+	rows := p.rows()
+
+	// scroll selected row into view
+	if p.row < p.top {
+		p.top = p.row
+	}
+	if p.row >= p.top+o.h {
+		p.top = p.row - o.h + 1
+	}
+
+	for i := 0; i < o.h; i++ {
+		r := p.top + i
+		if r >= len(rows) {
+			drawRow(o, i, "", false)
+			continue
+		}
+		n := rows[r].n
+		marker := "  "
+		if len(n.children) > 0 && n.expanded {
+			marker = "- "
+		} else if len(n.children) > 0 {
+			marker = "+ "
+		}
+		text := strings.Repeat("  ", rows[r].depth) + marker + n.name
+		if n.value != "" {
+			text += ": " + n.value
+		}
+		drawRow(o, i, text, focused && r == p.row)
+	}
+
+	// show range of selected node in last row
+	if n := p.selected(); n != nil && focused && o.h > 1 {
+		status := fmt.Sprintf("%08X-%08X (%d bytes)", n.start, n.end, n.end-n.start)
+		if len(p.fixes(n)) > 0 {
+			status += "  f: fix"
+		}
+		if n.end > n.start {
+			status += "  x: extract"
+		}
+		drawRow(o, o.h-1, status, true)
+	}
+}
+
+// follow selects the innermost node covering offset, expanding its parents
+func (p *treePanel) follow(offset int64) {
+	var path []*node
+	nodes := p.roots
+	for {
+		var found *node
+		for _, n := range nodes {
+			if offset >= n.start && offset < n.end {
+				found = n
+				break
+			}
+		}
+		if found == nil {
+			break
+		}
+		path = append(path, found)
+		nodes = found.children
+	}
+	if len(path) == 0 {
+		return
+	}
+	for _, n := range path[:len(path)-1] {
+		n.expanded = true
+	}
+	for i, r := range p.rows() {
+		if r.n == path[len(path)-1] {
+			p.row = i
+			break
+		}
+	}
+}
+
+// fixes returns n and its descendants which can be repaired
+func (p *treePanel) fixes(n *node) []*node {
+	var nodes []*node
+	walkPaths([]*node{n}, "", func(n *node, path string) {
+		if n.fix != nil {
+			nodes = append(nodes, n)
+		}
+	})
+	return nodes
+}
+
+// highlight returns the range of the selected node
+func (p *treePanel) highlight() (int64, int64, bool) {
+	if n := p.selected(); n != nil {
+		return n.start, n.end, true
+	}
+	return 0, 0, false
+}
+
+// color returns the color of the field covering the byte at offset
+func (p *treePanel) color(offset int64) (tcell.Color, bool) {
+	i := sort.Search(len(p.spans), func(i int) bool { return p.spans[i].start > offset }) - 1
+	if i < 0 || offset >= p.spans[i].end {
+		return 0, false
+	}
+	return p.spans[i].color, true
+}
+
+func (p *treePanel) onEvent(ev tcell.Event) error {
+	switch v := ev.(type) {
+	case *tcell.EventKey:
+		rows := p.rows()
+		switch v.Key() {
+		case tcell.KeyUp:
+			// select previous node
+			p.row = max(p.row-1, 0)
+		case tcell.KeyDown:
+			// select next node
+			p.row = min(p.row+1, len(rows)-1)
+		case tcell.KeyPgUp:
+			// select node one page back
+			p.row = max(p.row-p.a.panels.rect().h+2, 0)
+		case tcell.KeyPgDn:
+			// select node one page forward
+			p.row = max(min(p.row+p.a.panels.rect().h-2, len(rows)-1), 0)
+		case tcell.KeyRight:
+			// expand selected node
+			if n := p.selected(); n != nil {
+				n.expanded = true
+			}
+		case tcell.KeyLeft:
+			// collapse selected node, or select its parent
+			if n := p.selected(); n != nil && n.expanded && len(n.children) > 0 {
+				n.expanded = false
+			} else if p.row < len(rows) {
+				for r := p.row - 1; r >= 0; r-- {
+					if rows[r].depth < rows[p.row].depth {
+						p.row = r
+						break
+					}
+				}
+			}
+		case tcell.KeyEnter:
+			// jump to selected node
+			if n := p.selected(); n != nil {
+				n.expanded = !n.expanded
+				return p.a.jump(n.start)
+			}
+		case tcell.KeyRune:
+			switch v.Rune() {
+			case 'f':
+				// repair selected node and its children
+				if n := p.selected(); n != nil {
+					if err := p.a.writeFixes(p.fixes(n)); err != nil {
+						app.message = err.Error()
+						p.a.redraw()
+					}
+				}
+			case 'x':
+				// extract bytes of selected node to a new file
+				if n := p.selected(); n != nil && n.end > n.start {
+					name := fmt.Sprintf("%s.%08X", filepath.Base(app.flags.Filename), n.start)
+					return app.prompt("Extract to file: ", name, func(filename string) error {
+						return p.a.extract(n.start, n.end, filename)
+					})
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// this file contains the ZIP archive format, listing the local header and
+// data of each entry and checking them against the central directory
+
+const (
+	zipLocalSignature      = 0x04034b50
+	zipCentralSignature    = 0x02014b50
+	zipEnd64Signature      = 0x06064b50
+	zipEnd64LocSignature   = 0x07064b50
+	zipDescriptorSignature = 0x08074b50
+	zipCentralHeaderSize   = 46
+	zipEndSize             = 22
+	zipEnd64LocSize        = 20
+	zipMaxCommentSize      = 65535
+	zipMaxEntries          = 1 << 20
+	zipFlagDescriptor      = 0x8 // sizes and crc follow the data
+	zipExtraZip64          = 0x0001
+	zipUnknownSize         = 0xFFFFFFFF // size stored in zip64 extra field
+)
+
+var zipMethods = map[uint64]string{
+	0:  "stored",
+	8:  "deflate",
+	9:  "deflate64",
+	12: "bzip2",
+	14: "lzma",
+	93: "zstd",
+	95: "xz",
+	99: "aes",
+}
+
+// zipHeader holds the fields of a local or central header compared between both
+type zipHeader struct {
+	name       string
+	flags      uint64
+	method     uint64
+	crc        uint64
+	compressed uint64
+	size       uint64
+	offset     uint64 // offset of local header, in central headers only
+}
+
+func detectZIP(head []byte) bool {
+	// empty archives only consist of the end of central directory record
+	return bytes.HasPrefix(head, []byte("PK\x03\x04")) || bytes.HasPrefix(head, []byte("PK\x05\x06"))
+}
+
+func parseZIP(r io.ReaderAt, size int64) ([]*node, error) {
+	// end of central directory record is at the end, followed by a comment
+	tail := make([]byte, min64(size, zipEndSize+zipMaxCommentSize))
+	if _, err := r.ReadAt(tail, size-int64(len(tail))); err != nil {
+		return nil, err
+	}
+	i := bytes.LastIndex(tail, []byte("PK\x05\x06"))
+	if i < 0 {
+		return nil, fmt.Errorf("end of central directory record not found")
+	}
+	endOffset := size - int64(len(tail)) + int64(i)
+	endFields, e, err := readFields(r, endOffset, binary.LittleEndian, []structField{
+		{"signature", 4, nil},
+		{"disk", 2, nil},
+		{"central directory disk", 2, nil},
+		{"entries on disk", 2, nil},
+		{"entries", 2, nil},
+		{"central directory size", 4, nil},
+		{"central directory offset", 4, nil},
+		{"comment length", 2, nil},
+	})
+	if err != nil {
+		return nil, err
+	}
+	end := group("End of central directory", "", endFields)
+	if e["comment length"] > 0 {
+		comment := &node{name: "comment", start: end.end, end: min64(end.end+int64(e["comment length"]), size)}
+		comment.value = fmt.Sprintf("%q", readString(r, comment.start, int(comment.end-comment.start)))
+		end.children = append(end.children, comment)
+		end.end = comment.end
+	}
+	entries, cdSize, cdOffset := e["entries"], e["central directory size"], e["central directory offset"]
+
+	// zip64 archives store counts and sizes exceeding 32 bits in another record
+	var nodes []*node
+	if endOffset >= zipEnd64LocSize {
+		loc, l, err := readFields(r, endOffset-zipEnd64LocSize, binary.LittleEndian, []structField{
+			{"signature", 4, nil},
+			{"disk", 4, nil},
+			{"end of central directory offset", 8, nil},
+			{"disks", 4, nil},
+		})
+		if err == nil && l["signature"] == zipEnd64LocSignature {
+			end64, e64, err := readFields(r, int64(l["end of central directory offset"]), binary.LittleEndian, []structField{
+				{"signature", 4, nil},
+				{"record size", 8, nil},
+				{"version made by", 2, nil},
+				{"version needed", 2, nil},
+				{"disk", 4, nil},
+				{"central directory disk", 4, nil},
+				{"entries on disk", 8, nil},
+				{"entries", 8, nil},
+				{"central directory size", 8, nil},
+				{"central directory offset", 8, nil},
+			})
+			if err == nil && e64["signature"] == zipEnd64Signature {
+				entries, cdSize, cdOffset = e64["entries"], e64["central directory size"], e64["central directory offset"]
+				nodes = append(nodes, group("Zip64 end of central directory", "", end64))
+			}
+			nodes = append(nodes, group("Zip64 end of central directory locator", "", loc))
+		}
+	}
+
+	// central directory
+	var problems []*node
+	problem := func(start, end int64, format string, args ...interface{}) {
+		problems = append(problems, &node{name: fmt.Sprintf(format, args...), start: start, end: end})
+	}
+	var centrals []zipHeader
+	var centralNodes []*node
+	pos := int64(cdOffset)
+	for len(centrals) < zipMaxEntries && pos+zipCentralHeaderSize <= endOffset {
+		h, n, err := zipCentralHeader(r, pos)
+		if err != nil {
+			problem(pos, pos, "%v", err)
+			break
+		}
+		if h == nil {
+			break
+		}
+		centrals = append(centrals, *h)
+		centralNodes = append(centralNodes, n)
+		pos = n.end
+	}
+	cd := &node{
+		name:     "Central directory",
+		value:    fmt.Sprintf("[%d]", len(centralNodes)),
+		start:    int64(cdOffset),
+		end:      pos,
+		children: centralNodes,
+	}
+	if uint64(len(centrals)) != entries {
+		problem(end.start, end.end, "end record counts %d entries, central directory has %d", entries, len(centrals))
+	}
+	if uint64(pos)-cdOffset != cdSize {
+		problem(end.start, end.end, "end record gives central directory size %d, actual size is %d", cdSize, uint64(pos)-cdOffset)
+	}
+
+	// entries in the order of their local headers
+	sort.SliceStable(centrals, func(i, j int) bool { return centrals[i].offset < centrals[j].offset })
+	var entryNodes []*node
+	local := map[int64]bool{}
+	for i, c := range centrals {
+		n, mismatch, err := zipEntry(r, int64(c.offset), &c)
+		if err != nil {
+			n = &node{name: c.name, value: err.Error(), start: int64(c.offset), end: int64(c.offset)}
+			problem(n.start, n.end, "%s: %v", c.name, err)
+		} else if mismatch != "" {
+			problem(n.start, n.end, "%s: local and central header differ in %s", c.name, mismatch)
+		}
+		n.name = fmt.Sprintf("[%d] %s", i, n.name)
+		local[int64(c.offset)] = true
+		entryNodes = append(entryNodes, n)
+	}
+
+	// local headers missing from the central directory, found by following
+	// consecutive entries from the start of the file
+	for pos := int64(0); pos < int64(cdOffset); {
+		n, _, err := zipEntry(r, pos, nil)
+		if err != nil {
+			break
+		}
+		if !local[pos] {
+			n.name = "[?] " + n.name
+			n.value = "not in central directory, " + n.value
+			problem(n.start, n.end, "local header at %08X is not in central directory", pos)
+			entryNodes = append(entryNodes, n)
+		}
+		pos = n.end
+	}
+	sort.SliceStable(entryNodes, func(i, j int) bool { return entryNodes[i].start < entryNodes[j].start })
+
+	nodes = append([]*node{
+		group("Entries", fmt.Sprintf("[%d]", len(entryNodes)), entryNodes),
+		cd,
+	}, nodes...)
+	nodes = append(nodes, end)
+	if len(problems) > 0 {
+		// listed first, but not covering any bytes, so the cursor follows the entries
+		n := &node{name: "Inconsistencies", value: fmt.Sprintf("[%d]", len(problems)), children: problems}
+		nodes = append([]*node{n}, nodes...)
+	}
+	return nodes, nil
+}
+
+// zipCentralHeader decodes the central directory header at pos, or returns
+// nil if there is none
+func zipCentralHeader(r io.ReaderAt, pos int64) (*zipHeader, *node, error) {
+	fields, f, err := readFields(r, pos, binary.LittleEndian, []structField{
+		{"signature", 4, nil},
+		{"version made by", 2, nil},
+		{"version needed", 2, nil},
+		{"flags", 2, nil},
+		{"method", 2, zipMethod},
+		{"modified time", 2, zipTime},
+		{"modified date", 2, zipDate},
+		{"crc", 4, nil},
+		{"compressed size", 4, nil},
+		{"uncompressed size", 4, nil},
+		{"name length", 2, nil},
+		{"extra length", 2, nil},
+		{"comment length", 2, nil},
+		{"disk", 2, nil},
+		{"internal attributes", 2, nil},
+		{"external attributes", 4, nil},
+		{"local header offset", 4, nil},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if f["signature"] != zipCentralSignature {
+		return nil, nil, nil
+	}
+	h := &zipHeader{
+		flags:      f["flags"],
+		method:     f["method"],
+		crc:        f["crc"],
+		compressed: f["compressed size"],
+		size:       f["uncompressed size"],
+		offset:     f["local header offset"],
+	}
+	pos = fields[len(fields)-1].end
+	name, extra := zipNameExtra(r, pos, f["name length"], f["extra length"], h)
+	fields = append(fields, name, extra)
+	pos = extra.end
+	if f["comment length"] > 0 {
+		comment := &node{name: "comment", start: pos, end: pos + int64(f["comment length"])}
+		comment.value = fmt.Sprintf("%q", readString(r, comment.start, int(f["comment length"])))
+		fields = append(fields, comment)
+		pos = comment.end
+	}
+	n := group(h.name, fmt.Sprintf("local header 0x%X", h.offset), fields)
+	return h, n, nil
+}
+
+// zipEntry decodes the local header and data at pos, returning the fields
+// differing from the central header c if given
+func zipEntry(r io.ReaderAt, pos int64, c *zipHeader) (*node, string, error) {
+	fields, f, err := readFields(r, pos, binary.LittleEndian, []structField{
+		{"signature", 4, nil},
+		{"version needed", 2, nil},
+		{"flags", 2, nil},
+		{"method", 2, zipMethod},
+		{"modified time", 2, zipTime},
+		{"modified date", 2, zipDate},
+		{"crc", 4, nil},
+		{"compressed size", 4, nil},
+		{"uncompressed size", 4, nil},
+		{"name length", 2, nil},
+		{"extra length", 2, nil},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if f["signature"] != zipLocalSignature {
+		return nil, "", fmt.Errorf("no local header at %08X", pos)
+	}
+	h := &zipHeader{
+		flags:      f["flags"],
+		method:     f["method"],
+		crc:        f["crc"],
+		compressed: f["compressed size"],
+		size:       f["uncompressed size"],
+	}
+	name, extra := zipNameExtra(r, fields[len(fields)-1].end, f["name length"], f["extra length"], h)
+	header := group("local header", "", append(fields, name, extra))
+
+	// sizes of entries with a data descriptor are only known from the central header
+	compressed := h.compressed
+	if h.flags&zipFlagDescriptor != 0 && c != nil {
+		compressed = c.compressed
+	}
+	data := &node{name: "data", value: fmt.Sprintf("%d bytes", compressed), start: header.end, end: header.end + int64(compressed)}
+	children := []*node{header, data}
+	if h.flags&zipFlagDescriptor != 0 {
+		// descriptor signature is optional
+		descriptor := data.end
+		b := make([]byte, 4)
+		if _, err := r.ReadAt(b, descriptor); err == nil && binary.LittleEndian.Uint32(b) == zipDescriptorSignature {
+			descriptor += 4
+		}
+		size := 4
+		if c != nil && (c.compressed >= zipUnknownSize || c.size >= zipUnknownSize) {
+			size = 8
+		}
+		d, v, err := readFields(r, descriptor, binary.LittleEndian, []structField{
+			{"crc", 4, nil},
+			{"compressed size", size, nil},
+			{"uncompressed size", size, nil},
+		})
+		if err == nil {
+			n := group("data descriptor", "", d)
+			n.start = data.end
+			children = append(children, n)
+			h.crc, h.compressed, h.size = v["crc"], v["compressed size"], v["uncompressed size"]
+		}
+	}
+	n := group(h.name, fmt.Sprintf("%s, %d bytes, crc 0x%08X", zipMethod(h.method), h.compressed, h.crc), children)
+	mismatch := ""
+	if c != nil {
+		if mismatch = zipCompare(h, c); mismatch != "" {
+			n.value += ", differs from central header"
+		}
+	}
+	return n, mismatch, nil
+}
+
+// zipNameExtra decodes the name and extra field at pos, updating sizes and
+// offset of h from a zip64 extra field
+func zipNameExtra(r io.ReaderAt, pos int64, nameLength, extraLength uint64, h *zipHeader) (*node, *node) {
+	h.name = readString(r, pos, int(nameLength))
+	name := &node{name: "name", value: fmt.Sprintf("%q", h.name), start: pos, end: pos + int64(nameLength)}
+	extra := &node{name: "extra", value: fmt.Sprintf("%d bytes", extraLength), start: name.end, end: name.end + int64(extraLength)}
+
+	// extra field is a list of id, size and data
+	b := []byte(readString(r, extra.start, int(extraLength)))
+	for len(b) >= 4 {
+		id, size := binary.LittleEndian.Uint16(b), int(binary.LittleEndian.Uint16(b[2:]))
+		if size > len(b)-4 {
+			break
+		}
+		if id == zipExtraZip64 {
+			// present values replace those stored as unknown, in this order
+			v := b[4 : 4+size]
+			for _, p := range []*uint64{&h.size, &h.compressed, &h.offset} {
+				if *p == zipUnknownSize && len(v) >= 8 {
+					*p, v = binary.LittleEndian.Uint64(v), v[8:]
+				}
+			}
+		}
+		b = b[4+size:]
+	}
+	return name, extra
+}
+
+// zipCompare returns the fields differing between a local and a central header
+func zipCompare(l, c *zipHeader) string {
+	var fields []string
+	if l.name != c.name {
+		fields = append(fields, "name")
+	}
+	if l.flags != c.flags {
+		fields = append(fields, "flags")
+	}
+	if l.method != c.method {
+		fields = append(fields, "method")
+	}
+	if l.crc != c.crc {
+		fields = append(fields, "crc")
+	}
+	if l.compressed != c.compressed {
+		fields = append(fields, "compressed size")
+	}
+	if l.size != c.size {
+		fields = append(fields, "uncompressed size")
+	}
+	return strings.Join(fields, ", ")
+}
+
+func zipMethod(v uint64) string {
+	if s, ok := zipMethods[v]; ok {
+		return s
+	}
+	return fmt.Sprintf("method %d", v)
+}
+
+func zipTime(v uint64) string {
+	return fmt.Sprintf("%02d:%02d:%02d", v>>11, v>>5&0x3F, v&0x1F*2)
+}
+
+func zipDate(v uint64) string {
+	return fmt.Sprintf("%04d-%02d-%02d", 1980+v>>9, v>>5&0xF, v&0x1F)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+// zipTestFile returns an archive of a stored and a deflated file
+func zipTestFile(t *testing.T) []byte {
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	for _, h := range []*zip.FileHeader{{Name: "a.txt", Method: zip.Store}, {Name: "b.txt", Method: zip.Deflate}} {
+		f, err := w.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(bytes.Repeat([]byte(h.Name), 10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.SetComment("comment"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestZIP(t *testing.T) {
+	nodes := parseValid(t, parseZIP, zipTestFile(t))
+	if findNode(nodes, "a.txt") == nil || findNode(nodes, "b.txt") == nil {
+		t.Fatal("entries not decoded")
+	}
+}
+
+func TestZIPTruncated(t *testing.T) {
+	parseTruncated(t, parseZIP, zipTestFile(t))
+}
+
+func TestZIPCorrupt(t *testing.T) {
+	parseCorrupt(t, parseZIP, zipTestFile(t))
+}